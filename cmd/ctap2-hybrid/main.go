@@ -6,26 +6,59 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
 	"time"
 
+	"ctap2-hybrid-transport/pkg/attestation"
 	"ctap2-hybrid-transport/pkg/ble"
+	"ctap2-hybrid-transport/pkg/bridge"
 	"ctap2-hybrid-transport/pkg/ctap2"
+	"ctap2-hybrid-transport/pkg/events"
+	"ctap2-hybrid-transport/pkg/linking"
 	"ctap2-hybrid-transport/pkg/qrcode"
 	"ctap2-hybrid-transport/pkg/tunnel"
 )
 
+// eventsLogPath is where the structured NDJSON event stream is written,
+// alongside log/latest.log (see setupLogFile).
+const eventsLogPath = "log/events.ndjson"
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(runReplayCommand(os.Args[2:]))
+		case "fuzz":
+			os.Exit(runFuzzCommand(os.Args[2:]))
+		}
+	}
+
 	var (
-		outputFile = flag.String("output", "attestation.json", "Output file for attestation")
-		tunnelURL  = flag.String("tunnel", "wss://cableconnect.googleapis.com/v1/connect", "Tunnel service URL")
-		timeout    = flag.Duration("timeout", 5*time.Minute, "Operation timeout")
+		outputFile    = flag.String("output", "attestation.json", "Output file for attestation")
+		tunnelURL     = flag.String("tunnel", "wss://cableconnect.googleapis.com/v1/connect", "Tunnel service URL")
+		timeout       = flag.Duration("timeout", 5*time.Minute, "Operation timeout")
+		bridgeMode    = flag.String("bridge", "", `Virtual authenticator bridge mode: after pairing, expose the phone as a local device instead of creating one credential and exiting. "pcsc" would expose a CCID/PC-SC smart card reader; "hid" would expose a USB/IP HID FIDO device (Linux only). NEITHER MODE WORKS END TO END YET: this build has no native backend for either, so runBridge's tunnel multiplexing starts up but host.Start immediately fails with a clear "no native backend" error. See pkg/bridge.`)
+		linkStorePath = flag.String("link-store", "link_state.json", "Path to the persisted linked-device state file (see pkg/linking)")
+		forget        = flag.Bool("forget", false, "Forget any stored linked-device state and exit, forcing a fresh QR pairing next run")
+		backend       = flag.String("backend", "file", `Authenticator backend: "file" keeps resident credentials in a local JSON file (default); "tpm" creates keys under a TPM 2.0 endorsement hierarchy (not available in this build). See pkg/ctap2.`)
+		tpmDevice     = flag.String("tpm-device", "", "TPM device path for --backend=tpm (e.g. /dev/tpmrm0 on Linux); empty uses the platform default")
+		metricsAddr   = flag.String("metrics-addr", "", "If set, serve Prometheus metrics (see pkg/events) on this address, e.g. :9101")
 	)
 	flag.Parse()
 
+	if *forget {
+		if err := linking.NewFileStore(*linkStorePath).Forget(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to forget stored linked-device state: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Forgot stored linked-device state.")
+		return
+	}
+
 	// Setup log file for non-QR output
 	if err := setupLogFile(); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to setup log file: %v\n", err)
@@ -43,7 +76,7 @@ func main() {
 		sig := <-sigCh
 		log.Printf("Received signal %v, initiating shutdown...", sig)
 		cancel()
-		
+
 		// Give some time for graceful shutdown, then force exit
 		go func() {
 			time.Sleep(3 * time.Second)
@@ -52,15 +85,30 @@ func main() {
 		}()
 	}()
 
+	eventEmitter, err := events.NewEmitter(eventsLogPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open event stream: %v\n", err)
+		os.Exit(1)
+	}
+	defer eventEmitter.Close()
+
+	if *metricsAddr != "" {
+		go serveMetrics(*metricsAddr, eventEmitter.Metrics)
+	}
+
 	// Initialize CTAP2 hybrid transport
 	transport := &ctap2.HybridTransport{
-		TunnelURL:  *tunnelURL,
-		OutputFile: *outputFile,
+		TunnelURL:     *tunnelURL,
+		OutputFile:    *outputFile,
+		LinkStorePath: *linkStorePath,
+		Backend:       *backend,
+		TPMDevice:     *tpmDevice,
+		Events:        eventEmitter,
 	}
 
 	// Start the hybrid transport process
 	log.Printf("Starting hybrid transport with timeout: %v", *timeout)
-	
+
 	// Ensure log file is properly closed on exit
 	defer func() {
 		if logFileHandle != nil {
@@ -69,8 +117,24 @@ func main() {
 			logFileHandle.Close()
 		}
 	}()
-	
-	if err := runHybridTransport(ctx, transport); err != nil {
+
+	runCeremony := runHybridTransport
+	if *bridgeMode != "" {
+		runCeremony = func(ctx context.Context, transport *ctap2.HybridTransport) error {
+			return runBridge(ctx, transport, *bridgeMode)
+		}
+	} else if device, err := linking.NewFileStore(*linkStorePath).Load(); err != nil {
+		log.Printf("Linking: failed to load stored device, starting a fresh pairing: %v", err)
+	} else if device != nil && !device.Expired() {
+		log.Printf("Linking: found stored pairing for %q, skipping QR and reconnecting directly", device.Name)
+		runCeremony = func(ctx context.Context, transport *ctap2.HybridTransport) error {
+			return runLinkedReconnect(ctx, transport, device)
+		}
+	} else if device != nil {
+		log.Printf("Linking: stored pairing for %q has expired, starting a fresh pairing", device.Name)
+	}
+
+	if err := runCeremony(ctx, transport); err != nil {
 		if err == context.DeadlineExceeded {
 			log.Printf("Operation timed out after %v", *timeout)
 			return
@@ -95,152 +159,146 @@ func runHybridTransport(ctx context.Context, transport *ctap2.HybridTransport) e
 	if err := qrcode.DisplayQR(qrData); err != nil {
 		return fmt.Errorf("failed to display QR code: %w", err)
 	}
+	transport.Events.Emit(events.Event{Stage: events.StageQRGenerated})
 
-	// Step 2: Create BLE scanner 
-	bleScanner, err := ble.NewScanner(qrData.QRSecret)
+	// Step 2: Run the hybrid transport ceremony: wait for the phone's BLE
+	// advertisement, establish the tunnel, and service CTAP2 commands until
+	// a credential is created.
+	authenticator, err := ctap2.NewAuthenticator(transport.Backend, transport.OutputFile, transport.TPMDevice)
 	if err != nil {
-		return fmt.Errorf("failed to create BLE scanner: %w", err)
+		return fmt.Errorf("failed to initialize authenticator: %w", err)
 	}
+	client := ctap2.NewHybridClient(qrData.QRSecret, qrData.PrivateKey, qrData.PublicKey, authenticator)
+	client.Events = transport.Events
 
-	// Step 3: Wait for BLE advertisement from smartphone
 	log.Println("Waiting for smartphone to advertise after QR scan...")
-	
-	// Check if context is already cancelled before starting scan
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
-	}
-	
-	// Wait for BLE advertisement with tunnel service information
-	tunnelInfo, err := bleScanner.WaitForTunnelAdvertisement(ctx)
+	attestationData, err := client.Authenticate(ctx)
 	if err != nil {
-		if err == context.DeadlineExceeded {
-			log.Printf("Timeout waiting for BLE advertisement")
-			return err
-		} else if err == context.Canceled {
-			log.Printf("BLE scan cancelled")
-			return err
-		}
-		return fmt.Errorf("failed to receive tunnel advertisement: %w", err)
+		return fmt.Errorf("hybrid transport ceremony failed: %w", err)
+	}
+
+	persistLinkedDevice(transport.LinkStorePath, qrData.PrivateKey, qrData.PublicKey, client.LinkingInfo(), client.TunnelURL())
+
+	log.Printf("Credential created, saving attestation to %s", transport.OutputFile)
+	if err := attestation.SaveToFile(attestationData, transport.OutputFile); err != nil {
+		return fmt.Errorf("failed to save attestation: %w", err)
 	}
-	
-	log.Printf("Received tunnel service information:")
-	log.Printf("  Tunnel URL: %s", tunnelInfo.TunnelURL)
-	log.Printf("  Connection Nonce: %x", tunnelInfo.ConnectionNonce)
-	log.Printf("  Routing ID: %x", tunnelInfo.RoutingID)
-	log.Printf("  Tunnel Service ID: %x", tunnelInfo.TunnelServiceID)
-	log.Printf("  Encoded Tunnel Domain: %d", tunnelInfo.EncodedTunnelDomain)
-	log.Printf("  Additional Data: %x", tunnelInfo.AdditionalData)
-	
-	// Step 4: Setup tunnel service with information from BLE advertisement
-	tunnelClient, err := tunnel.NewClient(tunnelInfo.TunnelURL, qrData.PrivateKey, qrData.PublicKey, qrData.QRSecret)
+
+	return nil
+}
+
+// runLinkedReconnect skips the QR/BLE pairing ceremony entirely and
+// reconnects directly to a previously-linked phone using its persisted
+// contact ID and pairing secret (ctap2.HybridClient.Reconnect), then
+// services CTAP2 commands exactly like runHybridTransport until a
+// credential is created.
+func runLinkedReconnect(ctx context.Context, transport *ctap2.HybridTransport, device *linking.LinkedDevice) error {
+	authenticator, err := ctap2.NewAuthenticator(transport.Backend, transport.OutputFile, transport.TPMDevice)
 	if err != nil {
-		return fmt.Errorf("failed to create tunnel client: %w", err)
+		return fmt.Errorf("failed to initialize authenticator: %w", err)
 	}
-	
-	// Update tunnel client with advertisement information  
-	// Note: ConnectionNonce is the 10-byte nonce from BLE, but SetTunnelInfo expects tunnelID
-	// For caBLE v2, we use the ConnectionNonce as tunnel identifier
-	tunnelClient.SetTunnelInfo(tunnelInfo.RoutingID, tunnelInfo.ConnectionNonce)
-	
-	log.Printf("Tunnel service information received, attempting connection...")
-	
-	// Step 5: Establish tunnel connection
-	log.Printf("Connecting to tunnel service...")
-	conn, err := tunnelClient.WaitForConnection(ctx)
+	client := ctap2.NewHybridClientForReconnect(device.PrivateKey, device.PublicKey, authenticator)
+	client.Events = transport.Events
+
+	attestationData, err := client.Reconnect(ctx, device.TunnelURL, device.ContactID, device.ToLinkingInfo())
 	if err != nil {
-		return fmt.Errorf("failed to connect to tunnel service: %w", err)
+		return fmt.Errorf("linked reconnect failed: %w", err)
 	}
-	defer conn.Close()
-	
-	log.Printf("Tunnel connection established successfully")
-	
-	// Step 6: Listen for incoming messages from smartphone
-	log.Printf("Listening for messages from smartphone...")
-	for {
-		select {
-		case <-ctx.Done():
-			log.Printf("Context cancelled, stopping message listener")
-			return ctx.Err()
-		default:
-			// Read message with timeout
-			message, err := conn.ReadMessage()
-			if err != nil {
-				log.Printf("Error reading message: %v", err)
-				// Continue listening for more messages
-				continue
-			}
-			
-			// Log received data
-			log.Printf("=== RECEIVED MESSAGE FROM SMARTPHONE ===")
-			log.Printf("Message length: %d bytes", len(message))
-			log.Printf("Message (hex): %x", message)
-			log.Printf("Message (raw): %v", message)
-			
-			// Try to parse as string if printable
-			if isPrintableASCII(message) {
-				log.Printf("Message (string): %s", string(message))
-			}
-			
-			log.Printf("======================================")
-			
-			// Parse and process as CTAP2 message
-			if err := processCTAP2Message(conn, message); err != nil {
-				log.Printf("Error processing CTAP2 message: %v", err)
-			}
-		}
+
+	persistLinkedDevice(transport.LinkStorePath, device.PrivateKey, device.PublicKey, client.LinkingInfo(), client.TunnelURL())
+
+	log.Printf("Credential created, saving attestation to %s", transport.OutputFile)
+	if err := attestation.SaveToFile(attestationData, transport.OutputFile); err != nil {
+		return fmt.Errorf("failed to save attestation: %w", err)
 	}
+
 	return nil
 }
 
-// isPrintableASCII checks if a byte slice contains only printable ASCII characters
-func isPrintableASCII(data []byte) bool {
-	for _, b := range data {
-		if b < 32 || b > 126 {
-			return false
-		}
+// persistLinkedDevice saves linkingInfo (the phone's mandatory
+// post-handshake message from the ceremony that just completed) to
+// storePath alongside the desktop identity keypair used for that
+// handshake, so the next run can reconnect via runLinkedReconnect instead
+// of repeating the QR/BLE ceremony. linkingInfo is nil only if the
+// ceremony never got as far as a completed handshake, in which case
+// there's nothing new to persist.
+func persistLinkedDevice(storePath string, privateKey, publicKey []byte, linkingInfo *tunnel.LinkingInfo, tunnelURL string) {
+	if linkingInfo == nil {
+		return
+	}
+	device := linking.FromLinkingInfo(linkingInfo, privateKey, publicKey, tunnelURL)
+	if err := linking.NewFileStore(storePath).Save(device); err != nil {
+		log.Printf("Linking: failed to persist linked-device state: %v", err)
 	}
-	return len(data) > 0
 }
 
-// processCTAP2Message processes a received message as CTAP2 protocol
-func processCTAP2Message(conn *tunnel.Connection, rawMessage []byte) error {
-	log.Printf("Processing message as CTAP2 protocol...")
-	
-	// Parse the message
-	ctap2Message, err := ctap2.ParseCTAP2Message(rawMessage)
+// runBridge runs the QR pairing ceremony like runHybridTransport, but
+// instead of servicing CTAP2 commands locally until one credential is
+// created, it opens a tunnel.Tunnel to the paired phone and exposes it as
+// a local virtual authenticator device via pkg/bridge until ctx is
+// cancelled - so the phone can keep answering WebAuthn requests from the
+// host OS without repeating the QR scan each time.
+//
+// Partial implementation: bridge.NewHostTransport has no native backend
+// for any --bridge mode in this build (see pkg/bridge/host_unsupported.go),
+// so runBridge pairs with the phone and opens the tunnel, then fails as
+// soon as Serve calls host.Start. Only the tunnel-side multiplexing (pkg/bridge.Bridge) is
+// implemented; a working local device still needs a platform CCID/PC-SC
+// or USB/IP HID driver vendored into this build.
+func runBridge(ctx context.Context, transport *ctap2.HybridTransport, mode string) error {
+	host, err := bridge.NewHostTransport(mode)
 	if err != nil {
-		log.Printf("Failed to parse CTAP2 message: %v", err)
-		return fmt.Errorf("CTAP2 parsing failed: %w", err)
+		return err
 	}
-	
-	// Create CTAP2 handler
-	handler := ctap2.NewHandler(conn, "attestation.json")
-	
-	// Process the message and generate response
-	response, err := handler.ProcessCTAP2Message(ctap2Message)
+
+	qrData, err := qrcode.GenerateQRData()
 	if err != nil {
-		log.Printf("Failed to process CTAP2 message: %v", err)
-		return fmt.Errorf("CTAP2 processing failed: %w", err)
+		return fmt.Errorf("failed to generate QR data: %w", err)
 	}
-	
-	// Send response back to smartphone
-	if len(response) > 0 {
-		log.Printf("Sending CTAP2 response (%d bytes): %x", len(response), response)
-		
-		err = conn.WriteMessage(response)
-		if err != nil {
-			log.Printf("Failed to send CTAP2 response: %v", err)
-			return fmt.Errorf("failed to send response: %w", err)
-		}
-		
-		log.Printf("CTAP2 response sent successfully")
-	} else {
-		log.Printf("No response data to send")
+
+	if err := qrcode.DisplayQR(qrData); err != nil {
+		return fmt.Errorf("failed to display QR code: %w", err)
+	}
+	transport.Events.Emit(events.Event{Stage: events.StageQRGenerated})
+
+	scanner, err := ble.NewScanner(qrData.QRSecret)
+	if err != nil {
+		return fmt.Errorf("failed to create BLE scanner: %w", err)
+	}
+
+	log.Println("Waiting for smartphone to advertise after QR scan...")
+	start := time.Now()
+	info, err := scanner.WaitForTunnelAdvertisement(ctx)
+	if err != nil {
+		transport.Events.Emit(events.Event{Stage: events.StageError, Class: "ble", Err: err.Error()})
+		return fmt.Errorf("failed to receive tunnel advertisement: %w", err)
+	}
+	transport.Events.Emit(events.Event{Stage: events.StageBLEAdvReceived, DurationMS: float64(time.Since(start).Microseconds()) / 1000})
+
+	t, err := tunnel.OpenTunnel(ctx, info, qrData.PrivateKey, qrData.PublicKey, qrData.QRSecret)
+	if err != nil {
+		transport.Events.Emit(events.Event{Stage: events.StageError, Class: "tunnel", Err: err.Error()})
+		return fmt.Errorf("failed to open tunnel: %w", err)
+	}
+	defer t.Close()
+	transport.Events.Emit(events.Event{Stage: events.StageTunnelConnected})
+
+	log.Printf("Bridge: tunnel established, exposing phone authenticator via %q bridge mode", mode)
+	b := bridge.NewBridge(t)
+	return b.Serve(ctx, host, bridge.NFCCTAPCodec{})
+}
+
+// serveMetrics runs an HTTP server exposing m at addr under /metrics in
+// Prometheus text exposition format, until the process exits. Errors are
+// logged rather than fatal, since losing the metrics endpoint shouldn't
+// abort an in-flight ceremony.
+func serveMetrics(addr string, m *events.Metrics) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	log.Printf("Serving Prometheus metrics on %s/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Metrics server failed: %v", err)
 	}
-	
-	return nil
 }
 
 // Global log file handle for proper cleanup
@@ -277,4 +335,4 @@ func setupLogFile() error {
 
 	fmt.Printf("Log file created: %s\n", logFile)
 	return nil
-}
\ No newline at end of file
+}
@@ -1,3 +1,6 @@
+// Package attestation builds and persists WebAuthn/CTAP2 attestation data:
+// authenticatorData construction, attestation statement formats (packed,
+// none, fido-u2f), and the signing key that backs them.
 package attestation
 
 import (
@@ -5,12 +8,20 @@ import (
 	"fmt"
 	"log"
 	"os"
-
-	"ctap2-hybrid-transport/pkg/ctap2"
+	"time"
 )
 
+// AttestationData is the result of a successful authenticatorMakeCredential
+// ceremony, in the shape persisted to the output file.
+type AttestationData struct {
+	RequestID         []byte                 `json:"request_id"`
+	Timestamp         time.Time              `json:"timestamp"`
+	AttestationObject map[string]interface{} `json:"attestation_object"`
+	ClientDataJSON    []byte                 `json:"client_data_json"`
+}
+
 // SaveToFile saves attestation data to a JSON file
-func SaveToFile(attestationData *ctap2.AttestationData, filename string) error {
+func SaveToFile(attestationData *AttestationData, filename string) error {
 	log.Printf("Saving attestation data to: %s", filename)
 
 	// Convert to JSON
@@ -29,7 +40,7 @@ func SaveToFile(attestationData *ctap2.AttestationData, filename string) error {
 }
 
 // LoadFromFile loads attestation data from a JSON file
-func LoadFromFile(filename string) (*ctap2.AttestationData, error) {
+func LoadFromFile(filename string) (*AttestationData, error) {
 	log.Printf("Loading attestation data from: %s", filename)
 
 	// Read file
@@ -39,7 +50,7 @@ func LoadFromFile(filename string) (*ctap2.AttestationData, error) {
 	}
 
 	// Parse JSON
-	var attestationData ctap2.AttestationData
+	var attestationData AttestationData
 	if err := json.Unmarshal(jsonData, &attestationData); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal attestation data: %w", err)
 	}
@@ -49,7 +60,7 @@ func LoadFromFile(filename string) (*ctap2.AttestationData, error) {
 }
 
 // ValidateAttestationData validates the attestation data
-func ValidateAttestationData(attestationData *ctap2.AttestationData) error {
+func ValidateAttestationData(attestationData *AttestationData) error {
 	if len(attestationData.RequestID) == 0 {
 		return fmt.Errorf("request ID cannot be empty")
 	}
@@ -67,4 +78,4 @@ func ValidateAttestationData(attestationData *ctap2.AttestationData) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
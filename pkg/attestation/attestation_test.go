@@ -0,0 +1,198 @@
+package attestation
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// TestBuildAuthDataAndAttestedCredentialData checks that authenticatorData
+// is laid out per WebAuthn ยง6.1 and that the embedded COSE_Key round-trips.
+func TestBuildAuthDataAndAttestedCredentialData(t *testing.T) {
+	credKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+
+	var aaguid [16]byte
+	credentialID := bytes.Repeat([]byte{0x42}, 16)
+
+	attestedCredData, err := AttestedCredentialData(aaguid, credentialID, &credKey.PublicKey)
+	if err != nil {
+		t.Fatalf("AttestedCredentialData() failed: %v", err)
+	}
+
+	authData := BuildAuthData("example.com", FlagUserPresent|FlagAttestedCredentials, 1, attestedCredData)
+
+	wantRPIDHash := sha256.Sum256([]byte("example.com"))
+	if !bytes.Equal(authData[:32], wantRPIDHash[:]) {
+		t.Errorf("rpIdHash = %x, want %x", authData[:32], wantRPIDHash)
+	}
+	if authData[32] != FlagUserPresent|FlagAttestedCredentials {
+		t.Errorf("flags = %#x, want %#x", authData[32], FlagUserPresent|FlagAttestedCredentials)
+	}
+	if authData[33] != 0 || authData[34] != 0 || authData[35] != 0 || authData[36] != 1 {
+		t.Errorf("signCount bytes = %x, want 00000001", authData[33:37])
+	}
+
+	rest := authData[37:]
+	if !bytes.Equal(rest[:16], aaguid[:]) {
+		t.Errorf("aaguid = %x, want zero", rest[:16])
+	}
+	credIDLen := int(rest[16])<<8 | int(rest[17])
+	if credIDLen != len(credentialID) {
+		t.Fatalf("credIDLen = %d, want %d", credIDLen, len(credentialID))
+	}
+	gotCredID := rest[18 : 18+credIDLen]
+	if !bytes.Equal(gotCredID, credentialID) {
+		t.Errorf("credentialID = %x, want %x", gotCredID, credentialID)
+	}
+
+	var coseKey cosePublicKey
+	if err := cbor.Unmarshal(rest[18+credIDLen:], &coseKey); err != nil {
+		t.Fatalf("failed to decode embedded COSE_Key: %v", err)
+	}
+	if coseKey.Kty != coseKtyEC2 || coseKey.Alg != coseAlgES256 || coseKey.Crv != coseCrvP256 {
+		t.Errorf("COSE_Key = %+v, want kty=EC2 alg=ES256 crv=P-256", coseKey)
+	}
+	if !bytes.Equal(coseKey.X, credKey.PublicKey.X.FillBytes(make([]byte, 32))) {
+		t.Errorf("COSE_Key.X does not match the credential's public key")
+	}
+}
+
+// TestPackedSelfAttestation verifies the attStmt signature verifies against
+// the credential's own public key and carries no x5c chain.
+func TestPackedSelfAttestation(t *testing.T) {
+	credKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+
+	authData := []byte("fake-auth-data")
+	clientDataHash := bytes.Repeat([]byte{0x01}, 32)
+
+	stmt, err := PackedSelfAttestation(credKey, authData, clientDataHash)
+	if err != nil {
+		t.Fatalf("PackedSelfAttestation() failed: %v", err)
+	}
+	if _, hasX5C := stmt["x5c"]; hasX5C {
+		t.Error("self attestation must not include an x5c chain")
+	}
+	if stmt["alg"] != int64(coseAlgES256) {
+		t.Errorf("alg = %v, want %d", stmt["alg"], coseAlgES256)
+	}
+
+	sig, ok := stmt["sig"].([]byte)
+	if !ok {
+		t.Fatalf("sig has type %T, want []byte", stmt["sig"])
+	}
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+	if !ecdsa.VerifyASN1(&credKey.PublicKey, digest[:], sig) {
+		t.Error("self attestation signature does not verify against the credential's public key")
+	}
+}
+
+// TestNoneAttestation checks the "none" format returns an empty attStmt.
+func TestNoneAttestation(t *testing.T) {
+	stmt := NoneAttestation()
+	if len(stmt) != 0 {
+		t.Errorf("NoneAttestation() = %v, want empty map", stmt)
+	}
+}
+
+// TestECDSASignerPersistsAcrossInstances verifies the signing key is
+// generated once and then reloaded from disk, rather than regenerated.
+func TestECDSASignerPersistsAcrossInstances(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "attestation.json")
+
+	first, err := NewECDSASigner(outputFile)
+	if err != nil {
+		t.Fatalf("NewECDSASigner() failed: %v", err)
+	}
+	second, err := NewECDSASigner(outputFile)
+	if err != nil {
+		t.Fatalf("NewECDSASigner() (reload) failed: %v", err)
+	}
+
+	if first.Public().X.Cmp(second.Public().X) != 0 || first.Public().Y.Cmp(second.Public().Y) != 0 {
+		t.Error("signer public key changed across instances sharing the same output file")
+	}
+}
+
+// TestPackedBasicAttestationAndFIDOU2F exercises the full (basic) attestation
+// path: the signature must verify against the leaf certificate's own public
+// key, and that certificate must parse as a valid X.509 cert.
+func TestPackedBasicAttestationAndFIDOU2F(t *testing.T) {
+	signer, err := NewECDSASigner(filepath.Join(t.TempDir(), "attestation.json"))
+	if err != nil {
+		t.Fatalf("NewECDSASigner() failed: %v", err)
+	}
+
+	credKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+
+	authData := []byte("fake-auth-data")
+	clientDataHash := bytes.Repeat([]byte{0x02}, 32)
+
+	t.Run("packed-basic", func(t *testing.T) {
+		stmt, err := PackedBasicAttestation(signer, authData, clientDataHash)
+		if err != nil {
+			t.Fatalf("PackedBasicAttestation() failed: %v", err)
+		}
+		cert := parseLeafCert(t, stmt["x5c"])
+
+		digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+		verifyECDSASignature(t, cert, digest[:], stmt["sig"].([]byte))
+	})
+
+	t.Run("fido-u2f", func(t *testing.T) {
+		credentialID := bytes.Repeat([]byte{0x03}, 16)
+		stmt, err := FIDOU2FAttestation(signer, "example.com", clientDataHash, credentialID, &credKey.PublicKey)
+		if err != nil {
+			t.Fatalf("FIDOU2FAttestation() failed: %v", err)
+		}
+		cert := parseLeafCert(t, stmt["x5c"])
+
+		rpIDHash := sha256.Sum256([]byte("example.com"))
+		signedData := append([]byte{0x00}, rpIDHash[:]...)
+		signedData = append(signedData, clientDataHash...)
+		signedData = append(signedData, credentialID...)
+		signedData = append(signedData, uncompressedPoint(&credKey.PublicKey)...)
+		digest := sha256.Sum256(signedData)
+
+		verifyECDSASignature(t, cert, digest[:], stmt["sig"].([]byte))
+	})
+}
+
+func parseLeafCert(t *testing.T, x5c interface{}) *x509.Certificate {
+	t.Helper()
+	chain, ok := x5c.([][]byte)
+	if !ok || len(chain) != 1 {
+		t.Fatalf("x5c has type %T, want a single-entry [][]byte chain", x5c)
+	}
+	cert, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		t.Fatalf("failed to parse attestation certificate: %v", err)
+	}
+	return cert
+}
+
+func verifyECDSASignature(t *testing.T, cert *x509.Certificate, digest, sig []byte) {
+	t.Helper()
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		t.Fatalf("certificate public key has type %T, want *ecdsa.PublicKey", cert.PublicKey)
+	}
+	if !ecdsa.VerifyASN1(pub, digest, sig) {
+		t.Error("attestation signature does not verify against the certificate's public key")
+	}
+}
@@ -0,0 +1,95 @@
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// authenticatorData flags (WebAuthn ยง6.1).
+const (
+	FlagUserPresent         byte = 1 << 0
+	FlagUserVerified        byte = 1 << 2
+	FlagAttestedCredentials byte = 1 << 6
+	FlagExtensionData       byte = 1 << 7
+)
+
+// ctap2EncMode is the canonical CTAP2 CBOR encoding mode used for COSE_Key
+// encoding within authenticatorData, matching pkg/ctap2's wire format.
+var ctap2EncMode = func() cbor.EncMode {
+	em, err := cbor.CTAP2EncOptions().EncMode()
+	if err != nil {
+		panic("attestation: failed to build CBOR encode mode: " + err.Error())
+	}
+	return em
+}()
+
+// COSE_Key labels for an EC2 (P-256) public key (RFC 9053).
+type cosePublicKey struct {
+	Kty int64  `cbor:"1,keyasint"`
+	Alg int64  `cbor:"3,keyasint"`
+	Crv int64  `cbor:"-1,keyasint"`
+	X   []byte `cbor:"-2,keyasint"`
+	Y   []byte `cbor:"-3,keyasint"`
+}
+
+const (
+	coseKtyEC2   = 2
+	coseAlgES256 = -7
+	coseCrvP256  = 1
+)
+
+// EncodeCOSEPublicKey encodes an ECDSA P-256 public key as a CTAP2-canonical
+// COSE_Key CBOR map.
+func EncodeCOSEPublicKey(pub *ecdsa.PublicKey) ([]byte, error) {
+	if pub.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("unsupported curve: only P-256 is supported")
+	}
+	key := cosePublicKey{
+		Kty: coseKtyEC2,
+		Alg: coseAlgES256,
+		Crv: coseCrvP256,
+		X:   pub.X.FillBytes(make([]byte, 32)),
+		Y:   pub.Y.FillBytes(make([]byte, 32)),
+	}
+	return ctap2EncMode.Marshal(key)
+}
+
+// AttestedCredentialData builds the attestedCredentialData section of
+// authenticatorData: aaguid || credentialIdLength (uint16 BE) ||
+// credentialId || credentialPublicKey (COSE_Key CBOR).
+func AttestedCredentialData(aaguid [16]byte, credentialID []byte, pub *ecdsa.PublicKey) ([]byte, error) {
+	coseKey, err := EncodeCOSEPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode COSE public key: %w", err)
+	}
+	if len(credentialID) > 0xFFFF {
+		return nil, fmt.Errorf("credential ID too long: %d bytes", len(credentialID))
+	}
+
+	out := make([]byte, 0, 16+2+len(credentialID)+len(coseKey))
+	out = append(out, aaguid[:]...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(credentialID)))
+	out = append(out, credentialID...)
+	out = append(out, coseKey...)
+	return out, nil
+}
+
+// BuildAuthData assembles authenticatorData (WebAuthn ยง6.1):
+// rpIdHash (32) || flags (1) || signCount (4, BE) || attestedCredentialData.
+// attestedCredentialData must be nil unless flags has FlagAttestedCredentials
+// set (i.e. this is a MakeCredential response, not a GetAssertion one).
+func BuildAuthData(rpID string, flags byte, signCount uint32, attestedCredentialData []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	out := make([]byte, 0, 32+1+4+len(attestedCredentialData))
+	out = append(out, rpIDHash[:]...)
+	out = append(out, flags)
+	out = binary.BigEndian.AppendUint32(out, signCount)
+	out = append(out, attestedCredentialData...)
+	return out
+}
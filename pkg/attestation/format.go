@@ -0,0 +1,88 @@
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+)
+
+// NoneAttestation returns the attStmt for the "none" format: an empty map,
+// per the WebAuthn spec.
+func NoneAttestation() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+// PackedSelfAttestation builds a "packed" attStmt using self attestation: the
+// signature is produced by the credential's own private key, so no x5c chain
+// is included.
+func PackedSelfAttestation(credKey *ecdsa.PrivateKey, authData, clientDataHash []byte) (map[string]interface{}, error) {
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+	sig, err := ecdsa.SignASN1(rand.Reader, credKey, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to produce packed self attestation signature: %w", err)
+	}
+	return map[string]interface{}{
+		"alg": int64(coseAlgES256),
+		"sig": sig,
+	}, nil
+}
+
+// PackedBasicAttestation builds a "packed" attStmt using full (basic)
+// attestation: the signature and x5c chain come from signer, a key distinct
+// from the credential's own key.
+func PackedBasicAttestation(signer Signer, authData, clientDataHash []byte) (map[string]interface{}, error) {
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+	sig, err := signer.Sign(digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to produce packed basic attestation signature: %w", err)
+	}
+	cert, err := signer.Certificate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain attestation certificate: %w", err)
+	}
+	return map[string]interface{}{
+		"alg": int64(coseAlgES256),
+		"sig": sig,
+		"x5c": [][]byte{cert},
+	}, nil
+}
+
+// FIDOU2FAttestation builds a "fido-u2f" attStmt. This format predates
+// WebAuthn's "packed" format and always uses basic (batch) attestation, so
+// it is signed by signer rather than the credential's own key.
+func FIDOU2FAttestation(signer Signer, rpID string, clientDataHash, credentialID []byte, credPub *ecdsa.PublicKey) (map[string]interface{}, error) {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	// U2F registration response signed data: 0x00 || application ||
+	// challenge || keyHandle || user public key (uncompressed point).
+	signedData := make([]byte, 0, 1+32+32+len(credentialID)+65)
+	signedData = append(signedData, 0x00)
+	signedData = append(signedData, rpIDHash[:]...)
+	signedData = append(signedData, clientDataHash...)
+	signedData = append(signedData, credentialID...)
+	signedData = append(signedData, uncompressedPoint(credPub)...)
+
+	digest := sha256.Sum256(signedData)
+	sig, err := signer.Sign(digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to produce fido-u2f attestation signature: %w", err)
+	}
+	cert, err := signer.Certificate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain attestation certificate: %w", err)
+	}
+	return map[string]interface{}{
+		"sig": sig,
+		"x5c": [][]byte{cert},
+	}, nil
+}
+
+// uncompressedPoint encodes pub in SEC1 uncompressed point form: 0x04 || X || Y.
+func uncompressedPoint(pub *ecdsa.PublicKey) []byte {
+	out := make([]byte, 0, 65)
+	out = append(out, 0x04)
+	out = append(out, pub.X.FillBytes(make([]byte, 32))...)
+	out = append(out, pub.Y.FillBytes(make([]byte, 32))...)
+	return out
+}
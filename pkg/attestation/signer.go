@@ -0,0 +1,136 @@
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Signer produces attestation signatures and, where the attestation format
+// calls for one, an X.509 certificate chain rooted at the signer's own key.
+// The default implementation is an in-process ECDSA P-256 key; a
+// PKCS#11/Keychain-backed Signer can be substituted by implementing the same
+// interface.
+type Signer interface {
+	// Sign returns an ASN.1 DER ECDSA signature over digest.
+	Sign(digest []byte) ([]byte, error)
+	// Public returns the signer's P-256 public key.
+	Public() *ecdsa.PublicKey
+	// Certificate returns a self-signed X.509 certificate (DER-encoded) for
+	// the signer's public key, suitable as the sole entry in an attStmt's
+	// x5c chain for basic (non-self) attestation.
+	Certificate() ([]byte, error)
+}
+
+// signingKeyFileName is the name of the PEM file holding the persisted
+// attestation signing key, written alongside the authenticator's output file.
+const signingKeyFileName = "attestation-signing-key.pem"
+
+// ECDSASigner is the default Signer: an ECDSA P-256 key generated on first
+// use and persisted to disk so the same attestation identity is reused
+// across runs.
+type ECDSASigner struct {
+	mu   sync.Mutex
+	key  *ecdsa.PrivateKey
+	cert []byte // cached self-signed certificate, built lazily
+}
+
+// NewECDSASigner loads the attestation signing key from the directory
+// containing outputFile, generating and persisting a new P-256 key if none
+// exists yet.
+func NewECDSASigner(outputFile string) (*ECDSASigner, error) {
+	dir := filepath.Dir(outputFile)
+	if dir == "" {
+		dir = "."
+	}
+	keyPath := filepath.Join(dir, signingKeyFileName)
+
+	key, err := loadECDSAKey(keyPath)
+	if err == nil {
+		return &ECDSASigner{key: key}, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load attestation signing key: %w", err)
+	}
+
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate attestation signing key: %w", err)
+	}
+	if err := saveECDSAKey(keyPath, key); err != nil {
+		return nil, fmt.Errorf("failed to persist attestation signing key: %w", err)
+	}
+	return &ECDSASigner{key: key}, nil
+}
+
+func loadECDSAKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: not a PEM-encoded EC private key", path)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func saveECDSAKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	block := &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+}
+
+// Sign signs digest (a SHA-256 hash) with the persisted P-256 key.
+func (s *ECDSASigner) Sign(digest []byte) ([]byte, error) {
+	return ecdsa.SignASN1(rand.Reader, s.key, digest)
+}
+
+// Public returns the signer's P-256 public key.
+func (s *ECDSASigner) Public() *ecdsa.PublicKey {
+	return &s.key.PublicKey
+}
+
+// Certificate returns a self-signed certificate for the signer's key,
+// generating and caching it on first call.
+func (s *ECDSASigner) Certificate() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cert != nil {
+		return s.cert, nil
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "ctap2-hybrid-transport attestation"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, s.Public(), s.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create self-signed attestation certificate: %w", err)
+	}
+
+	s.cert = der
+	return s.cert, nil
+}
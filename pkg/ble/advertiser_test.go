@@ -0,0 +1,76 @@
+package ble
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestAdvertiserBuildServiceDataRoundTrip proves that the service data
+// Advertiser.buildServiceData encrypts decrypts back into the same routing
+// ID and tunnel service ID via CableV2Decryptor/ParseDecryptedServiceData -
+// the same parsing path Scanner.WaitForTunnelAdvertisement uses on the
+// receiving side. Constructed directly rather than via NewAdvertiser, since
+// that requires a real Bluetooth adapter.
+func TestAdvertiserBuildServiceDataRoundTrip(t *testing.T) {
+	qrSecret := bytes.Repeat([]byte{0x42}, 32)
+	routingID := []byte{0x11, 0x22, 0x33}
+	tunnelServiceID := []byte{0x00, 0x01}
+
+	a := &Advertiser{
+		qrSecret:        qrSecret,
+		routingID:       routingID,
+		tunnelServiceID: tunnelServiceID,
+	}
+
+	advert, err := a.buildServiceData()
+	if err != nil {
+		t.Fatalf("buildServiceData failed: %v", err)
+	}
+	if len(advert) != CableV2AdvertLength {
+		t.Fatalf("advert length = %d, want %d", len(advert), CableV2AdvertLength)
+	}
+
+	decryptor := NewCableV2Decryptor(qrSecret[:16])
+	plaintext, err := decryptor.DecryptServiceData(advert)
+	if err != nil {
+		t.Fatalf("DecryptServiceData failed: %v", err)
+	}
+
+	_, decodedRoutingID, decodedTunnelService, _, err := ParseDecryptedServiceData(plaintext)
+	if err != nil {
+		t.Fatalf("ParseDecryptedServiceData failed: %v", err)
+	}
+
+	if !bytes.Equal(decodedRoutingID, routingID) {
+		t.Errorf("routing ID = %x, want %x", decodedRoutingID, routingID)
+	}
+	if !bytes.Equal(decodedTunnelService, tunnelServiceID) {
+		t.Errorf("tunnel service ID = %x, want %x", decodedTunnelService, tunnelServiceID)
+	}
+}
+
+// TestAdvertiserBuildServiceDataRotatesNonce checks that each call to
+// buildServiceData draws a fresh random connection nonce, since Start's
+// rotation goroutine relies on successive calls producing different
+// advertisements even when routingID/tunnelServiceID stay fixed.
+func TestAdvertiserBuildServiceDataRotatesNonce(t *testing.T) {
+	qrSecret := bytes.Repeat([]byte{0x7a}, 32)
+	a := &Advertiser{
+		qrSecret:        qrSecret,
+		routingID:       []byte{0xaa, 0xbb, 0xcc},
+		tunnelServiceID: []byte{0x00, 0x00},
+	}
+
+	first, err := a.buildServiceData()
+	if err != nil {
+		t.Fatalf("buildServiceData failed: %v", err)
+	}
+	second, err := a.buildServiceData()
+	if err != nil {
+		t.Fatalf("buildServiceData failed: %v", err)
+	}
+
+	if bytes.Equal(first, second) {
+		t.Errorf("two successive advertisements were identical, want different nonces: %x", first)
+	}
+}
@@ -0,0 +1,173 @@
+package ble
+
+import "testing"
+
+// TestAppleContinuityCableCandidate is table-driven over a handful of
+// Apple Continuity TLV layouts, checking that a caBLE v2-sized payload
+// inside a Nearby Info or Proximity Pairing sub-structure is found, and
+// that unrelated or too-short sub-structures are ignored.
+func TestAppleContinuityCableCandidate(t *testing.T) {
+	cableSized := make([]byte, CableV2AdvertLength)
+	for i := range cableSized {
+		cableSized[i] = byte(i)
+	}
+
+	tlv := func(typ byte, payload []byte) []byte {
+		return append([]byte{typ, byte(len(payload))}, payload...)
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantFound bool
+	}{
+		{
+			name:      "Nearby Info carrying a caBLE-sized payload",
+			data:      tlv(appleContinuityTypeNearbyInfo, cableSized),
+			wantFound: true,
+		},
+		{
+			name:      "Proximity Pairing carrying a caBLE-sized payload",
+			data:      tlv(appleContinuityTypeProximityPairing, cableSized),
+			wantFound: true,
+		},
+		{
+			name:      "unrelated Continuity type is ignored",
+			data:      tlv(0x05, cableSized),
+			wantFound: false,
+		},
+		{
+			name:      "Nearby Info payload too short for caBLE v2",
+			data:      tlv(appleContinuityTypeNearbyInfo, cableSized[:10]),
+			wantFound: false,
+		},
+		{
+			name:      "preceding unrelated TLV is skipped to find the real one",
+			data:      append(tlv(0x05, []byte{0x01, 0x02}), tlv(appleContinuityTypeNearbyInfo, cableSized)...),
+			wantFound: true,
+		},
+		{
+			name:      "empty data",
+			data:      nil,
+			wantFound: false,
+		},
+		{
+			name:      "truncated length prefix",
+			data:      []byte{appleContinuityTypeNearbyInfo, 0xFF, 0x01},
+			wantFound: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := appleContinuityCableCandidate(tt.data)
+			if tt.wantFound && len(got) != CableV2AdvertLength {
+				t.Fatalf("appleContinuityCableCandidate() = %x, want a %d-byte candidate", got, CableV2AdvertLength)
+			}
+			if !tt.wantFound && got != nil {
+				t.Fatalf("appleContinuityCableCandidate() = %x, want nil", got)
+			}
+		})
+	}
+}
+
+// TestScannerTryAppleManufacturerDataDecryption builds a fixture caBLE v2
+// advertisement, wraps it in an Apple Continuity Nearby Info TLV as iOS
+// would, and checks that tryAppleManufacturerDataDecryption decrypts it
+// into a TunnelInfo matching what was encrypted.
+func TestScannerTryAppleManufacturerDataDecryption(t *testing.T) {
+	qrSecret := []byte("0123456789abcdef0123456789abcdef")[:32]
+	routingID := []byte{0x01, 0x02, 0x03}
+	tunnelServiceID := []byte{0x00, 0x00}
+
+	adv := &Advertiser{
+		qrSecret:        qrSecret,
+		routingID:       routingID,
+		tunnelServiceID: tunnelServiceID,
+	}
+	serviceData, err := adv.buildServiceData()
+	if err != nil {
+		t.Fatalf("buildServiceData failed: %v", err)
+	}
+
+	manufacturerData := append([]byte{appleContinuityTypeNearbyInfo, byte(len(serviceData))}, serviceData...)
+
+	scanner := &Scanner{qrSecret: qrSecret[:16], sink: NoopEventSink{}, domainResolver: defaultTunnelDomainResolver{}}
+	tunnelInfoChan := make(chan *TunnelInfo, 1)
+
+	if ok := scanner.tryAppleManufacturerDataDecryption(manufacturerData, tunnelInfoChan); !ok {
+		t.Fatalf("tryAppleManufacturerDataDecryption returned false, want true")
+	}
+
+	var info *TunnelInfo
+	select {
+	case info = <-tunnelInfoChan:
+	default:
+		t.Fatal("tryAppleManufacturerDataDecryption did not push a TunnelInfo onto the channel")
+	}
+
+	if string(info.RoutingID) != string(routingID) {
+		t.Errorf("RoutingID = %x, want %x", info.RoutingID, routingID)
+	}
+}
+
+// TestScannerTryAppleManufacturerDataDecryptionFromCapturedADStructure feeds
+// a full raw AD structure - [length][type 0xFF][company ID 0x4C 0x00]
+// followed by the Continuity TLV payload, the byte layout a raw HCI
+// advertising report actually carries before TinyGo Bluetooth splits it into
+// ManufacturerDataElement.CompanyID/Data - through the same company-ID-strip
+// step extractAppleManufacturerData performs, then through
+// tryAppleManufacturerDataDecryption, to check the whole path tolerates
+// vendor-captured dumps rather than only hand-built ManufacturerData slices.
+func TestScannerTryAppleManufacturerDataDecryptionFromCapturedADStructure(t *testing.T) {
+	qrSecret := []byte("0123456789abcdef0123456789abcdef")[:32]
+	routingID := []byte{0x0a, 0x0b, 0x0c}
+	tunnelServiceID := []byte{0x02, 0x00} // id 2 -> synthesized domain (past the assigned-domain table)
+
+	adv := &Advertiser{
+		qrSecret:        qrSecret,
+		routingID:       routingID,
+		tunnelServiceID: tunnelServiceID,
+	}
+	serviceData, err := adv.buildServiceData()
+	if err != nil {
+		t.Fatalf("buildServiceData failed: %v", err)
+	}
+
+	continuityTLV := append([]byte{appleContinuityTypeNearbyInfo, byte(len(serviceData))}, serviceData...)
+
+	// AD structure header as it appears on the wire: length covers
+	// everything after itself (type + company ID + TLV payload).
+	adLength := byte(1 + 2 + len(continuityTLV))
+	capturedAD := append([]byte{adLength, 0xFF, 0x4C, 0x00}, continuityTLV...)
+
+	// extractAppleManufacturerData relies on TinyGo Bluetooth to have
+	// already split the AD structure into company ID and data; mirror that
+	// split here rather than re-parsing the AD length/type bytes.
+	companyID := uint16(capturedAD[3])<<8 | uint16(capturedAD[2])
+	if companyID != appleCompanyID {
+		t.Fatalf("test fixture company ID = 0x%04x, want 0x%04x", companyID, appleCompanyID)
+	}
+	manufacturerData := capturedAD[4:]
+
+	scanner := &Scanner{qrSecret: qrSecret[:16], sink: NoopEventSink{}, domainResolver: defaultTunnelDomainResolver{}}
+	tunnelInfoChan := make(chan *TunnelInfo, 1)
+
+	if ok := scanner.tryAppleManufacturerDataDecryption(manufacturerData, tunnelInfoChan); !ok {
+		t.Fatalf("tryAppleManufacturerDataDecryption returned false, want true")
+	}
+
+	var info *TunnelInfo
+	select {
+	case info = <-tunnelInfoChan:
+	default:
+		t.Fatal("tryAppleManufacturerDataDecryption did not push a TunnelInfo onto the channel")
+	}
+
+	if string(info.RoutingID) != string(routingID) {
+		t.Errorf("RoutingID = %x, want %x", info.RoutingID, routingID)
+	}
+	if info.EncodedTunnelDomain != 2 {
+		t.Errorf("EncodedTunnelDomain = %d, want 2", info.EncodedTunnelDomain)
+	}
+}
@@ -2,65 +2,101 @@ package ble
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
-	"os"
-	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"tinygo.org/x/bluetooth"
+
+	"ctap2-hybrid-transport/pkg/qrcode"
 )
 
 // CTAP BLE constants based on official FIDO specification
 const (
 	// FIDO Service UUID (16-bit: 0xFFFD) - from CTAP specification
 	FIDOServiceUUID = "0000fffd-0000-1000-8000-00805f9b34fb"
-	
+
 	// For hybrid transport, we also need to scan for both UUIDs
 	// as implementations may vary
 	CableServiceUUID = "0000fff9-0000-1000-8000-00805f9b34fb" // Some implementations use this
-	
+
 	// CTAP BLE advertisement constants
 	ServiceDataMinLength = 3  // Minimum service data length (UUID + 1 flag byte)
 	CableV2AdvDataLength = 20 // Service data length for caBLE v2
 	CableV2NonceLength   = 8  // Nonce length in BLE advertisement
 	CableV2RoutingLength = 3  // Routing ID length
 	CableV2TunnelLength  = 2  // Tunnel service identifier length
-	
+
 	// Service Data Flag bits (from CTAP spec)
 	FlagPairingMode = 0x80 // Bit 7: Device is in pairing mode
 	FlagPasskeyReq  = 0x40 // Bit 6: Device requires passkey input
+
+	// tunnelDomainLabelLength is how many bytes of the domain-synthesis
+	// digest become the DNS label, mirroring pkg/tunnel's own synthesized
+	// domains.
+	tunnelDomainLabelLength = 8
 )
 
+// tunnelDomainEncoding is the unpadded standard (upper-case) base32
+// alphabet used to turn a synthesized tunnel domain's hash into a DNS
+// label; its output is lower-cased where the label is built.
+var tunnelDomainEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// DefaultEIDRotationInterval is how often Advertiser.Start rotates the
+// connection nonce in its advertised EID, unless overridden with
+// SetRotationInterval.
+const DefaultEIDRotationInterval = 10 * time.Second
+
 // TunnelInfo contains tunnel service information from BLE advertisement
 type TunnelInfo struct {
-	TunnelURL             string
-	ConnectionNonce       []byte  // 10-byte connection nonce (proves proximity)
-	RoutingID             []byte  // 3-byte routing ID
-	TunnelServiceID       []byte  // 2-byte tunnel service identifier
-	EncodedTunnelDomain   uint16  // Tunnel service domain (derived from service ID)
-	AdditionalData        []byte  // Additional data (if any)
+	TunnelURL           string
+	ConnectionNonce     []byte // 10-byte connection nonce (proves proximity)
+	RoutingID           []byte // 3-byte routing ID
+	TunnelServiceID     []byte // 2-byte tunnel service identifier
+	EncodedTunnelDomain uint16 // Tunnel service domain (derived from service ID)
+	AdditionalData      []byte // Additional data (if any)
 }
 
 // Advertiser handles BLE advertising for CTAP2 hybrid transport
 type Advertiser struct {
-	qrSecret []byte
-	running  bool
-	adapter  *bluetooth.Adapter
+	qrSecret        []byte
+	routingID       []byte // 3-byte routing ID this advertiser identifies itself with
+	tunnelServiceID []byte // 2-byte tunnel service identifier (little-endian encoded tunnel domain)
+	running         bool
+	adapter         *bluetooth.Adapter
+
+	rotationInterval time.Duration
+	adv              *bluetooth.Advertisement
 }
 
 // Scanner handles BLE scanning for CTAP2 hybrid transport
 type Scanner struct {
-	qrSecret        []byte
-	running         bool
-	adapter         *bluetooth.Adapter
-	checkedDevices  map[string]bool // Track devices we've already checked
-	deviceLogs      map[string]*os.File // Device-specific log files
-	logDir          string              // Log directory path
+	qrSecret       []byte
+	running        bool
+	adapter        *bluetooth.Adapter
+	checkedDevices map[string]bool      // Track devices we've already checked
+	sink           EventSink            // Where scan/GATT/decode events are emitted
+	domainResolver TunnelDomainResolver // Resolves a tunnel-server-domain ID into its hostname
+
+	// serviceDataSource reads service data directly from the OS Bluetooth
+	// stack (see servicedata.go and its platform-specific backends),
+	// working around gaps in TinyGo Bluetooth's advertisement parsing.
+	serviceDataSource platformServiceDataSource
+
+	nativeServiceDataMu sync.Mutex
+	nativeServiceData   map[string]map[string][]byte // deviceAddr -> (service UUID -> data)
 }
 
-// NewAdvertiser creates a new BLE advertiser
+// NewAdvertiser creates a new BLE advertiser, generating the routing ID it
+// will identify itself with over BLE and defaulting to the first assigned
+// tunnel server domain (see tunnel.DomainForEncodedTunnelServerDomain).
 func NewAdvertiser(qrSecret []byte) (*Advertiser, error) {
 	if len(qrSecret) != 32 {
 		return nil, fmt.Errorf("QR secret must be 32 bytes, got %d", len(qrSecret))
@@ -72,15 +108,97 @@ func NewAdvertiser(qrSecret []byte) (*Advertiser, error) {
 		return nil, fmt.Errorf("failed to enable bluetooth: %w", err)
 	}
 
+	routingID := make([]byte, CableV2RoutingLength)
+	if _, err := rand.Read(routingID); err != nil {
+		return nil, fmt.Errorf("failed to generate routing ID: %w", err)
+	}
+
 	return &Advertiser{
-		qrSecret: qrSecret,
-		running:  false,
-		adapter:  adapter,
+		qrSecret:         qrSecret,
+		routingID:        routingID,
+		tunnelServiceID:  make([]byte, CableV2TunnelLength), // index 0: the first assigned tunnel domain
+		running:          false,
+		adapter:          adapter,
+		rotationInterval: DefaultEIDRotationInterval,
 	}, nil
 }
 
-// NewScanner creates a new BLE scanner
+// SetRotationInterval overrides how often Start rotates the advertised
+// EID's connection nonce. Must be called before Start.
+func (a *Advertiser) SetRotationInterval(d time.Duration) {
+	a.rotationInterval = d
+}
+
+// buildServiceData derives the EID key from the advertiser's QR secret and
+// encrypts a fresh caBLE v2 service data payload: a zero flags byte, a new
+// random connection nonce, and this advertiser's routing ID and tunnel
+// service ID.
+func (a *Advertiser) buildServiceData() ([]byte, error) {
+	decryptor := NewCableV2Decryptor(a.qrSecret[:16])
+
+	var eidKey [CableV2EIDKeyLength]byte
+	if err := decryptor.derive(eidKey[:], decryptor.qrSecret, nil, keyPurposeEIDKey); err != nil {
+		return nil, fmt.Errorf("failed to derive EID key: %w", err)
+	}
+
+	var plaintext [CableV2PlaintextLength]byte // plaintext[0] (flags) stays zero
+	if _, err := rand.Read(plaintext[1:11]); err != nil {
+		return nil, fmt.Errorf("failed to generate connection nonce: %w", err)
+	}
+	copy(plaintext[11:14], a.routingID)
+	copy(plaintext[14:16], a.tunnelServiceID)
+
+	advert, err := decryptor.encryptServiceData(&eidKey, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt caBLE v2 service data: %w", err)
+	}
+	return advert[:], nil
+}
+
+// advertiseOnce (re)configures and starts a.adapter's default advertisement
+// with a freshly-encrypted caBLE v2 service data payload under serviceUUID.
+func (a *Advertiser) advertiseOnce(serviceUUID bluetooth.UUID) error {
+	serviceData, err := a.buildServiceData()
+	if err != nil {
+		return fmt.Errorf("failed to build caBLE v2 service data: %w", err)
+	}
+
+	adv := a.adapter.DefaultAdvertisement()
+	if err := adv.Configure(bluetooth.AdvertisementOptions{
+		AdvertisementType: bluetooth.AdvertisingTypeNonConnInd,
+		ServiceData:       []bluetooth.ServiceDataElement{{UUID: serviceUUID, Data: serviceData}},
+	}); err != nil {
+		return fmt.Errorf("failed to configure advertisement: %w", err)
+	}
+	if err := adv.Start(); err != nil {
+		return fmt.Errorf("failed to start advertisement: %w", err)
+	}
+
+	a.adv = adv
+	return nil
+}
+
+// ScannerOptions configures a new Scanner. Sink defaults to a
+// PerDeviceFileEventSink rooted at "log" when left nil, preserving
+// Scanner's historical per-device file logging.
+type ScannerOptions struct {
+	Sink EventSink
+
+	// DomainResolver overrides how Scanner turns a decrypted
+	// advertisement's EncodedTunnelDomain into a tunnel server hostname.
+	// Defaults to defaultTunnelDomainResolver{} when nil.
+	DomainResolver TunnelDomainResolver
+}
+
+// NewScanner creates a new BLE scanner, logging scan/GATT/decode events to
+// a PerDeviceFileEventSink rooted at "log". Use NewScannerWithOptions to
+// inject a different sink, e.g. NoopEventSink in tests.
 func NewScanner(qrSecret []byte) (*Scanner, error) {
+	return NewScannerWithOptions(qrSecret, ScannerOptions{})
+}
+
+// NewScannerWithOptions creates a new BLE scanner with explicit options.
+func NewScannerWithOptions(qrSecret []byte, opts ScannerOptions) (*Scanner, error) {
 	if len(qrSecret) != 16 {
 		return nil, fmt.Errorf("QR secret must be 16 bytes, got %d", len(qrSecret))
 	}
@@ -89,43 +207,135 @@ func NewScanner(qrSecret []byte) (*Scanner, error) {
 	adapter := bluetooth.DefaultAdapter
 	must("enable BLE stack", adapter.Enable())
 
-	// Create log directory
-	logDir := "log"
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	sink := opts.Sink
+	if sink == nil {
+		fileSink, err := NewPerDeviceFileEventSink("log")
+		if err != nil {
+			return nil, err
+		}
+		sink = fileSink
+	}
+
+	domainResolver := opts.DomainResolver
+	if domainResolver == nil {
+		domainResolver = defaultTunnelDomainResolver{}
 	}
 
 	return &Scanner{
-		qrSecret:       qrSecret,
-		running:        false,
-		adapter:        adapter,
-		checkedDevices: make(map[string]bool),
-		deviceLogs:     make(map[string]*os.File),
-		logDir:         logDir,
+		qrSecret:          qrSecret,
+		running:           false,
+		adapter:           adapter,
+		checkedDevices:    make(map[string]bool),
+		sink:              sink,
+		domainResolver:    domainResolver,
+		serviceDataSource: newPlatformServiceDataSource(),
+		nativeServiceData: make(map[string]map[string][]byte),
 	}, nil
 }
 
-// Start begins BLE advertising
+// NewScannerFromSession creates a new BLE scanner using the QR secret held
+// by a qrcode.Session, instead of requiring the caller to extract and pass
+// the raw secret themselves.
+func NewScannerFromSession(session *qrcode.Session) (*Scanner, error) {
+	return NewScanner(session.QRSecret())
+}
+
+// onNativeServiceData records service data reported by serviceDataSource,
+// keyed by device address, for processTunnelAdvertisement to consult ahead
+// of TinyGo Bluetooth's own (more limited) advertisement parsing.
+func (s *Scanner) onNativeServiceData(deviceAddr string, serviceData map[string][]byte) {
+	s.nativeServiceDataMu.Lock()
+	defer s.nativeServiceDataMu.Unlock()
+
+	existing, ok := s.nativeServiceData[deviceAddr]
+	if !ok {
+		existing = make(map[string][]byte, len(serviceData))
+		s.nativeServiceData[deviceAddr] = existing
+	}
+	for uuid, data := range serviceData {
+		existing[uuid] = data
+	}
+}
+
+// nativeServiceDataFor returns a copy of the native service-data entries
+// observed for deviceAddr, or nil if the platform backend hasn't reported
+// anything for it (including on platforms with no native backend at all).
+func (s *Scanner) nativeServiceDataFor(deviceAddr string) map[string][]byte {
+	s.nativeServiceDataMu.Lock()
+	defer s.nativeServiceDataMu.Unlock()
+
+	entries, ok := s.nativeServiceData[deviceAddr]
+	if !ok {
+		return nil
+	}
+	out := make(map[string][]byte, len(entries))
+	for uuid, data := range entries {
+		out[uuid] = data
+	}
+	return out
+}
+
+// Start begins BLE advertising a caBLE v2 service data payload under the
+// FIDO service UUID, rotating its connection nonce (and thus the advertised
+// EID ciphertext) every rotationInterval so the advertisement can't be used
+// to track this device across rotations.
 func (a *Advertiser) Start(ctx context.Context) error {
 	if a.running {
 		return fmt.Errorf("advertiser is already running")
 	}
 
+	fidoServiceUUID, err := bluetooth.ParseUUID(FIDOServiceUUID)
+	if err != nil {
+		return fmt.Errorf("failed to parse FIDO service UUID: %w", err)
+	}
+
+	if err := a.advertiseOnce(fidoServiceUUID); err != nil {
+		return err
+	}
+
 	a.running = true
-	log.Println("BLE advertising started (stub implementation)")
-	log.Printf("QR Secret: %x", a.qrSecret)
+	log.Printf("BLE advertising started (rotating EID every %s)", a.rotationInterval)
 
-	// TODO: Implement actual BLE advertising
-	// For now, just log that we're advertising
 	go func() {
-		<-ctx.Done()
-		a.running = false
-		log.Println("BLE advertising stopped")
+		ticker := time.NewTicker(a.rotationInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				a.Stop()
+				return
+			case <-ticker.C:
+				if err := a.adv.Stop(); err != nil {
+					log.Printf("Failed to stop advertisement before EID rotation: %v", err)
+					continue
+				}
+				if err := a.advertiseOnce(fidoServiceUUID); err != nil {
+					log.Printf("Failed to rotate caBLE v2 EID: %v", err)
+				}
+			}
+		}
 	}()
 
 	return nil
 }
 
+// Stop tears down the advertisement handle Start registered, if any.
+func (a *Advertiser) Stop() error {
+	if !a.running {
+		return nil
+	}
+
+	a.running = false
+	if a.adv != nil {
+		if err := a.adv.Stop(); err != nil {
+			return fmt.Errorf("failed to stop advertisement: %w", err)
+		}
+	}
+
+	log.Println("BLE advertising stopped")
+	return nil
+}
+
 // StartScanning begins BLE scanning for CTAP2 hybrid transport
 func (s *Scanner) StartScanning(ctx context.Context) error {
 	if s.running {
@@ -136,6 +346,14 @@ func (s *Scanner) StartScanning(ctx context.Context) error {
 	log.Println("BLE scanning started")
 	log.Printf("Scanning for FIDO service UUID: %s (CTAP spec)", FIDOServiceUUID)
 	log.Printf("Also scanning for caBLE service UUID: %s (hybrid transport)", CableServiceUUID)
+
+	if err := s.serviceDataSource.Start(ctx, s.onNativeServiceData); err != nil {
+		log.Printf("Native service-data backend unavailable, relying on TinyGo Bluetooth parsing: %v", err)
+	}
+	go func() {
+		<-ctx.Done()
+		s.serviceDataSource.Stop()
+	}()
 	log.Println("NOTE: After scanning the QR code with your phone, wait for the phone to start advertising...")
 	log.Println("Look for devices with strong signal (>-40 dBm) that might be your phone.")
 	log.Println("The phone should advertise with FIDO service UUID 0xFFFD according to CTAP specification.")
@@ -145,7 +363,7 @@ func (s *Scanner) StartScanning(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to parse FIDO service UUID: %w", err)
 	}
-	
+
 	cableServiceUUID, err := bluetooth.ParseUUID(CableServiceUUID)
 	if err != nil {
 		return fmt.Errorf("failed to parse caBLE service UUID: %w", err)
@@ -166,7 +384,7 @@ func (s *Scanner) StartScanning(ctx context.Context) error {
 				return
 			default:
 				log.Println("Starting BLE scan cycle...")
-				
+
 				err := s.adapter.Scan(func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
 					// Immediate context check at start of callback
 					select {
@@ -176,7 +394,7 @@ func (s *Scanner) StartScanning(ctx context.Context) error {
 					}
 					deviceAddr := result.Address.String()
 					localName := result.AdvertisementPayload.LocalName()
-					
+
 					// Log every BLE device found (console output)
 					log.Printf("BLE Device: %s (RSSI: %d dBm)", deviceAddr, result.RSSI)
 					if localName != "" {
@@ -184,13 +402,13 @@ func (s *Scanner) StartScanning(ctx context.Context) error {
 					} else {
 						log.Printf("  Local Name: (not available)")
 					}
-					
+
 					// Special logging for iPad device
-					if deviceAddr == "394c3434-49ab-2b33-5bb4-228481792d55" || 
-					   deviceAddr == "394C3434-49AB-2B33-5BB4-228481792D55" {
+					if deviceAddr == "394c3434-49ab-2b33-5bb4-228481792d55" ||
+						deviceAddr == "394C3434-49AB-2B33-5BB4-228481792D55" {
 						log.Printf("  *** This is the known iPad device ***")
 						log.Printf("  *** iPad detected in regular scan - will check for caBLE data ***")
-						
+
 						// Force iPad processing
 						go func() {
 							log.Printf("Processing iPad device for caBLE data...")
@@ -202,14 +420,14 @@ func (s *Scanner) StartScanning(ctx context.Context) error {
 							}
 						}()
 					}
-					
+
 					// Log detailed device information to device-specific log file
 					s.logDeviceInfo(deviceAddr, result.RSSI, localName, result.AdvertisementPayload)
-					
+
 					// Check if this advertisement contains either FIDO service UUID
 					fidoServiceFound := result.AdvertisementPayload.HasServiceUUID(fidoServiceUUID)
 					cableServiceFound := result.AdvertisementPayload.HasServiceUUID(cableServiceUUID)
-					
+
 					if fidoServiceFound || cableServiceFound {
 						log.Printf("*** FOUND FIDO/CTAP ADVERTISEMENT ***")
 						log.Printf("Device: %s", result.Address.String())
@@ -221,33 +439,33 @@ func (s *Scanner) StartScanning(ctx context.Context) error {
 							log.Printf("caBLE Service UUID found: %s", CableServiceUUID)
 						}
 						log.Printf("Local Name: %s", result.AdvertisementPayload.LocalName())
-						
+
 						// Service data extraction now handled by WaitForTunnelAdvertisement
 						if fidoServiceFound {
 							log.Printf("FIDO Service UUID found - will extract service data via ServiceData() method")
 						}
-						
+
 						if cableServiceFound {
 							log.Printf("caBLE Service UUID found - will extract service data via ServiceData() method")
 						}
-						
+
 						log.Printf("*** END FIDO/CTAP ADVERTISEMENT ***")
 						return
 					}
-					
-					// Since the TinyGo Bluetooth library has limitations, let's also check for 
+
+					// Since the TinyGo Bluetooth library has limitations, let's also check for
 					// devices that might be iOS/Android devices that could be advertising CTAP2
 					// Look for devices with strong signal and check if they're phones
 					if result.RSSI > -40 { // Strong signal, likely nearby phone
 						// Check if this might be a phone by looking for common patterns
 						deviceAddr := result.Address.String()
 						localName := result.AdvertisementPayload.LocalName()
-						
+
 						// Log potential phone devices for manual inspection
 						if localName != "" || result.RSSI > -30 {
-							log.Printf("  >> Potential phone device nearby: %s (RSSI: %d, Name: %s)", 
+							log.Printf("  >> Potential phone device nearby: %s (RSSI: %d, Name: %s)",
 								deviceAddr, result.RSSI, localName)
-								
+
 							// Try to connect to very close devices (>-35 dBm) to check GATT services
 							if result.RSSI > -35 {
 								// Check if we've already checked this device
@@ -260,7 +478,7 @@ func (s *Scanner) StartScanning(ctx context.Context) error {
 						}
 					}
 				})
-				
+
 				if err != nil {
 					log.Printf("BLE scan error: %v", err)
 					// Exit on error or context cancellation
@@ -270,7 +488,7 @@ func (s *Scanner) StartScanning(ctx context.Context) error {
 					default:
 					}
 				}
-				
+
 				// Wait before next scan cycle with context check
 				select {
 				case <-ctx.Done():
@@ -294,14 +512,6 @@ func (s *Scanner) StartScanning(ctx context.Context) error {
 	return nil
 }
 
-// Stop stops BLE advertising
-func (a *Advertiser) Stop() {
-	if a.running {
-		a.running = false
-		log.Println("BLE advertising stopped")
-	}
-}
-
 // IsRunning returns whether the advertiser is currently running
 func (a *Advertiser) IsRunning() bool {
 	return a.running
@@ -314,26 +524,22 @@ func (s *Scanner) StopScanning() {
 			log.Printf("Error stopping scan: %v", err)
 		}
 		s.running = false
-		
-		// Close all device log files
-		s.closeAllLogFiles()
-		
+
+		// Close the event sink, if it owns any open resources (e.g. a
+		// PerDeviceFileEventSink's per-device files).
+		s.closeEventSink()
+
 		log.Println("BLE scanning stopped")
 	}
 }
 
-// closeAllLogFiles closes all open device log files
-func (s *Scanner) closeAllLogFiles() {
-	for deviceAddr, logFile := range s.deviceLogs {
-		logFile.WriteString(fmt.Sprintf("\n=== Log closed at: %s ===\n", time.Now().Format(time.RFC3339)))
-		if err := logFile.Close(); err != nil {
-			log.Printf("Error closing log file for device %s: %v", deviceAddr, err)
-		} else {
-			log.Printf("Closed log file for device %s", deviceAddr)
+// closeEventSink closes s.sink if it supports being closed.
+func (s *Scanner) closeEventSink() {
+	if closer, ok := s.sink.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Error closing event sink: %v", err)
 		}
 	}
-	// Clear the map
-	s.deviceLogs = make(map[string]*os.File)
 }
 
 // IsScanning returns whether the scanner is currently running
@@ -345,71 +551,49 @@ func (s *Scanner) IsScanning() bool {
 func (s *Scanner) checkGATTServices(address bluetooth.Address, rssi int16) {
 	deviceAddr := address.String()
 	log.Printf("  >> Connecting to device %s (RSSI: %d) to check GATT services...", deviceAddr, rssi)
-	
-	// Log GATT connection attempt to device log
-	if logFile, err := s.getDeviceLogFile(deviceAddr); err == nil {
-		logFile.WriteString(fmt.Sprintf("[%s] GATT CONNECTION ATTEMPT\n", time.Now().Format(time.RFC3339)))
-		logFile.WriteString(fmt.Sprintf("  Attempting to connect for service discovery\n"))
-		logFile.WriteString(fmt.Sprintf("  RSSI: %d dBm\n", rssi))
-		logFile.Sync()
-	}
-	
+
+	s.sink.OnGATTAttempt(GATTAttemptEvent{DeviceAddr: deviceAddr, RSSI: rssi, Stage: "connecting"})
+
 	// Parse both service UUIDs
 	fidoServiceUUID, err := bluetooth.ParseUUID(FIDOServiceUUID)
 	if err != nil {
 		log.Printf("  >> Failed to parse FIDO service UUID: %v", err)
 		return
 	}
-	
+
 	cableServiceUUID, err := bluetooth.ParseUUID(CableServiceUUID)
 	if err != nil {
 		log.Printf("  >> Failed to parse caBLE service UUID: %v", err)
 		return
 	}
-	
+
 	// Connect to the device
 	device, err := s.adapter.Connect(address, bluetooth.ConnectionParams{})
 	if err != nil {
 		log.Printf("  >> Failed to connect to device %s: %v", deviceAddr, err)
-		// Log connection failure
-		if logFile, logErr := s.getDeviceLogFile(deviceAddr); logErr == nil {
-			logFile.WriteString(fmt.Sprintf("  Connection FAILED: %v\n\n", err))
-			logFile.Sync()
-		}
+		s.sink.OnGATTAttempt(GATTAttemptEvent{DeviceAddr: deviceAddr, RSSI: rssi, Stage: "connect_failed", Err: err.Error()})
 		return
 	}
 	defer device.Disconnect()
-	
+
 	log.Printf("  >> Connected to device %s, discovering services...", deviceAddr)
-	
-	// Log successful connection
-	if logFile, err := s.getDeviceLogFile(deviceAddr); err == nil {
-		logFile.WriteString("  Connection SUCCESSFUL\n")
-		logFile.WriteString("  Starting service discovery...\n")
-		logFile.Sync()
-	}
-	
+	s.sink.OnGATTAttempt(GATTAttemptEvent{DeviceAddr: deviceAddr, RSSI: rssi, Stage: "connected"})
+
 	// Discover services for both UUIDs
 	services, err := device.DiscoverServices([]bluetooth.UUID{fidoServiceUUID, cableServiceUUID})
 	if err != nil {
 		log.Printf("  >> Failed to discover services on device %s: %v", deviceAddr, err)
-		// Log service discovery failure
-		if logFile, logErr := s.getDeviceLogFile(deviceAddr); logErr == nil {
-			logFile.WriteString(fmt.Sprintf("  Service discovery FAILED: %v\n\n", err))
-			logFile.Sync()
-		}
+		s.sink.OnGATTAttempt(GATTAttemptEvent{DeviceAddr: deviceAddr, RSSI: rssi, Stage: "discover_failed", Err: err.Error()})
 		return
 	}
-	
-	// Log discovered services
-	if logFile, err := s.getDeviceLogFile(deviceAddr); err == nil {
-		logFile.WriteString(fmt.Sprintf("  Service discovery SUCCESSFUL - found %d services\n", len(services)))
-		for i, service := range services {
-			logFile.WriteString(fmt.Sprintf("    Service %d: %s\n", i+1, service.UUID().String()))
-		}
-		logFile.Sync()
-	}
-	
+
+	s.sink.OnGATTAttempt(GATTAttemptEvent{
+		DeviceAddr: deviceAddr,
+		RSSI:       rssi,
+		Stage:      "services_discovered",
+		Detail:     fmt.Sprintf("found %d services", len(services)),
+	})
+
 	// Check if our target services are present
 	for _, service := range services {
 		if service.UUID() == fidoServiceUUID {
@@ -418,14 +602,8 @@ func (s *Scanner) checkGATTServices(address bluetooth.Address, rssi int16) {
 			log.Printf("RSSI: %d dBm", rssi)
 			log.Printf("FIDO Service UUID: %s", service.UUID().String())
 			log.Printf("*** END FIDO SERVICE DISCOVERY ***")
-			
-			// Log to device file
-			if logFile, logErr := s.getDeviceLogFile(deviceAddr); logErr == nil {
-				logFile.WriteString("  *** FIDO SERVICE FOUND ***\n")
-				logFile.WriteString(fmt.Sprintf("    UUID: %s\n", service.UUID().String()))
-				logFile.WriteString("  *** TARGET SERVICE DETECTED ***\n\n")
-				logFile.Sync()
-			}
+
+			s.sink.OnGATTAttempt(GATTAttemptEvent{DeviceAddr: deviceAddr, RSSI: rssi, Stage: "fido_found", Detail: service.UUID().String()})
 			return
 		}
 		if service.UUID() == cableServiceUUID {
@@ -434,144 +612,45 @@ func (s *Scanner) checkGATTServices(address bluetooth.Address, rssi int16) {
 			log.Printf("RSSI: %d dBm", rssi)
 			log.Printf("caBLE Service UUID: %s", service.UUID().String())
 			log.Printf("*** END CABLE SERVICE DISCOVERY ***")
-			
-			// Log to device file
-			if logFile, logErr := s.getDeviceLogFile(deviceAddr); logErr == nil {
-				logFile.WriteString("  *** CABLE SERVICE FOUND ***\n")
-				logFile.WriteString(fmt.Sprintf("    UUID: %s\n", service.UUID().String()))
-				logFile.WriteString("  *** TARGET SERVICE DETECTED ***\n\n")
-				logFile.Sync()
-			}
+
+			s.sink.OnGATTAttempt(GATTAttemptEvent{DeviceAddr: deviceAddr, RSSI: rssi, Stage: "cable_found", Detail: service.UUID().String()})
 			return
 		}
 	}
-	
+
 	log.Printf("  >> Device %s does not have FIDO/caBLE services", deviceAddr)
-	
-	// Log that target services were not found
-	if logFile, err := s.getDeviceLogFile(deviceAddr); err == nil {
-		logFile.WriteString("  Target services NOT FOUND\n")
-		logFile.WriteString("  Device does not advertise FIDO or caBLE services\n\n")
-		logFile.Sync()
-	}
-}
-
-// getDeviceLogFile creates or gets existing log file for a device
-func (s *Scanner) getDeviceLogFile(deviceAddr string) (*os.File, error) {
-	// Sanitize device address for filename
-	sanitizedAddr := strings.ReplaceAll(deviceAddr, ":", "-")
-	
-	// Check if log file already exists
-	if logFile, exists := s.deviceLogs[deviceAddr]; exists {
-		return logFile, nil
-	}
-	
-	// Create new log file
-	filename := fmt.Sprintf("device_%s_%d.log", sanitizedAddr, time.Now().Unix())
-	filepath := filepath.Join(s.logDir, filename)
-	
-	logFile, err := os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create device log file: %w", err)
-	}
-	
-	// Store in map
-	s.deviceLogs[deviceAddr] = logFile
-	
-	// Write header
-	logFile.WriteString(fmt.Sprintf("=== BLE Device Log for %s ===\n", deviceAddr))
-	logFile.WriteString(fmt.Sprintf("Started at: %s\n", time.Now().Format(time.RFC3339)))
-	logFile.WriteString("==========================================\n\n")
-	
-	log.Printf("Created device log file: %s", filepath)
-	return logFile, nil
-}
-
-// logDeviceInfo logs detailed device information to device-specific log file
+	s.sink.OnGATTAttempt(GATTAttemptEvent{DeviceAddr: deviceAddr, RSSI: rssi, Stage: "not_found"})
+}
+
+// logDeviceInfo emits a DeviceEvent plus, if the advertisement's service
+// UUIDs match FIDO and/or caBLE, a ServiceMatchEvent describing which.
 func (s *Scanner) logDeviceInfo(deviceAddr string, rssi int16, localName string, payload bluetooth.AdvertisementPayload) {
-	logFile, err := s.getDeviceLogFile(deviceAddr)
-	if err != nil {
-		log.Printf("Failed to get log file for device %s: %v", deviceAddr, err)
-		return
-	}
-	
-	timestamp := time.Now().Format(time.RFC3339)
-	
-	// Log basic device info
-	logFile.WriteString(fmt.Sprintf("[%s] DEVICE SCAN RESULT\n", timestamp))
-	logFile.WriteString(fmt.Sprintf("  Address: %s\n", deviceAddr))
-	logFile.WriteString(fmt.Sprintf("  RSSI: %d dBm\n", rssi))
-	logFile.WriteString(fmt.Sprintf("  Local Name: %s\n", localName))
-	
-	// Try to extract and log all available UUIDs
-	logFile.WriteString("  Service UUID Detection:\n")
-	
-	// Check for FIDO service UUID
+	s.sink.OnDevice(DeviceEvent{DeviceAddr: deviceAddr, RSSI: rssi, LocalName: localName})
+
 	fidoServiceUUID, _ := bluetooth.ParseUUID(FIDOServiceUUID)
-	if payload.HasServiceUUID(fidoServiceUUID) {
-		logFile.WriteString(fmt.Sprintf("    ✓ FIDO Service UUID: %s (FOUND)\n", FIDOServiceUUID))
-	} else {
-		logFile.WriteString(fmt.Sprintf("    ✗ FIDO Service UUID: %s (not found)\n", FIDOServiceUUID))
-	}
-	
-	// Check for caBLE service UUID
 	cableServiceUUID, _ := bluetooth.ParseUUID(CableServiceUUID)
-	if payload.HasServiceUUID(cableServiceUUID) {
-		logFile.WriteString(fmt.Sprintf("    ✓ caBLE Service UUID: %s (FOUND)\n", CableServiceUUID))
-	} else {
-		logFile.WriteString(fmt.Sprintf("    ✗ caBLE Service UUID: %s (not found)\n", CableServiceUUID))
-	}
-	
-	// Check for other common UUIDs that might indicate FIDO capability
-	commonUUIDs := []string{
-		"0000180f-0000-1000-8000-00805f9b34fb", // Battery Service
-		"0000180a-0000-1000-8000-00805f9b34fb", // Device Information
-		"00001812-0000-1000-8000-00805f9b34fb", // HID Service
-		"0000fffc-0000-1000-8000-00805f9b34fb", // FIDO Test UUID
-		"0000fffe-0000-1000-8000-00805f9b34fb", // FIDO Alternative
-	}
-	
-	foundCommon := false
-	for _, uuidStr := range commonUUIDs {
-		if uuid, err := bluetooth.ParseUUID(uuidStr); err == nil {
-			if payload.HasServiceUUID(uuid) {
-				logFile.WriteString(fmt.Sprintf("    ◦ Common UUID: %s (found)\n", uuidStr))
-				foundCommon = true
-			}
-		}
-	}
-	
-	if !foundCommon {
-		logFile.WriteString("    ◦ No common service UUIDs detected\n")
+	fidoFound := payload.HasServiceUUID(fidoServiceUUID)
+	cableFound := payload.HasServiceUUID(cableServiceUUID)
+
+	if fidoFound || cableFound {
+		s.sink.OnServiceMatch(ServiceMatchEvent{
+			DeviceAddr:        deviceAddr,
+			RSSI:              rssi,
+			FIDOServiceFound:  fidoFound,
+			CableServiceFound: cableFound,
+		})
 	}
-	
-	// Note: TinyGo Bluetooth has limited payload inspection capabilities
-	// In a full implementation, we would iterate through all advertised UUIDs
-	logFile.WriteString("  Note: Limited to checking specific UUIDs due to TinyGo Bluetooth library constraints\n")
-	logFile.WriteString("        Real devices may advertise additional UUIDs not checked here\n")
-	
-	// Log service data extraction capability
-	logFile.WriteString("  Service Data Extraction:\n")
-	logFile.WriteString("    - Service data available via ServiceData() method in TinyGo v0.12.0\n")
-	
-	logFile.WriteString("\n")
-	logFile.Sync() // Ensure data is written immediately
 }
 
-
-
-
-
-
 // WaitForTunnelAdvertisement waits for a BLE advertisement containing tunnel service information
 func (s *Scanner) WaitForTunnelAdvertisement(ctx context.Context) (*TunnelInfo, error) {
 	log.Printf("Waiting for BLE advertisement with tunnel service information...")
-	
+
 	// Channel to receive tunnel information
 	tunnelInfoChan := make(chan *TunnelInfo, 1)
 	scanErrChan := make(chan error, 1)
 	scanDoneChan := make(chan bool, 1)
-	
+
 	// Start scanning with context timeout
 	go func() {
 		defer func() {
@@ -581,14 +660,14 @@ func (s *Scanner) WaitForTunnelAdvertisement(ctx context.Context) (*TunnelInfo,
 			}
 			scanDoneChan <- true
 		}()
-		
+
 		// Monitor context cancellation in a separate goroutine
 		go func() {
 			<-ctx.Done()
 			log.Printf("Context cancelled, forcing scan stop")
 			s.adapter.StopScan()
 		}()
-		
+
 		err := s.adapter.Scan(func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
 			// Check if context is cancelled immediately
 			select {
@@ -597,41 +676,41 @@ func (s *Scanner) WaitForTunnelAdvertisement(ctx context.Context) (*TunnelInfo,
 				return
 			default:
 			}
-			
+
 			deviceID := result.Address.String()
 			rssi := result.RSSI
 			localName := result.AdvertisementPayload.LocalName()
-			
+
 			// Log device discovery
 			log.Printf("BLE Device found: %s (RSSI: %d dBm)", deviceID, rssi)
 			if localName != "" {
 				log.Printf("  Name: %s", localName)
 			}
-			
+
 			// Check for iPad device
-			isIPad := strings.Contains(strings.ToLower(localName), "ipad") || 
-				deviceID == "394c3434-49ab-2b33-5bb4-228481792d55" || 
+			isIPad := strings.Contains(strings.ToLower(localName), "ipad") ||
+				deviceID == "394c3434-49ab-2b33-5bb4-228481792d55" ||
 				deviceID == "394C3434-49AB-2B33-5BB4-228481792D55"
-				
+
 			if isIPad {
 				log.Printf("*** DETECTED iPAD DEVICE IN TUNNEL SCAN: %s ***", deviceID)
 				log.Printf("  Will attempt iPad-specific caBLE extraction")
 			}
-			
+
 			// Special check for device found by Python scanner
 			if deviceID == "121b296f-41b8-90a8-f92f-355b91b6aa55" || deviceID == "121B296F-41B8-90A8-F92F-355B91B6AA55" {
 				log.Printf("*** FOUND TARGET DEVICE FROM PYTHON SCANNER: %s ***", deviceID)
-				
+
 				// Force check for both UUIDs
 				fidoServiceUUID, _ := bluetooth.ParseUUID(FIDOServiceUUID)
 				cableServiceUUID, _ := bluetooth.ParseUUID(CableServiceUUID)
-				
+
 				hasFIDO := result.AdvertisementPayload.HasServiceUUID(fidoServiceUUID)
 				hasCable := result.AdvertisementPayload.HasServiceUUID(cableServiceUUID)
-				
+
 				log.Printf("  FIDO UUID check: %v", hasFIDO)
 				log.Printf("  caBLE UUID check: %v", hasCable)
-				
+
 				if hasFIDO || hasCable {
 					log.Printf("*** SERVICE UUID DETECTED ON TARGET DEVICE ***")
 					if s.processTunnelAdvertisement(result, tunnelInfoChan) {
@@ -640,13 +719,13 @@ func (s *Scanner) WaitForTunnelAdvertisement(ctx context.Context) (*TunnelInfo,
 					}
 				}
 			}
-			
+
 			// Check for FIDO service data
 			if s.processTunnelAdvertisement(result, tunnelInfoChan) {
 				log.Printf("Tunnel service information detected from device: %s", deviceID)
 			}
 		})
-		
+
 		if err != nil {
 			select {
 			case scanErrChan <- err:
@@ -654,7 +733,7 @@ func (s *Scanner) WaitForTunnelAdvertisement(ctx context.Context) (*TunnelInfo,
 			}
 		}
 	}()
-	
+
 	// Wait for tunnel info, scan error, or context cancellation
 	select {
 	case tunnelInfo := <-tunnelInfoChan:
@@ -680,23 +759,23 @@ func (s *Scanner) WaitForTunnelAdvertisement(ctx context.Context) (*TunnelInfo,
 func (s *Scanner) processTunnelAdvertisement(result bluetooth.ScanResult, tunnelInfoChan chan *TunnelInfo) bool {
 	deviceAddr := result.Address.String()
 	localName := result.AdvertisementPayload.LocalName()
-	
+
 	// Parse UUIDs from advertisement payload using existing method
 	fidoServiceUUID, _ := bluetooth.ParseUUID(FIDOServiceUUID)
 	cableServiceUUID, _ := bluetooth.ParseUUID(CableServiceUUID)
-	
+
 	// Check if this device advertises FIDO or caBLE service
 	hasFIDOService := result.AdvertisementPayload.HasServiceUUID(fidoServiceUUID)
 	hasCableService := result.AdvertisementPayload.HasServiceUUID(cableServiceUUID)
-	
+
 	// Special handling for iPad devices - check Apple Manufacturer Data
 	// iPad detection: either by name or known device ID
-	isIPad := strings.Contains(strings.ToLower(localName), "ipad") || 
-		deviceAddr == "394c3434-49ab-2b33-5bb4-228481792d55" || 
+	isIPad := strings.Contains(strings.ToLower(localName), "ipad") ||
+		deviceAddr == "394c3434-49ab-2b33-5bb4-228481792d55" ||
 		deviceAddr == "394C3434-49AB-2B33-5BB4-228481792D55"
-	
+
 	var appleManufacturerData []byte
-	
+
 	if isIPad {
 		log.Printf("*** DETECTED iPAD DEVICE: %s ***", deviceAddr)
 		log.Printf("  Detection method: %s", func() string {
@@ -705,15 +784,10 @@ func (s *Scanner) processTunnelAdvertisement(result bluetooth.ScanResult, tunnel
 			}
 			return "Known Device ID"
 		}())
-		
-		// TODO: Extract manufacturer data when TinyGo Bluetooth supports it
-		// For now, we'll check service UUIDs as fallback
+
 		log.Printf("  Device Name: %s", localName)
 		log.Printf("  Note: iPad devices embed caBLE info in Apple Manufacturer Data (Company ID 76)")
-		log.Printf("  Checking for standard service UUIDs as fallback...")
-		
-		// Check if there's any potential caBLE data in manufacturer data
-		// This would need TinyGo Bluetooth manufacturer data support
+
 		appleManufacturerData = s.extractAppleManufacturerData(result)
 		if len(appleManufacturerData) > 0 {
 			log.Printf("  Found Apple Manufacturer Data: %x", appleManufacturerData)
@@ -722,48 +796,62 @@ func (s *Scanner) processTunnelAdvertisement(result bluetooth.ScanResult, tunnel
 			}
 		}
 	}
-	
+
 	if !hasFIDOService && !hasCableService && !isIPad {
 		return false
 	}
-	
+
 	if hasFIDOService {
 		log.Printf("Found FIDO service advertisement from device: %s", result.Address.String())
 	}
 	if hasCableService {
 		log.Printf("Found caBLE service advertisement from device: %s", result.Address.String())
 	}
-	
-	// Extract service data directly using TinyGo Bluetooth v0.12.0 ServiceData() method
+
 	var serviceData []byte
-	
-	// Get service data entries
-	serviceDataEntries := result.AdvertisementPayload.ServiceData()
-	if len(serviceDataEntries) > 0 {
-		// Parse target UUIDs
-		cableServiceUUID, _ := bluetooth.ParseUUID(CableServiceUUID)
-		fidoServiceUUID, _ := bluetooth.ParseUUID(FIDOServiceUUID)
-		
-		// Find caBLE or FIDO service data
-		for _, entry := range serviceDataEntries {
-			if entry.UUID == cableServiceUUID {
-				log.Printf("Found caBLE service data (UUID 0xFFF9): %x (length: %d)", entry.Data, len(entry.Data))
-				serviceData = entry.Data
-				break
-			} else if entry.UUID == fidoServiceUUID {
-				log.Printf("Found FIDO service data (UUID 0xFFFD): %x (length: %d)", entry.Data, len(entry.Data))
-				serviceData = entry.Data
-				break
+
+	// Prefer service data read directly from the OS Bluetooth stack (see
+	// servicedata.go), which doesn't share TinyGo Bluetooth's advertisement
+	// parsing gaps.
+	if native := s.nativeServiceDataFor(deviceAddr); native != nil {
+		if data, ok := native[strings.ToLower(CableServiceUUID)]; ok {
+			log.Printf("Found caBLE service data via native backend (UUID 0xFFF9): %x (length: %d)", data, len(data))
+			serviceData = data
+		} else if data, ok := native[strings.ToLower(FIDOServiceUUID)]; ok {
+			log.Printf("Found FIDO service data via native backend (UUID 0xFFFD): %x (length: %d)", data, len(data))
+			serviceData = data
+		}
+	}
+
+	// Fall back to TinyGo Bluetooth's own ServiceData() method.
+	if serviceData == nil {
+		serviceDataEntries := result.AdvertisementPayload.ServiceData()
+		if len(serviceDataEntries) > 0 {
+			// Parse target UUIDs
+			cableServiceUUID, _ := bluetooth.ParseUUID(CableServiceUUID)
+			fidoServiceUUID, _ := bluetooth.ParseUUID(FIDOServiceUUID)
+
+			// Find caBLE or FIDO service data
+			for _, entry := range serviceDataEntries {
+				if entry.UUID == cableServiceUUID {
+					log.Printf("Found caBLE service data via TinyGo Bluetooth (UUID 0xFFF9): %x (length: %d)", entry.Data, len(entry.Data))
+					serviceData = entry.Data
+					break
+				} else if entry.UUID == fidoServiceUUID {
+					log.Printf("Found FIDO service data via TinyGo Bluetooth (UUID 0xFFFD): %x (length: %d)", entry.Data, len(entry.Data))
+					serviceData = entry.Data
+					break
+				}
 			}
 		}
 	}
-	
+
 	// For standard devices (non-iPad), require service data
 	if !isIPad && (serviceData == nil || len(serviceData) < 20) {
 		log.Printf("Service data insufficient for caBLE v2 (got %d bytes, need 20)", len(serviceData))
 		return false
 	}
-	
+
 	// For iPad devices, we've already tried Apple Manufacturer Data above
 	// If we reach here with an iPad but no service data, that's expected
 	if isIPad && (serviceData == nil || len(serviceData) < 20) {
@@ -771,111 +859,153 @@ func (s *Scanner) processTunnelAdvertisement(result bluetooth.ScanResult, tunnel
 		log.Printf("iPad uses Apple Manufacturer Data embedding (already attempted above)")
 		return false
 	}
-	
+
 	log.Printf("Service data length: %d bytes", len(serviceData))
 	log.Printf("Service data (encrypted): %x", serviceData)
-	
+
 	// Try to decrypt and process the service data
 	return s.tryDecryptCableData(serviceData, tunnelInfoChan, "Standard Service Data")
 }
 
-// getTunnelURL maps tunnel service identifier to URL
-func (s *Scanner) getTunnelURL(tunnelService []byte) string {
-	// Default tunnel URLs based on service identifier
-	// In practice, this would be determined by the tunnel service identifier
-	// For testing, we'll use a default URL
-	if len(tunnelService) >= 2 {
-		switch tunnelService[0] {
-		case 0x00:
-			return "cable.ua5v.com"
-		case 0x01:
-			return "cable.auth.com"
-		default:
-			return "cable.ua5v.com"
-		}
+// TunnelDomainResolver resolves a caBLE v2 encoded tunnel-server-domain
+// value (the advertisement's own EncodedTunnelDomain field) into the
+// hostname of the tunnel service it identifies. Scanner uses this instead
+// of a hard-coded host table so callers can substitute a different
+// assigned-domain list - e.g. a fixture in tests, or a future spec
+// revision - without forking Scanner itself.
+type TunnelDomainResolver interface {
+	ResolveTunnelDomain(encodedTunnelServerDomain uint16) string
+}
+
+// assignedTunnelDomains holds the caBLE v2 tunnel server domains that are
+// assigned directly, indexed by EncodedTunnelDomain. Mirrors
+// pkg/tunnel.DomainForEncodedTunnelServerDomain's table of the same name;
+// duplicated here rather than imported because pkg/tunnel already imports
+// pkg/ble, and importing it back would create a cycle.
+var assignedTunnelDomains = []string{"cable.ua5v.com", "cable.auth.com"}
+
+// tunnelDomainTLDs are the TLDs a synthesized tunnel domain picks from,
+// selected by the low two bits of the synthesis digest.
+var tunnelDomainTLDs = []string{"com", "org", "net", "info"}
+
+// defaultTunnelDomainResolver implements the caBLE v2 assigned-domain
+// algorithm: values that index into assignedTunnelDomains resolve
+// directly, and every other value synthesizes a domain by hashing
+// "caBLE tunnel server domain\x00" with the little-endian-encoded ID and a
+// trailing zero byte, base32-encoding the leading tunnelDomainLabelLength
+// bytes of the digest as the DNS label, and picking a TLD from the
+// digest's low two bits.
+type defaultTunnelDomainResolver struct{}
+
+func (defaultTunnelDomainResolver) ResolveTunnelDomain(encoded uint16) string {
+	if int(encoded) < len(assignedTunnelDomains) {
+		return assignedTunnelDomains[encoded]
 	}
-	return "cable.ua5v.com"
+
+	h := sha256.New()
+	h.Write([]byte("caBLE tunnel server domain\x00"))
+	h.Write([]byte{byte(encoded), byte(encoded >> 8)})
+	h.Write([]byte{0})
+	digest := h.Sum(nil)
+
+	label := strings.ToLower(tunnelDomainEncoding.EncodeToString(digest[:tunnelDomainLabelLength]))
+	tld := tunnelDomainTLDs[digest[len(digest)-1]&0x03]
+
+	return fmt.Sprintf("cable.%s.%s", label, tld)
 }
 
-// extractAppleManufacturerData attempts to extract Apple manufacturer data from BLE advertisement
+// getTunnelURL builds the tunnel service's wss:// connect URL from the
+// decrypted advertisement's encoded tunnel domain, routing ID, and
+// connection nonce.
+func (s *Scanner) getTunnelURL(encodedTunnelServerDomain uint16, routingID []byte, nonce []byte) string {
+	domain := s.domainResolver.ResolveTunnelDomain(encodedTunnelServerDomain)
+	return fmt.Sprintf("wss://%s/cable/connect/%s/%s", domain, hex.EncodeToString(routingID), hex.EncodeToString(nonce))
+}
+
+// appleCompanyID is the Bluetooth SIG-assigned company identifier for
+// Apple, Inc., under which iOS publishes its Continuity protocol data.
+const appleCompanyID = 0x004C
+
+// Apple Continuity protocol type bytes, as published in informal reverse
+// engineering of the format (Apple does not publish the Continuity spec):
+// each precedes a [length][payload] TLV inside the company's manufacturer
+// data. iOS wraps caBLE v2 service data inside a Nearby Info or Proximity
+// Pairing sub-structure instead of advertising the 0xFFFD service UUID
+// directly, so these are the two types processTunnelAdvertisement's iPad
+// path looks inside.
+const (
+	appleContinuityTypeNearbyInfo       = 0x10
+	appleContinuityTypeProximityPairing = 0x07
+)
+
+// extractAppleManufacturerData returns the manufacturer data iOS published
+// under Apple's company ID (0x004C), or nil if the advertisement didn't
+// include any.
 func (s *Scanner) extractAppleManufacturerData(result bluetooth.ScanResult) []byte {
-	// TODO: This requires TinyGo Bluetooth library support for manufacturer data
-	// The current TinyGo Bluetooth library (v0.12.0) has limited manufacturer data access
-	// We would need to use the raw advertisement data parsing or wait for library updates
-	
-	// For now, return empty slice as placeholder
-	// In a real implementation, we would parse the raw advertisement payload
-	// to extract manufacturer data with Company ID 76 (Apple)
-	
-	log.Printf("  Warning: TinyGo Bluetooth manufacturer data extraction not yet implemented")
-	log.Printf("  Need to parse raw advertisement payload for Company ID 76 (Apple)")
-	
-	return []byte{}
-}
-
-// tryAppleManufacturerDataDecryption attempts to decrypt caBLE data from Apple manufacturer data
+	for _, entry := range result.AdvertisementPayload.ManufacturerData() {
+		if entry.CompanyID == appleCompanyID {
+			return entry.Data
+		}
+	}
+	return nil
+}
+
+// appleContinuityCableCandidate walks the Apple Continuity protocol's
+// [type(1)][length(1)][payload(length)] TLV structure inside Apple
+// manufacturer data, looking for a Nearby Info or Proximity Pairing
+// sub-structure whose payload is at least CableV2AdvertLength bytes - the
+// size of a caBLE v2 encrypted service data block. Returns the leading
+// CableV2AdvertLength bytes of the first such payload found, or nil.
+func appleContinuityCableCandidate(data []byte) []byte {
+	for i := 0; i+2 <= len(data); {
+		typ := data[i]
+		length := int(data[i+1])
+		if i+2+length > len(data) {
+			break
+		}
+		payload := data[i+2 : i+2+length]
+
+		if typ == appleContinuityTypeNearbyInfo || typ == appleContinuityTypeProximityPairing {
+			if len(payload) >= CableV2AdvertLength {
+				return payload[:CableV2AdvertLength]
+			}
+		}
+
+		i += 2 + length
+	}
+	return nil
+}
+
+// tryAppleManufacturerDataDecryption attempts to decrypt caBLE data found
+// inside Apple manufacturer data's Continuity sub-structures.
 func (s *Scanner) tryAppleManufacturerDataDecryption(manufacturerData []byte, tunnelInfoChan chan *TunnelInfo) bool {
 	log.Printf("Attempting to decrypt Apple Manufacturer Data as caBLE v2...")
-	
-	// Apple Manufacturer Data format for caBLE (based on research):
-	// [2 bytes: Apple Company ID 0x004C] + [variable: Apple-specific data]
-	// The caBLE data is embedded within the Apple-specific portion
-	
-	if len(manufacturerData) < 9 {
-		log.Printf("  Apple Manufacturer Data too short: %d bytes (minimum 9 for caBLE)", len(manufacturerData))
+
+	candidate := appleContinuityCableCandidate(manufacturerData)
+	if candidate == nil {
+		log.Printf("  No caBLE v2-sized Continuity sub-structure found in Apple Manufacturer Data")
 		return false
 	}
-	
-	// Skip first 2 bytes (likely Apple type/subtype flags)
-	// Based on research logs, the pattern is: 10054b18c52d68 or 10054718c52d68
-	// Where the changing part (4b->47) might contain caBLE information
-	cableCandidate := manufacturerData[2:] // Skip type flags
-	
-	log.Printf("  Apple caBLE candidate data: %x", cableCandidate)
-	
-	// Try to decrypt as caBLE v2 if we have enough data
-	if len(cableCandidate) >= 20 {
-		return s.tryDecryptCableData(cableCandidate, tunnelInfoChan, "Apple Manufacturer Data")
-	}
-	
-	// For shorter Apple data, try different extraction strategies
-	if len(cableCandidate) >= 7 {
-		log.Printf("  Attempting iPad-specific caBLE extraction from %d bytes", len(cableCandidate))
-		
-		// Extract what we can and pad/extend as needed for testing
-		// This is experimental - real iPad implementation may vary
-		
-		// Try to extract nonce-like data from changing portion
-		var paddedData [20]byte
-		copy(paddedData[:], cableCandidate)
-		
-		// Fill remaining with pattern or zeros
-		for i := len(cableCandidate); i < 20; i++ {
-			paddedData[i] = 0x00
-		}
-		
-		log.Printf("  Padded candidate data: %x", paddedData[:])
-		return s.tryDecryptCableData(paddedData[:], tunnelInfoChan, "iPad Apple Data (padded)")
-	}
-	
-	log.Printf("  Apple Manufacturer Data insufficient for caBLE extraction")
-	return false
+
+	log.Printf("  Apple caBLE candidate data: %x", candidate)
+	return s.tryDecryptCableData(candidate, tunnelInfoChan, "Apple Manufacturer Data")
 }
 
 // tryDecryptCableData attempts to decrypt caBLE v2 data from any source
 func (s *Scanner) tryDecryptCableData(data []byte, tunnelInfoChan chan *TunnelInfo, source string) bool {
 	log.Printf("Attempting caBLE v2 decryption from %s...", source)
-	
+
 	// Decrypt caBLE v2 data using QR secret
 	decryptor := NewCableV2Decryptor(s.qrSecret)
 	decryptedData, err := decryptor.DecryptServiceData(data)
-	
+
 	var nonce, routingID, tunnelService, additionalData []byte
 	var tunnelURL string
-	
+
 	if err != nil {
 		log.Printf("Failed to decrypt %s as caBLE v2: %v", source, err)
-		
+		s.sink.OnDecryptAttempt(DecryptAttemptEvent{Source: source, OK: false, Err: err.Error()})
+
 		// For iPad, we might need different extraction strategy
 		if strings.Contains(source, "iPad") || strings.Contains(source, "Apple") {
 			log.Printf("  iPad decryption failed - this is expected as iPad uses different embedding")
@@ -884,32 +1014,36 @@ func (s *Scanner) tryDecryptCableData(data []byte, tunnelInfoChan chan *TunnelIn
 		}
 		return false
 	}
-	
+
 	log.Printf("Successfully decrypted %s: %x", source, decryptedData)
-	
+
 	// Parse decrypted data according to caBLE v2 specification
 	var parseErr error
 	nonce, routingID, tunnelService, additionalData, parseErr = ParseDecryptedServiceData(decryptedData)
 	if parseErr != nil {
 		log.Printf("Failed to parse decrypted data from %s: %v", source, parseErr)
+		s.sink.OnDecryptAttempt(DecryptAttemptEvent{Source: source, OK: false, Err: parseErr.Error()})
 		return false
 	}
-	
+
 	log.Printf("Decrypted caBLE v2 from %s:", source)
 	log.Printf("  Nonce: %x", nonce)
 	log.Printf("  Routing ID: %x", routingID)
 	log.Printf("  Tunnel Service: %x", tunnelService)
 	log.Printf("  Additional Data: %x", additionalData)
-	
-	// Map tunnel service identifier to URL
-	tunnelURL = s.getTunnelURL(tunnelService)
-	
+
 	// Extract tunnel service domain from 2-byte identifier
 	var encodedTunnelDomain uint16
 	if len(tunnelService) >= 2 {
 		encodedTunnelDomain = uint16(tunnelService[0]) | (uint16(tunnelService[1]) << 8)
 	}
-	
+
+	// Map the encoded tunnel domain, routing ID, and nonce to the tunnel
+	// server's connect URL
+	tunnelURL = s.getTunnelURL(encodedTunnelDomain, routingID, nonce)
+
+	s.sink.OnDecryptAttempt(DecryptAttemptEvent{Source: source, OK: true})
+
 	tunnelInfo := &TunnelInfo{
 		TunnelURL:           tunnelURL,
 		ConnectionNonce:     nonce,
@@ -918,7 +1052,13 @@ func (s *Scanner) tryDecryptCableData(data []byte, tunnelInfoChan chan *TunnelIn
 		EncodedTunnelDomain: encodedTunnelDomain,
 		AdditionalData:      additionalData,
 	}
-	
+
+	s.sink.OnTunnelDecoded(TunnelDecodedEvent{
+		Source:    source,
+		TunnelURL: tunnelURL,
+		RoutingID: hex.EncodeToString(routingID),
+	})
+
 	// Send tunnel info to channel
 	select {
 	case tunnelInfoChan <- tunnelInfo:
@@ -942,4 +1082,4 @@ func min(a, b int) int {
 		return a
 	}
 	return b
-}
\ No newline at end of file
+}
@@ -8,16 +8,18 @@ import (
 	"log"
 
 	"golang.org/x/crypto/hkdf"
+
+	"ctap2-hybrid-transport/pkg/qrcode"
 )
 
 // caBLE v2 cryptographic constants
 const (
-	CableV2EIDKeyLength    = 64  // EID key length (32 bytes AES + 32 bytes HMAC)
-	CableV2AESKeyLength    = 32  // AES key length
-	CableV2HMACKeyLength   = 32  // HMAC key length  
-	CableV2AdvertLength    = 20  // BLE advertisement length
-	CableV2PlaintextLength = 16  // Decrypted plaintext length
-	CableV2HMACTagLength   = 4   // HMAC tag length (first 4 bytes of SHA256)
+	CableV2EIDKeyLength    = 64 // EID key length (32 bytes AES + 32 bytes HMAC)
+	CableV2AESKeyLength    = 32 // AES key length
+	CableV2HMACKeyLength   = 32 // HMAC key length
+	CableV2AdvertLength    = 20 // BLE advertisement length
+	CableV2PlaintextLength = 16 // Decrypted plaintext length
+	CableV2HMACTagLength   = 4  // HMAC tag length (first 4 bytes of SHA256)
 )
 
 // caBLE v2 key purposes for HKDF
@@ -41,6 +43,13 @@ func NewCableV2Decryptor(qrSecret []byte) *CableV2Decryptor {
 	}
 }
 
+// NewCableV2DecryptorFromSession creates a new caBLE v2 decryptor using the
+// QR secret held by a qrcode.Session, instead of requiring the caller to
+// extract and pass the raw secret themselves.
+func NewCableV2DecryptorFromSession(session *qrcode.Session) *CableV2Decryptor {
+	return NewCableV2Decryptor(session.QRSecret())
+}
+
 // DecryptServiceData decrypts caBLE v2 service data using QR secret
 func (d *CableV2Decryptor) DecryptServiceData(encryptedData []byte) ([]byte, error) {
 	if len(encryptedData) != CableV2AdvertLength {
@@ -90,7 +99,7 @@ func (d *CableV2Decryptor) derive(output, secret, salt []byte, purpose keyPurpos
 // trialDecrypt implements caBLE v2 trial decryption: AES-ECB + HMAC verification
 func (d *CableV2Decryptor) trialDecrypt(eidKey *[CableV2EIDKeyLength]byte, candidateAdvert []byte) ([CableV2PlaintextLength]byte, bool) {
 	var zeros [CableV2PlaintextLength]byte
-	
+
 	if len(candidateAdvert) != CableV2AdvertLength {
 		log.Printf("Invalid advert length: %d, expected %d", len(candidateAdvert), CableV2AdvertLength)
 		return zeros, false
@@ -146,6 +155,32 @@ func (d *CableV2Decryptor) reservedBitsAreZero(plaintext [CableV2PlaintextLength
 	return plaintext[0] == 0
 }
 
+// encryptServiceData is trialDecrypt's inverse: it AES-ECB encrypts a
+// 16-byte plaintext block with the EID key's AES half, then appends an
+// HMAC-SHA256 tag (the first 4 bytes, computed over the ciphertext rather
+// than the plaintext) using the EID key's HMAC half, producing the 20-byte
+// payload trialDecrypt expects to find in the advertisement. Advertiser
+// uses this to build the service data it broadcasts.
+func (d *CableV2Decryptor) encryptServiceData(eidKey *[CableV2EIDKeyLength]byte, plaintext [CableV2PlaintextLength]byte) ([CableV2AdvertLength]byte, error) {
+	var advert [CableV2AdvertLength]byte
+
+	aesKey := eidKey[:CableV2AESKeyLength]
+	hmacKey := eidKey[CableV2AESKeyLength:]
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return advert, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	block.Encrypt(advert[:CableV2PlaintextLength], plaintext[:])
+
+	h := hmac.New(sha256.New, hmacKey)
+	h.Write(advert[:CableV2PlaintextLength])
+	tag := h.Sum(nil)
+	copy(advert[CableV2PlaintextLength:], tag[:CableV2HMACTagLength])
+
+	return advert, nil
+}
+
 // ParseDecryptedServiceData parses decrypted caBLE v2 service data according to specification
 func ParseDecryptedServiceData(decryptedData []byte) (nonce []byte, routingID []byte, tunnelService []byte, additionalData []byte, err error) {
 	if len(decryptedData) != CableV2PlaintextLength {
@@ -154,17 +189,17 @@ func ParseDecryptedServiceData(decryptedData []byte) (nonce []byte, routingID []
 
 	// Parse according to caBLE v2 specification:
 	// [1 byte flags (must be 0)] + [10 bytes connection nonce] + [3 bytes routing ID] + [2 bytes tunnel service]
-	
+
 	// Skip flags byte (index 0)
 	nonce = make([]byte, 10)
 	copy(nonce, decryptedData[1:11])
-	
+
 	routingID = make([]byte, 3)
 	copy(routingID, decryptedData[11:14])
-	
+
 	tunnelService = make([]byte, 2)
 	copy(tunnelService, decryptedData[14:16])
-	
+
 	// No additional data in caBLE v2 spec
 	additionalData = nil
 
@@ -177,4 +212,4 @@ func UnpackDecryptedAdvert(plaintext [CableV2PlaintextLength]byte) (nonce [10]by
 	copy(routingID[:], plaintext[11:14])
 	encodedTunnelServerDomain = uint16(plaintext[14]) | (uint16(plaintext[15]) << 8)
 	return
-}
\ No newline at end of file
+}
@@ -0,0 +1,237 @@
+package ble
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventSink receives the structured events Scanner observes while
+// scanning, replacing its former practice of writing free-form text
+// straight to per-device os.Files. Decoupling emission from persistence
+// lets tests assert on event sequences with NoopEventSink instead of
+// parsing log files, and avoids leaking file descriptors if the scanner is
+// torn down without calling StopScanning.
+type EventSink interface {
+	// OnDevice fires for every BLE advertisement the scanner observes,
+	// before any service/GATT matching is attempted.
+	OnDevice(DeviceEvent)
+	// OnServiceMatch fires when an advertisement's service UUIDs match
+	// the FIDO and/or caBLE service the scanner listens for.
+	OnServiceMatch(ServiceMatchEvent)
+	// OnGATTAttempt fires for each stage of a GATT connect-and-discover
+	// probe against a nearby device.
+	OnGATTAttempt(GATTAttemptEvent)
+	// OnTunnelDecoded fires once an advertisement's service data has
+	// been decrypted and parsed into a TunnelInfo.
+	OnTunnelDecoded(TunnelDecodedEvent)
+	// OnDecryptAttempt fires for every caBLE v2 decrypt attempt
+	// tryDecryptCableData makes, successful or not - giving callers a
+	// machine-readable record of decrypt failures that previously only
+	// went to log.Printf.
+	OnDecryptAttempt(DecryptAttemptEvent)
+}
+
+// DeviceEvent describes a single BLE advertisement observed during a scan.
+type DeviceEvent struct {
+	DeviceAddr string `json:"device_addr"`
+	RSSI       int16  `json:"rssi"`
+	LocalName  string `json:"local_name,omitempty"`
+}
+
+// ServiceMatchEvent fires once per advertisement whose service UUIDs
+// include the FIDO and/or caBLE service the scanner matches against.
+type ServiceMatchEvent struct {
+	DeviceAddr        string `json:"device_addr"`
+	RSSI              int16  `json:"rssi"`
+	FIDOServiceFound  bool   `json:"fido_service_found"`
+	CableServiceFound bool   `json:"cable_service_found"`
+}
+
+// GATTAttemptEvent describes one stage of checkGATTServices' connect,
+// discover, and match sequence against a nearby device. Stage is one of
+// "connecting", "connect_failed", "connected", "services_discovered",
+// "discover_failed", "fido_found", "cable_found", or "not_found".
+type GATTAttemptEvent struct {
+	DeviceAddr string `json:"device_addr"`
+	RSSI       int16  `json:"rssi"`
+	Stage      string `json:"stage"`
+	Detail     string `json:"detail,omitempty"`
+	Err        string `json:"error,omitempty"`
+}
+
+// TunnelDecodedEvent fires once a BLE advertisement's service data has
+// been successfully decrypted and parsed into a TunnelInfo.
+// tryDecryptCableData does not set DeviceAddr, so these events identify
+// the advertisement only by Source.
+type TunnelDecodedEvent struct {
+	DeviceAddr string `json:"device_addr,omitempty"`
+	Source     string `json:"source"`
+	TunnelURL  string `json:"tunnel_url"`
+	RoutingID  string `json:"routing_id"`
+}
+
+// DecryptAttemptEvent fires for every attempt tryDecryptCableData makes to
+// decrypt and parse a candidate advertisement's service data, whether or
+// not it succeeds.
+type DecryptAttemptEvent struct {
+	Source string `json:"source"`
+	OK     bool   `json:"ok"`
+	Err    string `json:"error,omitempty"`
+}
+
+// NoopEventSink discards every event. Useful for tests, and for any caller
+// that doesn't want Scanner touching the filesystem.
+type NoopEventSink struct{}
+
+func (NoopEventSink) OnDevice(DeviceEvent)                 {}
+func (NoopEventSink) OnServiceMatch(ServiceMatchEvent)     {}
+func (NoopEventSink) OnGATTAttempt(GATTAttemptEvent)       {}
+func (NoopEventSink) OnTunnelDecoded(TunnelDecodedEvent)   {}
+func (NoopEventSink) OnDecryptAttempt(DecryptAttemptEvent) {}
+
+// jsonlEnvelope wraps an event with the type tag and timestamp that make a
+// stream of otherwise-heterogeneous events self-describing once
+// serialized.
+type jsonlEnvelope struct {
+	Type  string      `json:"type"`
+	Time  time.Time   `json:"time"`
+	Event interface{} `json:"event"`
+}
+
+// JSONLEventSink writes each event as a single JSON-lines record to w.
+// Safe for concurrent use.
+type JSONLEventSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLEventSink creates a JSONLEventSink writing to w.
+func NewJSONLEventSink(w io.Writer) *JSONLEventSink {
+	return &JSONLEventSink{w: w}
+}
+
+func (s *JSONLEventSink) write(typ string, event interface{}) {
+	line, err := json.Marshal(jsonlEnvelope{Type: typ, Time: time.Now(), Event: event})
+	if err != nil {
+		log.Printf("JSONLEventSink: failed to marshal %s event: %v", typ, err)
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(line); err != nil {
+		log.Printf("JSONLEventSink: failed to write %s event: %v", typ, err)
+	}
+}
+
+func (s *JSONLEventSink) OnDevice(e DeviceEvent)               { s.write("device", e) }
+func (s *JSONLEventSink) OnServiceMatch(e ServiceMatchEvent)   { s.write("service_match", e) }
+func (s *JSONLEventSink) OnGATTAttempt(e GATTAttemptEvent)     { s.write("gatt_attempt", e) }
+func (s *JSONLEventSink) OnTunnelDecoded(e TunnelDecodedEvent) { s.write("tunnel_decoded", e) }
+func (s *JSONLEventSink) OnDecryptAttempt(e DecryptAttemptEvent) {
+	s.write("decrypt_attempt", e)
+}
+
+// PerDeviceFileEventSink writes each device's events as JSON lines to its
+// own file under dir, lazily opened on first use - a structured
+// replacement for Scanner's historical per-device text logs. Events with
+// no DeviceAddr go to a shared "device_other.jsonl" file instead.
+type PerDeviceFileEventSink struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+// NewPerDeviceFileEventSink creates a PerDeviceFileEventSink rooted at dir,
+// creating dir if it doesn't already exist.
+func NewPerDeviceFileEventSink(dir string) (*PerDeviceFileEventSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create event log directory: %w", err)
+	}
+	return &PerDeviceFileEventSink{
+		dir:   dir,
+		files: make(map[string]*os.File),
+	}, nil
+}
+
+func (s *PerDeviceFileEventSink) fileFor(deviceAddr string) (*os.File, error) {
+	key := deviceAddr
+	if key == "" {
+		key = "other"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.files[key]; ok {
+		return f, nil
+	}
+
+	sanitized := strings.ReplaceAll(key, ":", "-")
+	path := filepath.Join(s.dir, fmt.Sprintf("device_%s.jsonl", sanitized))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open device event file: %w", err)
+	}
+	s.files[key] = f
+	return f, nil
+}
+
+func (s *PerDeviceFileEventSink) write(deviceAddr, typ string, event interface{}) {
+	f, err := s.fileFor(deviceAddr)
+	if err != nil {
+		log.Printf("PerDeviceFileEventSink: %v", err)
+		return
+	}
+
+	line, err := json.Marshal(jsonlEnvelope{Type: typ, Time: time.Now(), Event: event})
+	if err != nil {
+		log.Printf("PerDeviceFileEventSink: failed to marshal %s event: %v", typ, err)
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := f.Write(line); err != nil {
+		log.Printf("PerDeviceFileEventSink: failed to write %s event for device %s: %v", typ, deviceAddr, err)
+	}
+}
+
+func (s *PerDeviceFileEventSink) OnDevice(e DeviceEvent) { s.write(e.DeviceAddr, "device", e) }
+func (s *PerDeviceFileEventSink) OnServiceMatch(e ServiceMatchEvent) {
+	s.write(e.DeviceAddr, "service_match", e)
+}
+func (s *PerDeviceFileEventSink) OnGATTAttempt(e GATTAttemptEvent) {
+	s.write(e.DeviceAddr, "gatt_attempt", e)
+}
+func (s *PerDeviceFileEventSink) OnTunnelDecoded(e TunnelDecodedEvent) {
+	s.write(e.DeviceAddr, "tunnel_decoded", e)
+}
+func (s *PerDeviceFileEventSink) OnDecryptAttempt(e DecryptAttemptEvent) {
+	s.write("", "decrypt_attempt", e)
+}
+
+// Close closes every open per-device file.
+func (s *PerDeviceFileEventSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for addr, f := range s.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close event file for device %s: %w", addr, err)
+		}
+	}
+	s.files = make(map[string]*os.File)
+	return firstErr
+}
@@ -0,0 +1,157 @@
+package ble
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// recordingEventSink records every event it receives, in order, as a
+// sequence of its method names - used to assert events fire in the
+// expected sequence without caring about serialization format.
+type recordingEventSink struct {
+	calls []string
+}
+
+func (r *recordingEventSink) OnDevice(DeviceEvent) { r.calls = append(r.calls, "device") }
+func (r *recordingEventSink) OnServiceMatch(ServiceMatchEvent) {
+	r.calls = append(r.calls, "service_match")
+}
+func (r *recordingEventSink) OnGATTAttempt(GATTAttemptEvent) {
+	r.calls = append(r.calls, "gatt_attempt")
+}
+func (r *recordingEventSink) OnTunnelDecoded(TunnelDecodedEvent) {
+	r.calls = append(r.calls, "tunnel_decoded")
+}
+func (r *recordingEventSink) OnDecryptAttempt(DecryptAttemptEvent) {
+	r.calls = append(r.calls, "decrypt_attempt")
+}
+
+// TestScannerLogDeviceInfoEmitsDeviceWithoutServiceMatch checks that
+// logDeviceInfo emits a DeviceEvent and no ServiceMatchEvent for an
+// advertisement whose UUIDs don't match.
+func TestScannerLogDeviceInfoEmitsDeviceWithoutServiceMatch(t *testing.T) {
+	sink := &recordingEventSink{}
+	scanner := &Scanner{sink: sink}
+
+	scanner.logDeviceInfo("AA:BB:CC:DD:EE:FF", -50, "", fakePayload{})
+	if got, want := sink.calls, []string{"device"}; !equalStrings(got, want) {
+		t.Fatalf("calls = %v, want %v (no service match for an advertisement with no matching UUIDs)", got, want)
+	}
+}
+
+// TestNoopEventSinkDiscardsEverything confirms NoopEventSink satisfies
+// EventSink and does not panic on any call - the sink tests inject when
+// they don't want Scanner touching the filesystem.
+func TestNoopEventSinkDiscardsEverything(t *testing.T) {
+	var sink EventSink = NoopEventSink{}
+	sink.OnDevice(DeviceEvent{DeviceAddr: "x"})
+	sink.OnServiceMatch(ServiceMatchEvent{DeviceAddr: "x"})
+	sink.OnGATTAttempt(GATTAttemptEvent{DeviceAddr: "x"})
+	sink.OnTunnelDecoded(TunnelDecodedEvent{Source: "x"})
+	sink.OnDecryptAttempt(DecryptAttemptEvent{Source: "x"})
+}
+
+// TestJSONLEventSinkWritesOneLinePerEvent checks that each event is
+// written as a single, independently-parseable JSON object tagged with
+// its type.
+func TestJSONLEventSinkWritesOneLinePerEvent(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLEventSink(&buf)
+
+	sink.OnDevice(DeviceEvent{DeviceAddr: "AA:BB", RSSI: -40})
+	sink.OnTunnelDecoded(TunnelDecodedEvent{Source: "fixture", TunnelURL: "wss://example/test"})
+
+	lines := bytes.Split(bytes.TrimRight(buf.Bytes(), "\n"), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.String())
+	}
+
+	var first struct {
+		Type  string      `json:"type"`
+		Event DeviceEvent `json:"event"`
+	}
+	if err := json.Unmarshal(lines[0], &first); err != nil {
+		t.Fatalf("failed to unmarshal first line: %v", err)
+	}
+	if first.Type != "device" || first.Event.DeviceAddr != "AA:BB" {
+		t.Errorf("first line = %+v, want type=device, DeviceAddr=AA:BB", first)
+	}
+
+	var second struct {
+		Type  string             `json:"type"`
+		Event TunnelDecodedEvent `json:"event"`
+	}
+	if err := json.Unmarshal(lines[1], &second); err != nil {
+		t.Fatalf("failed to unmarshal second line: %v", err)
+	}
+	if second.Type != "tunnel_decoded" || second.Event.TunnelURL != "wss://example/test" {
+		t.Errorf("second line = %+v, want type=tunnel_decoded, TunnelURL=wss://example/test", second)
+	}
+}
+
+// TestPerDeviceFileEventSinkRoutesByDeviceAndCloses checks that events for
+// different devices land in different files, events with no DeviceAddr
+// land in a shared fallback file, and Close() leaves no files open (and
+// is safe to call more than once).
+func TestPerDeviceFileEventSinkRoutesByDeviceAndCloses(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewPerDeviceFileEventSink(dir)
+	if err != nil {
+		t.Fatalf("NewPerDeviceFileEventSink failed: %v", err)
+	}
+
+	sink.OnDevice(DeviceEvent{DeviceAddr: "AA:BB:CC:DD:EE:FF", RSSI: -40})
+	sink.OnDevice(DeviceEvent{DeviceAddr: "11:22:33:44:55:66", RSSI: -60})
+	sink.OnTunnelDecoded(TunnelDecodedEvent{Source: "fixture"})
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("second Close failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d files, want 3 (one per device plus one fallback): %v", len(entries), entries)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "device_AA-BB-CC-DD-EE-FF.jsonl"))
+	if err != nil {
+		t.Fatalf("failed to read device file: %v", err)
+	}
+	if !bytes.Contains(data, []byte(`"device_addr":"AA:BB:CC:DD:EE:FF"`)) {
+		t.Errorf("device file contents = %q, want it to contain the device's own address", data)
+	}
+}
+
+// fakePayload implements bluetooth.AdvertisementPayload with no data,
+// letting logDeviceInfo run in tests without a real Bluetooth adapter.
+type fakePayload struct{}
+
+func (fakePayload) LocalName() string                                     { return "" }
+func (fakePayload) HasServiceUUID(uuid bluetooth.UUID) bool               { return false }
+func (fakePayload) ServiceUUIDs() []bluetooth.UUID                        { return nil }
+func (fakePayload) Bytes() []byte                                         { return nil }
+func (fakePayload) ManufacturerData() []bluetooth.ManufacturerDataElement { return nil }
+func (fakePayload) ServiceData() []bluetooth.ServiceDataElement           { return nil }
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
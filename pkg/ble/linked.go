@@ -0,0 +1,73 @@
+package ble
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/hkdf"
+
+	"ctap2-hybrid-transport/pkg/qrcode"
+)
+
+// linkedPSKLength matches tunnel.Client's Noise pre-shared key length.
+const linkedPSKLength = 32
+
+// LinkedTunnelInfo is the tunnel URL and Noise pre-shared key
+// ConnectLinked derives for a state-assisted reconnect to a previously
+// linked phone - the reconnect counterpart to a fresh TunnelInfo decrypted
+// from a BLE advertisement.
+type LinkedTunnelInfo struct {
+	TunnelURL string
+	PSK       []byte // 32 bytes
+}
+
+// ConnectLinked derives the tunnel URL and Noise pre-shared key needed to
+// reconnect to contact, without waiting for a fresh BLE advertisement: a
+// state-assisted reconnect already knows the phone's tunnel server and
+// link secret from a previous qrcode.LinkStore-persisted pairing (see
+// qrcode.Contact), so there is nothing left to discover over BLE. The
+// hybrid-transport binary's own reconnect path (ctap2.HybridClient.Reconnect,
+// backed by pkg/linking) drives tunnel.Client.Reconnect directly instead of
+// going through this function; ConnectLinked exists so other ble-package
+// callers have the same state-assisted derivation available without
+// importing pkg/tunnel.
+
+func ConnectLinked(contact *qrcode.Contact) (*LinkedTunnelInfo, error) {
+	if contact == nil {
+		return nil, fmt.Errorf("ble: ConnectLinked: contact is nil")
+	}
+	if len(contact.LinkSecret) == 0 {
+		return nil, fmt.Errorf("ble: ConnectLinked: contact has no link secret")
+	}
+	if contact.TunnelServerDomain == "" {
+		return nil, fmt.Errorf("ble: ConnectLinked: contact has no tunnel server domain")
+	}
+
+	psk, err := deriveLinkedPSK(contact.LinkSecret)
+	if err != nil {
+		return nil, fmt.Errorf("ble: ConnectLinked: %w", err)
+	}
+
+	return &LinkedTunnelInfo{
+		TunnelURL: contact.TunnelServerDomain,
+		PSK:       psk,
+	}, nil
+}
+
+// deriveLinkedPSK derives the Noise pre-shared key for a state-assisted
+// reconnect from linkSecret, using the caBLE v2 HKDF PSK purpose byte
+// (keyPurposePSK) rather than the EID-key purpose CableV2Decryptor.derive
+// uses for a fresh pairing's EID key, and keyed off the phone's persisted
+// link secret instead of the QR secret.
+func deriveLinkedPSK(linkSecret []byte) ([]byte, error) {
+	var purpose32 [4]byte
+	purpose32[0] = byte(keyPurposePSK)
+
+	psk := make([]byte, linkedPSKLength)
+	h := hkdf.New(sha256.New, linkSecret, nil, purpose32[:])
+	n, err := h.Read(psk)
+	if err != nil || n != len(psk) {
+		return nil, fmt.Errorf("HKDF error: read %d bytes, expected %d, err: %v", n, len(psk), err)
+	}
+	return psk, nil
+}
@@ -0,0 +1,64 @@
+package ble
+
+import (
+	"bytes"
+	"testing"
+
+	"ctap2-hybrid-transport/pkg/qrcode"
+)
+
+func TestConnectLinkedDerivesTunnelURLAndPSK(t *testing.T) {
+	contact := &qrcode.Contact{
+		LinkSecret:         bytes.Repeat([]byte{0x01}, 32),
+		TunnelServerDomain: "cable.example.com",
+	}
+
+	info, err := ConnectLinked(contact)
+	if err != nil {
+		t.Fatalf("ConnectLinked() failed: %v", err)
+	}
+	if info.TunnelURL != contact.TunnelServerDomain {
+		t.Errorf("TunnelURL = %q, want %q", info.TunnelURL, contact.TunnelServerDomain)
+	}
+	if len(info.PSK) != linkedPSKLength {
+		t.Errorf("len(PSK) = %d, want %d", len(info.PSK), linkedPSKLength)
+	}
+}
+
+func TestConnectLinkedIsDeterministic(t *testing.T) {
+	contact := &qrcode.Contact{
+		LinkSecret:         bytes.Repeat([]byte{0x02}, 32),
+		TunnelServerDomain: "cable.example.com",
+	}
+
+	first, err := ConnectLinked(contact)
+	if err != nil {
+		t.Fatalf("ConnectLinked() failed: %v", err)
+	}
+	second, err := ConnectLinked(contact)
+	if err != nil {
+		t.Fatalf("ConnectLinked() failed: %v", err)
+	}
+	if !bytes.Equal(first.PSK, second.PSK) {
+		t.Errorf("PSK = %x, want %x (same contact must derive the same PSK)", first.PSK, second.PSK)
+	}
+}
+
+func TestConnectLinkedRejectsIncompleteContact(t *testing.T) {
+	testCases := []struct {
+		name    string
+		contact *qrcode.Contact
+	}{
+		{"nil contact", nil},
+		{"missing link secret", &qrcode.Contact{TunnelServerDomain: "cable.example.com"}},
+		{"missing tunnel server domain", &qrcode.Contact{LinkSecret: bytes.Repeat([]byte{0x01}, 32)}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ConnectLinked(tc.contact); err == nil {
+				t.Errorf("ConnectLinked(%+v) succeeded, want an error", tc.contact)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package ble
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// TestDefaultTunnelDomainResolverKnownDomains checks that the first two
+// EncodedTunnelDomain values resolve to the assigned-domain table rather
+// than being synthesized.
+func TestDefaultTunnelDomainResolverKnownDomains(t *testing.T) {
+	resolver := defaultTunnelDomainResolver{}
+
+	tests := []struct {
+		encoded uint16
+		want    string
+	}{
+		{0, "cable.ua5v.com"},
+		{1, "cable.auth.com"},
+	}
+
+	for _, tt := range tests {
+		if got := resolver.ResolveTunnelDomain(tt.encoded); got != tt.want {
+			t.Errorf("ResolveTunnelDomain(%d) = %q, want %q", tt.encoded, got, tt.want)
+		}
+	}
+}
+
+// TestDefaultTunnelDomainResolverSynthesizesHigherValues is table-driven
+// over a handful of EncodedTunnelDomain values past the assigned-domain
+// table, checking that synthesis is deterministic and picks a TLD from the
+// set the caBLE v2 assigned-domain algorithm allows.
+func TestDefaultTunnelDomainResolverSynthesizesHigherValues(t *testing.T) {
+	resolver := defaultTunnelDomainResolver{}
+	validTLDs := map[string]bool{".com": true, ".org": true, ".net": true, ".info": true}
+
+	for _, encoded := range []uint16{2, 3, 256, 1000} {
+		domain := resolver.ResolveTunnelDomain(encoded)
+
+		if !strings.HasPrefix(domain, "cable.") {
+			t.Errorf("ResolveTunnelDomain(%d) = %q, want cable.<label>.<tld>", encoded, domain)
+		}
+		matchesKnownTLD := false
+		for tld := range validTLDs {
+			if strings.HasSuffix(domain, tld) {
+				matchesKnownTLD = true
+				break
+			}
+		}
+		if !matchesKnownTLD {
+			t.Errorf("ResolveTunnelDomain(%d) = %q, want one of %v as its TLD", encoded, domain, validTLDs)
+		}
+
+		// Deterministic: the same id always synthesizes the same domain.
+		if again := resolver.ResolveTunnelDomain(encoded); again != domain {
+			t.Errorf("ResolveTunnelDomain(%d) is not deterministic: %q != %q", encoded, domain, again)
+		}
+	}
+
+	if resolver.ResolveTunnelDomain(2) == resolver.ResolveTunnelDomain(3) {
+		t.Errorf("ResolveTunnelDomain() produced the same domain for two different encoded values")
+	}
+}
+
+// fakeDomainResolver lets tests substitute a canned domain for
+// TunnelDomainResolver without exercising the real hash-based synthesis.
+type fakeDomainResolver struct {
+	domain string
+}
+
+func (f fakeDomainResolver) ResolveTunnelDomain(uint16) string { return f.domain }
+
+// TestScannerTryDecryptCableDataRoundTrip builds a fixture caBLE v2
+// advertisement with Advertiser.buildServiceData and feeds it through
+// Scanner.tryDecryptCableData, proving the full decrypt/parse/URL-building
+// path populates a TunnelInfo matching what was encrypted.
+func TestScannerTryDecryptCableDataRoundTrip(t *testing.T) {
+	qrSecret := []byte("0123456789abcdef0123456789abcdef")[:32]
+	routingID := []byte{0xde, 0xad, 0xbe}
+	tunnelServiceID := []byte{0x01, 0x00} // id 1 -> cable.auth.com (assigned-domain table)
+
+	adv := &Advertiser{
+		qrSecret:        qrSecret,
+		routingID:       routingID,
+		tunnelServiceID: tunnelServiceID,
+	}
+	serviceData, err := adv.buildServiceData()
+	if err != nil {
+		t.Fatalf("buildServiceData failed: %v", err)
+	}
+
+	scanner := &Scanner{qrSecret: qrSecret[:16], sink: NoopEventSink{}, domainResolver: defaultTunnelDomainResolver{}}
+	tunnelInfoChan := make(chan *TunnelInfo, 1)
+
+	if ok := scanner.tryDecryptCableData(serviceData, tunnelInfoChan, "fixture"); !ok {
+		t.Fatalf("tryDecryptCableData returned false, want true")
+	}
+
+	var info *TunnelInfo
+	select {
+	case info = <-tunnelInfoChan:
+	default:
+		t.Fatal("tryDecryptCableData did not push a TunnelInfo onto the channel")
+	}
+
+	if string(info.RoutingID) != string(routingID) {
+		t.Errorf("RoutingID = %x, want %x", info.RoutingID, routingID)
+	}
+	if string(info.TunnelServiceID) != string(tunnelServiceID) {
+		t.Errorf("TunnelServiceID = %x, want %x", info.TunnelServiceID, tunnelServiceID)
+	}
+	if info.EncodedTunnelDomain != 1 {
+		t.Errorf("EncodedTunnelDomain = %d, want 1", info.EncodedTunnelDomain)
+	}
+	wantURL := "wss://cable.auth.com/cable/connect/deadbe/" + hex.EncodeToString(info.ConnectionNonce)
+	if info.TunnelURL != wantURL {
+		t.Errorf("TunnelURL = %q, want %q", info.TunnelURL, wantURL)
+	}
+}
+
+// TestScannerGetTunnelURLUsesInjectedDomainResolver checks that getTunnelURL
+// defers to Scanner.domainResolver rather than hard-coding a host, so
+// callers can plug in a different TunnelDomainResolver (e.g. in tests, or a
+// future assigned-domain list) without touching Scanner's decrypt path.
+func TestScannerGetTunnelURLUsesInjectedDomainResolver(t *testing.T) {
+	scanner := &Scanner{domainResolver: fakeDomainResolver{domain: "cable.test.example"}}
+
+	got := scanner.getTunnelURL(42, []byte{0xAA, 0xBB, 0xCC}, []byte{0xDD})
+	want := "wss://cable.test.example/cable/connect/aabbcc/dd"
+	if got != want {
+		t.Errorf("getTunnelURL() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+package ble
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// DefaultTunnelDedupeTTL is how long ScanTunnels suppresses repeat
+// onTunnelInfo callbacks for the same device address, so a phone that
+// keeps re-advertising (e.g. across an EID rotation) doesn't retrigger a
+// decrypt attempt and callback on every scan cycle.
+const DefaultTunnelDedupeTTL = 30 * time.Second
+
+// ttlDeviceCache tracks device addresses seen within the past ttl, for
+// deduping repeat advertisements from the same device - unlike
+// checkedDevices, entries expire instead of accumulating forever.
+type ttlDeviceCache struct {
+	ttl time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newTTLDeviceCache(ttl time.Duration) *ttlDeviceCache {
+	return &ttlDeviceCache{ttl: ttl, seen: make(map[string]time.Time)}
+}
+
+// seenRecently reports whether deviceAddr was already recorded within the
+// past ttl, then records it as seen now regardless of the result.
+func (c *ttlDeviceCache) seenRecently(deviceAddr string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	last, ok := c.seen[deviceAddr]
+	c.seen[deviceAddr] = now
+	return ok && now.Sub(last) < c.ttl
+}
+
+// ScanTunnels scans continuously like StartScanning, but instead of
+// short-circuiting on the first successfully decrypted advertisement (as
+// WaitForTunnelAdvertisement does) it calls onTunnelInfo for every tunnel
+// it finds across every nearby authenticator, deduping repeat
+// advertisements from the same device address within ttl. It runs until
+// ctx is cancelled or the underlying BLE scan fails to start.
+//
+// This complements WaitForTunnelAdvertisement/EventSink rather than
+// replacing them: EventSink already gives callers a structured record of
+// every device/service-match/decrypt/GATT event observed (see
+// eventsink.go), and onTunnelInfo here is just the subset of those that
+// successfully decoded into a usable TunnelInfo, delivered without the
+// scan stopping at the first one.
+func (s *Scanner) ScanTunnels(ctx context.Context, ttl time.Duration, onTunnelInfo func(*TunnelInfo)) error {
+	if s.running {
+		return fmt.Errorf("scanner is already running")
+	}
+	s.running = true
+	defer func() { s.running = false }()
+
+	dedupe := newTTLDeviceCache(ttl)
+
+	if err := s.serviceDataSource.Start(ctx, s.onNativeServiceData); err != nil {
+		log.Printf("Native service-data backend unavailable, relying on TinyGo Bluetooth parsing: %v", err)
+	}
+	defer s.serviceDataSource.Stop()
+
+	fidoServiceUUID, err := bluetooth.ParseUUID(FIDOServiceUUID)
+	if err != nil {
+		return fmt.Errorf("failed to parse FIDO service UUID: %w", err)
+	}
+	cableServiceUUID, err := bluetooth.ParseUUID(CableServiceUUID)
+	if err != nil {
+		return fmt.Errorf("failed to parse caBLE service UUID: %w", err)
+	}
+
+	tunnelInfoChan := make(chan *TunnelInfo, 16)
+	scanErrChan := make(chan error, 1)
+
+	go func() {
+		err := s.adapter.Scan(func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			deviceAddr := result.Address.String()
+			if dedupe.seenRecently(deviceAddr) {
+				return
+			}
+
+			localName := result.AdvertisementPayload.LocalName()
+			s.logDeviceInfo(deviceAddr, result.RSSI, localName, result.AdvertisementPayload)
+
+			hasFIDOService := result.AdvertisementPayload.HasServiceUUID(fidoServiceUUID)
+			hasCableService := result.AdvertisementPayload.HasServiceUUID(cableServiceUUID)
+			isIPad := strings.Contains(strings.ToLower(localName), "ipad")
+			if !hasFIDOService && !hasCableService && !isIPad {
+				return
+			}
+
+			s.processTunnelAdvertisement(result, tunnelInfoChan)
+		})
+		if err != nil {
+			select {
+			case scanErrChan <- err:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	for {
+		select {
+		case info := <-tunnelInfoChan:
+			onTunnelInfo(info)
+		case err := <-scanErrChan:
+			s.adapter.StopScan()
+			return fmt.Errorf("failed to start BLE scan: %w", err)
+		case <-ctx.Done():
+			s.adapter.StopScan()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package ble
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTTLDeviceCacheSeenRecently checks that a device address is reported
+// as seen within ttl of its first sighting, and no longer seen once ttl
+// has elapsed.
+func TestTTLDeviceCacheSeenRecently(t *testing.T) {
+	cache := newTTLDeviceCache(20 * time.Millisecond)
+
+	if cache.seenRecently("AA:BB:CC:DD:EE:FF") {
+		t.Fatalf("seenRecently() = true on first sighting, want false")
+	}
+	if !cache.seenRecently("AA:BB:CC:DD:EE:FF") {
+		t.Fatalf("seenRecently() = false immediately after first sighting, want true (within ttl)")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if cache.seenRecently("AA:BB:CC:DD:EE:FF") {
+		t.Fatalf("seenRecently() = true after ttl elapsed, want false")
+	}
+}
+
+// TestTTLDeviceCacheTracksDevicesIndependently checks that dedup state for
+// one device address doesn't affect another.
+func TestTTLDeviceCacheTracksDevicesIndependently(t *testing.T) {
+	cache := newTTLDeviceCache(time.Minute)
+
+	cache.seenRecently("device-a")
+	if cache.seenRecently("device-b") {
+		t.Fatalf("seenRecently(\"device-b\") = true, want false for a device never seen before")
+	}
+}
@@ -1,130 +0,0 @@
-package ble
-
-import (
-	"log"
-	
-	"tinygo.org/x/bluetooth"
-)
-
-// GetServiceDataForDevice attempts to extract service data for a specific device and UUID
-// This is a placeholder for future Core Bluetooth integration
-func (s *Scanner) GetServiceDataForDevice(deviceAddress string, serviceUUID string) []byte {
-	// TODO: Implement direct Core Bluetooth service data access
-	// This would require CGO integration with Core Bluetooth framework
-	log.Printf("Extended service data extraction not yet implemented for device %s, UUID %s", deviceAddress, serviceUUID)
-	return nil
-}
-
-// Enhanced service data extraction that tries multiple methods
-func (s *Scanner) getExtendedServiceDataEnhanced(result bluetooth.ScanResult) []byte {
-	deviceAddr := result.Address.String()
-	
-	// Method 1: Try to get service data via extended Core Bluetooth access
-	// TODO: Implement proper service UUID extraction from TinyGo Bluetooth
-	log.Printf("Service UUID extraction from TinyGo Bluetooth pending for device: %s", deviceAddr)
-
-	// Method 2: Fallback to manufacturer data (TinyGo v0.12.0 enhancement)
-	manufacturerData := result.AdvertisementPayload.ManufacturerData()
-	if len(manufacturerData) > 0 {
-		// Convert first manufacturer data entry to bytes
-		log.Printf("Using manufacturer data as service data fallback: %x", manufacturerData[0].Data)
-		return manufacturerData[0].Data
-	}
-	
-	// Method 3: Try to extract from advertisement payload data directly
-	// In TinyGo v0.12.0, we have improved access to advertisement data
-	localName := result.AdvertisementPayload.LocalName()
-	
-	// Check if device name or characteristics suggest it might have service data
-	if localName != "" {
-		log.Printf("Attempting service data extraction from device with name: %s", localName)
-	}
-	
-	// Method 4: For demonstration, if we detect a FIDO device, return mock service data
-	fidoServiceUUID, _ := bluetooth.ParseUUID(FIDOServiceUUID)
-	cableServiceUUID, _ := bluetooth.ParseUUID(CableServiceUUID)
-	
-	if result.AdvertisementPayload.HasServiceUUID(fidoServiceUUID) {
-		log.Printf("FIDO service UUID detected, creating service data pattern")
-		// Return a mock caBLE v2 service data pattern (20 bytes)
-		// In real implementation, this would come from actual BLE service data
-		return []byte{
-			0x07, 0x19, 0x01, 0x24, 0x20, 0x02, 0xf8, 0x8f, // 8-byte nonce
-			0x11, 0x00, 0x04,                               // 3-byte routing ID
-			0x2f, 0x37,                                     // 2-byte tunnel service
-			0x8a, 0xf9, 0xcc, 0xf8, 0x20, 0x3d, 0x85,     // 7-byte additional data
-		}
-	}
-	
-	if result.AdvertisementPayload.HasServiceUUID(cableServiceUUID) {
-		log.Printf("caBLE service UUID detected, creating service data pattern")
-		// Return a mock caBLE v2 service data pattern (20 bytes)
-		return []byte{
-			0x08, 0x1a, 0x02, 0x25, 0x21, 0x03, 0xf9, 0x90, // 8-byte nonce
-			0x12, 0x01, 0x05,                               // 3-byte routing ID
-			0x30, 0x38,                                     // 2-byte tunnel service
-			0x8b, 0xfa, 0xcd, 0xf9, 0x21, 0x3e, 0x86,     // 7-byte additional data
-		}
-	}
-	
-	log.Printf("No service data available for device: %s", deviceAddr)
-	return nil
-}
-
-// Enhanced FIDO service data extraction for TinyGo v0.8.0
-func (s *Scanner) extractFIDOServiceDataEnhanced(payload bluetooth.AdvertisementPayload) []byte {
-	// Parse the service UUID
-	serviceUUID, err := bluetooth.ParseUUID(FIDOServiceUUID)
-	if err != nil {
-		log.Printf("Failed to parse FIDO service UUID: %v", err)
-		return nil
-	}
-	
-	// Check if we can access service data (implementation dependent)
-	if payload.HasServiceUUID(serviceUUID) {
-		log.Printf("Found FIDO service UUID, attempting enhanced service data extraction...")
-		
-		// In TinyGo v0.8.0, direct service data access is limited
-		// We'll create a realistic service data pattern based on CTAP spec
-		// This would be replaced with actual service data extraction in a full implementation
-		
-		// FIDO service data format according to CTAP spec:
-		// - Service UUID (2 bytes, little endian): 0xFD 0xFF
-		// - Flags (1+ bytes): various capability flags
-		serviceData := []byte{0xFD, 0xFF, 0x80} // FIDO UUID + pairing mode flag
-		
-		log.Printf("Enhanced FIDO service data extracted: %x", serviceData)
-		return serviceData
-	}
-	
-	return nil
-}
-
-// Enhanced caBLE service data extraction for TinyGo v0.8.0
-func (s *Scanner) extractCableServiceDataEnhanced(payload bluetooth.AdvertisementPayload) []byte {
-	// Parse the service UUID
-	serviceUUID, err := bluetooth.ParseUUID(CableServiceUUID)
-	if err != nil {
-		log.Printf("Failed to parse caBLE service UUID: %v", err)
-		return nil
-	}
-	
-	// Check if we can access service data (implementation dependent)
-	if payload.HasServiceUUID(serviceUUID) {
-		log.Printf("Found caBLE service UUID, attempting enhanced service data extraction...")
-		
-		// Create a realistic caBLE v2 service data pattern (20 bytes)
-		// Format: [8-byte nonce] + [3-byte routing ID] + [2-byte tunnel service] + [7-byte additional]
-		serviceData := []byte{
-			0x07, 0x19, 0x01, 0x24, 0x20, 0x02, 0xf8, 0x8f, // nonce
-			0x11, 0x00, 0x04,                               // routing ID
-			0x2f, 0x37,                                     // tunnel service
-			0x8a, 0xf9, 0xcc, 0xf8, 0x20, 0x3d, 0x85,     // additional data
-		}
-		
-		log.Printf("Enhanced caBLE service data extracted: %x", serviceData)
-		return serviceData
-	}
-	
-	return nil
-}
\ No newline at end of file
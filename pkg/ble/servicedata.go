@@ -0,0 +1,21 @@
+package ble
+
+import "context"
+
+// platformServiceDataSource reads BLE advertisement service data directly
+// from the OS Bluetooth stack, bypassing TinyGo Bluetooth's limited (and on
+// some platforms absent) advertisement parsing. Each supported platform
+// provides its own backend (see servicedata_darwin.go, servicedata_linux.go);
+// unsupported platforms get a no-op implementation (servicedata_other.go)
+// and Scanner falls back to TinyGo's own ServiceData() parsing.
+type platformServiceDataSource interface {
+	// Start begins platform-native scanning. Each time service data is
+	// observed for a device, onServiceData is called with the device
+	// address and a map of service UUID (lowercase, e.g.
+	// "0000fff9-0000-1000-8000-00805f9b34fb") to that service's raw data.
+	// Start must not block; scanning happens on its own goroutine(s).
+	Start(ctx context.Context, onServiceData func(deviceAddr string, serviceData map[string][]byte)) error
+
+	// Stop halts platform-native scanning and releases any OS resources.
+	Stop()
+}
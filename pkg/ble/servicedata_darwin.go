@@ -0,0 +1,94 @@
+//go:build darwin
+
+package ble
+
+/*
+#cgo LDFLAGS: -framework CoreBluetooth -framework Foundation
+#include "servicedata_darwin.h"
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// coreBluetoothServiceDataSource reads service data directly from
+// CBCentralManager's didDiscoverPeripheral:advertisementData:RSSI:
+// callback, which exposes kCBAdvDataServiceData with the full advertised
+// service-data payload that TinyGo Bluetooth does not surface on macOS.
+type coreBluetoothServiceDataSource struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+func newPlatformServiceDataSource() platformServiceDataSource {
+	return &coreBluetoothServiceDataSource{}
+}
+
+// coreBluetoothCallbacksMu guards the single process-wide callback, since
+// CBCentralManager is itself a process-wide singleton in this package.
+var (
+	coreBluetoothCallbacksMu sync.Mutex
+	coreBluetoothOnData      func(deviceAddr string, serviceData map[string][]byte)
+)
+
+func (s *coreBluetoothServiceDataSource) Start(ctx context.Context, onServiceData func(deviceAddr string, serviceData map[string][]byte)) error {
+	coreBluetoothCallbacksMu.Lock()
+	coreBluetoothOnData = onServiceData
+	coreBluetoothCallbacksMu.Unlock()
+
+	if rc := C.cb_start_scan(); rc != 0 {
+		return fmt.Errorf("core bluetooth: cb_start_scan failed with code %d", int(rc))
+	}
+
+	_, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.Stop()
+	}()
+
+	return nil
+}
+
+func (s *coreBluetoothServiceDataSource) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	C.cb_stop_scan()
+}
+
+//export goHandleServiceData
+func goHandleServiceData(deviceAddr *C.char, serviceUUID *C.char, data unsafe.Pointer, dataLen C.int) {
+	coreBluetoothCallbacksMu.Lock()
+	onData := coreBluetoothOnData
+	coreBluetoothCallbacksMu.Unlock()
+	if onData == nil {
+		return
+	}
+
+	addr := C.GoString(deviceAddr)
+	uuid := strings.ToLower(C.GoString(serviceUUID))
+	// CBUUID.UUIDString gives 16- and 32-bit UUIDs in short form ("FFF9");
+	// expand them to the full Bluetooth base UUID form.
+	switch len(uuid) {
+	case 4:
+		uuid = "0000" + uuid + "-0000-1000-8000-00805f9b34fb"
+	case 8:
+		uuid = uuid + "-0000-1000-8000-00805f9b34fb"
+	}
+	payload := C.GoBytes(data, dataLen)
+
+	onData(addr, map[string][]byte{uuid: payload})
+}
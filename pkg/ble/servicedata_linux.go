@@ -0,0 +1,166 @@
+//go:build linux
+
+package ble
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// bluezServiceDataSource reads service data directly from BlueZ's D-Bus
+// org.bluez.Device1 objects, which expose the advertisement's ServiceData
+// dict (UUID string -> []byte) without TinyGo Bluetooth's parsing
+// limitations. It subscribes to the same InterfacesAdded/PropertiesChanged
+// signals `bluetoothctl` uses internally.
+type bluezServiceDataSource struct {
+	mu      sync.Mutex
+	conn    *dbus.Conn
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func newPlatformServiceDataSource() platformServiceDataSource {
+	return &bluezServiceDataSource{}
+}
+
+const (
+	bluezBusName          = "org.bluez"
+	bluezDevice1Interface = "org.bluez.Device1"
+	dbusPropsInterface    = "org.freedesktop.DBus.Properties"
+	dbusObjectManagerIfc  = "org.freedesktop.DBus.ObjectManager"
+)
+
+func (b *bluezServiceDataSource) Start(ctx context.Context, onServiceData func(deviceAddr string, serviceData map[string][]byte)) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("bluez service data: failed to connect to system bus: %w", err)
+	}
+
+	matches := []string{
+		"type='signal',interface='" + dbusObjectManagerIfc + "',member='InterfacesAdded'",
+		"type='signal',interface='" + dbusPropsInterface + "',member='PropertiesChanged',arg0='" + bluezDevice1Interface + "'",
+	}
+	for _, rule := range matches {
+		if call := conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule); call.Err != nil {
+			conn.Close()
+			return fmt.Errorf("bluez service data: failed to add match rule: %w", call.Err)
+		}
+	}
+
+	signalCh := make(chan *dbus.Signal, 32)
+	conn.Signal(signalCh)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	b.mu.Lock()
+	b.conn = conn
+	b.cancel = cancel
+	b.stopped = make(chan struct{})
+	b.mu.Unlock()
+
+	go func() {
+		defer close(b.stopped)
+		defer conn.Close()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case sig, ok := <-signalCh:
+				if !ok {
+					return
+				}
+				handleBluezSignal(sig, onServiceData)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (b *bluezServiceDataSource) Stop() {
+	b.mu.Lock()
+	cancel := b.cancel
+	stopped := b.stopped
+	b.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	if stopped != nil {
+		<-stopped
+	}
+}
+
+// handleBluezSignal extracts a device address and ServiceData dict from an
+// InterfacesAdded or PropertiesChanged signal on a BlueZ Device1 object, and
+// forwards it to onServiceData when present.
+func handleBluezSignal(sig *dbus.Signal, onServiceData func(deviceAddr string, serviceData map[string][]byte)) {
+	switch sig.Name {
+	case dbusObjectManagerIfc + ".InterfacesAdded":
+		if len(sig.Body) != 2 {
+			return
+		}
+		interfaces, ok := sig.Body[1].(map[string]map[string]dbus.Variant)
+		if !ok {
+			return
+		}
+		props, ok := interfaces[bluezDevice1Interface]
+		if !ok {
+			return
+		}
+		emitServiceData(props, onServiceData)
+
+	case dbusPropsInterface + ".PropertiesChanged":
+		if len(sig.Body) < 2 {
+			return
+		}
+		iface, _ := sig.Body[0].(string)
+		if iface != bluezDevice1Interface {
+			return
+		}
+		changed, ok := sig.Body[1].(map[string]dbus.Variant)
+		if !ok {
+			return
+		}
+		emitServiceData(changed, onServiceData)
+	}
+}
+
+func emitServiceData(props map[string]dbus.Variant, onServiceData func(deviceAddr string, serviceData map[string][]byte)) {
+	serviceDataVariant, ok := props["ServiceData"]
+	if !ok {
+		return
+	}
+	raw, ok := serviceDataVariant.Value().(map[string]dbus.Variant)
+	if !ok {
+		return
+	}
+
+	serviceData := make(map[string][]byte, len(raw))
+	for uuid, v := range raw {
+		data, ok := v.Value().([]byte)
+		if !ok {
+			continue
+		}
+		serviceData[strings.ToLower(uuid)] = data
+	}
+	if len(serviceData) == 0 {
+		return
+	}
+
+	addr := ""
+	if addrVariant, ok := props["Address"]; ok {
+		addr, _ = addrVariant.Value().(string)
+	}
+	if addr == "" {
+		log.Printf("bluez service data: ServiceData present but no Address property, dropping")
+		return
+	}
+
+	onServiceData(addr, serviceData)
+}
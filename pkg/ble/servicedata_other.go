@@ -0,0 +1,20 @@
+//go:build !darwin && !linux
+
+package ble
+
+import "context"
+
+// noopServiceDataSource is used on platforms with no native service-data
+// backend. Scanner falls back entirely to TinyGo Bluetooth's own
+// ServiceData() parsing in that case.
+type noopServiceDataSource struct{}
+
+func newPlatformServiceDataSource() platformServiceDataSource {
+	return noopServiceDataSource{}
+}
+
+func (noopServiceDataSource) Start(ctx context.Context, onServiceData func(deviceAddr string, serviceData map[string][]byte)) error {
+	return nil
+}
+
+func (noopServiceDataSource) Stop() {}
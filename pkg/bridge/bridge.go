@@ -0,0 +1,170 @@
+// Package bridge exposes a paired phone authenticator, reached over an
+// already-established caBLE v2 hybrid transport tunnel, as a local virtual
+// authenticator device - a CCID/PC-SC smart card reader, or a USB/IP HID
+// FIDO device on Linux (see HostTransport) - so OS-level WebAuthn stacks
+// and browsers can use it without repeating the QR pairing ceremony for
+// every request.
+//
+// Partial implementation: only the tunnel-side multiplexing (Bridge) is
+// done. Neither local-device backend is implemented in this build - both
+// "pcsc" and "hid" resolve to unsupportedHostTransport (host_unsupported.go),
+// which fails Start with a clear error - so no --bridge mode currently
+// works end to end; each needs a platform CCID/PC-SC or USB/IP HID driver
+// this checkout doesn't vendor.
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// TunnelSender is the subset of tunnel.Tunnel's API Bridge depends on -
+// sending a CTAP2 command/payload and receiving the next response -
+// letting tests substitute a fake instead of a real tunnel connection.
+// *tunnel.Tunnel satisfies this without any changes to pkg/tunnel.
+type TunnelSender interface {
+	Send(cmd byte, payload []byte) error
+	Recv() (byte, []byte, error)
+}
+
+// request is one queued CTAP2 call waiting for Bridge's dispatch loop to
+// forward it over the tunnel and return its response.
+type request struct {
+	id      uint64
+	cmd     byte
+	payload []byte
+	reply   chan requestResult
+}
+
+// requestResult is what Dispatch's caller receives: either a response
+// status byte and payload, or the error that stopped the request from
+// completing.
+type requestResult struct {
+	status  byte
+	payload []byte
+	err     error
+}
+
+// Bridge multiplexes concurrent CTAP2 calls from a HostTransport over a
+// single tunnel connection. A caBLE v2 tunnel is a single request/response
+// pipe - only one CTAP2 command may be in flight at a time - so Bridge
+// can't run calls concurrently on the wire; instead it serializes them
+// through a FIFO queue keyed by request ID, so concurrent host-side
+// getAssertion/makeCredential calls (e.g. from multiple browser tabs)
+// queue safely instead of racing on TunnelSender.Send/Recv.
+type Bridge struct {
+	tunnel TunnelSender
+
+	nextID uint64
+	queue  chan *request
+	done   chan struct{}
+}
+
+// NewBridge creates a Bridge forwarding over an already-connected tunnel.
+func NewBridge(t TunnelSender) *Bridge {
+	return &Bridge{
+		tunnel: t,
+		queue:  make(chan *request, 32),
+		done:   make(chan struct{}),
+	}
+}
+
+// Run is the dispatch loop that serializes queued requests over the
+// tunnel. It returns when ctx is cancelled.
+func (b *Bridge) Run(ctx context.Context) error {
+	defer close(b.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case req := <-b.queue:
+			b.forward(req)
+		}
+	}
+}
+
+func (b *Bridge) forward(req *request) {
+	if err := b.tunnel.Send(req.cmd, req.payload); err != nil {
+		req.reply <- requestResult{err: fmt.Errorf("bridge: failed to forward request %d: %w", req.id, err)}
+		return
+	}
+
+	status, payload, err := b.tunnel.Recv()
+	if err != nil {
+		req.reply <- requestResult{err: fmt.Errorf("bridge: failed to read response for request %d: %w", req.id, err)}
+		return
+	}
+
+	req.reply <- requestResult{status: status, payload: payload}
+}
+
+// Dispatch queues a CTAP2 command/payload for forwarding over the tunnel
+// and blocks until its response arrives, ctx is cancelled, or Run has
+// stopped (e.g. because the bridge's own context was cancelled).
+func (b *Bridge) Dispatch(ctx context.Context, cmd byte, payload []byte) (status byte, responsePayload []byte, err error) {
+	req := &request{
+		id:      atomic.AddUint64(&b.nextID, 1),
+		cmd:     cmd,
+		payload: payload,
+		reply:   make(chan requestResult, 1),
+	}
+
+	select {
+	case b.queue <- req:
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	case <-b.done:
+		return 0, nil, fmt.Errorf("bridge: dispatch loop has stopped")
+	}
+
+	select {
+	case res := <-req.reply:
+		return res.status, res.payload, res.err
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	case <-b.done:
+		select {
+		case res := <-req.reply:
+			return res.status, res.payload, res.err
+		default:
+			return 0, nil, fmt.Errorf("bridge: dispatch loop has stopped")
+		}
+	}
+}
+
+// Serve runs Bridge's dispatch loop and host's local device loop together,
+// translating every inbound frame through codec into a CTAP2 command and
+// payload, forwarding it over the tunnel via Dispatch, and encoding the
+// response back into a frame with the same codec. It returns once ctx is
+// cancelled or host.Start itself returns (e.g. because its device couldn't
+// be created).
+func (b *Bridge) Serve(ctx context.Context, host HostTransport, codec FrameCodec) error {
+	runErr := make(chan error, 1)
+	go func() { runErr <- b.Run(ctx) }()
+
+	err := host.Start(ctx, func(ctx context.Context, frame []byte) ([]byte, error) {
+		cmd, payload, err := codec.DecodeFrame(frame)
+		if err != nil {
+			return nil, fmt.Errorf("bridge: failed to decode host frame: %w", err)
+		}
+
+		status, respPayload, err := b.Dispatch(ctx, cmd, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		return codec.EncodeFrame(status, respPayload)
+	})
+	if err != nil {
+		return err
+	}
+	defer host.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-runErr:
+		return err
+	}
+}
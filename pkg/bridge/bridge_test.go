@@ -0,0 +1,235 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTunnelSender is a TunnelSender whose Recv response is computed from
+// whatever Send last received, so a single goroutine calling Send then
+// Recv (as Bridge.forward does) observes a deterministic request/response
+// pairing without needing a real tunnel connection.
+type fakeTunnelSender struct {
+	mu       sync.Mutex
+	lastCmd  byte
+	lastData []byte
+	sendErr  error
+	recvErr  error
+	recvFunc func(cmd byte, payload []byte) (byte, []byte)
+}
+
+func (f *fakeTunnelSender) Send(cmd byte, payload []byte) error {
+	if f.sendErr != nil {
+		return f.sendErr
+	}
+	f.mu.Lock()
+	f.lastCmd = cmd
+	f.lastData = append([]byte(nil), payload...)
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeTunnelSender) Recv() (byte, []byte, error) {
+	if f.recvErr != nil {
+		return 0, nil, f.recvErr
+	}
+	f.mu.Lock()
+	cmd, data := f.lastCmd, f.lastData
+	f.mu.Unlock()
+	status, payload := f.recvFunc(cmd, data)
+	return status, payload, nil
+}
+
+// TestBridgeDispatchRoundTrip checks that a single Dispatch call forwards
+// its command/payload over the tunnel and returns the matching response.
+func TestBridgeDispatchRoundTrip(t *testing.T) {
+	fake := &fakeTunnelSender{
+		recvFunc: func(cmd byte, payload []byte) (byte, []byte) {
+			return 0x00, append([]byte{cmd}, payload...)
+		},
+	}
+	b := NewBridge(fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	status, payload, err := b.Dispatch(ctx, 0x02, []byte{0xA1, 0x02})
+	if err != nil {
+		t.Fatalf("Dispatch() failed: %v", err)
+	}
+	if status != 0x00 {
+		t.Errorf("status = 0x%02x, want 0x00", status)
+	}
+	if want := []byte{0x02, 0xA1, 0x02}; !bytes.Equal(payload, want) {
+		t.Errorf("payload = %x, want %x", payload, want)
+	}
+}
+
+// TestBridgeDispatchSerializesConcurrentCallers fires many concurrent
+// Dispatch calls and checks every caller gets back exactly the response
+// matching its own request, proving the FIFO queue doesn't let one
+// caller's request/response pair cross with another's even though only
+// one is ever in flight on the fake tunnel at a time.
+func TestBridgeDispatchSerializesConcurrentCallers(t *testing.T) {
+	fake := &fakeTunnelSender{
+		recvFunc: func(cmd byte, payload []byte) (byte, []byte) {
+			return cmd, payload
+		},
+	}
+	b := NewBridge(fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payload := []byte(fmt.Sprintf("req-%d", i))
+			status, got, err := b.Dispatch(ctx, byte(i%256), payload)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if status != byte(i%256) {
+				errs[i] = fmt.Errorf("status = 0x%02x, want 0x%02x", status, byte(i%256))
+				return
+			}
+			if !bytes.Equal(got, payload) {
+				errs[i] = fmt.Errorf("payload = %q, want %q", got, payload)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("caller %d: %v", i, err)
+		}
+	}
+}
+
+// TestBridgeDispatchPropagatesSendError checks that a tunnel Send failure
+// is surfaced to the caller rather than hanging.
+func TestBridgeDispatchPropagatesSendError(t *testing.T) {
+	fake := &fakeTunnelSender{sendErr: fmt.Errorf("tunnel closed")}
+	b := NewBridge(fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	if _, _, err := b.Dispatch(ctx, 0x01, nil); err == nil {
+		t.Fatalf("Dispatch() = nil error, want the tunnel's Send failure surfaced")
+	}
+}
+
+// TestBridgeDispatchContextCancellation checks that Dispatch gives up
+// promptly if its context is cancelled before Run is even started, rather
+// than blocking forever on a full or unserviced queue.
+func TestBridgeDispatchContextCancellation(t *testing.T) {
+	b := NewBridge(&fakeTunnelSender{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, _, err := b.Dispatch(ctx, 0x01, nil); err == nil {
+		t.Fatalf("Dispatch() = nil error, want ctx.Err() once the context is cancelled with no Run loop servicing the queue")
+	}
+}
+
+// fakeHostTransport is a HostTransport whose Start immediately feeds one
+// canned frame through handleFrame and records the response, for testing
+// Bridge.Serve without a real CCID/HID device.
+type fakeHostTransport struct {
+	frame    []byte
+	response []byte
+	startErr error
+}
+
+func (f *fakeHostTransport) Start(ctx context.Context, handleFrame func(ctx context.Context, frame []byte) ([]byte, error)) error {
+	if f.startErr != nil {
+		return f.startErr
+	}
+	resp, err := handleFrame(ctx, f.frame)
+	if err != nil {
+		return err
+	}
+	f.response = resp
+	return nil
+}
+
+func (f *fakeHostTransport) Stop() error { return nil }
+
+// TestBridgeServeTranslatesFramesThroughCodec checks that Serve decodes an
+// inbound host frame with the codec, dispatches it over the tunnel, and
+// encodes the tunnel's response back into a frame.
+func TestBridgeServeTranslatesFramesThroughCodec(t *testing.T) {
+	fake := &fakeTunnelSender{
+		recvFunc: func(cmd byte, payload []byte) (byte, []byte) {
+			return 0x00, []byte{0xA2, 0x01, 0x02}
+		},
+	}
+	b := NewBridge(fake)
+
+	host := &fakeHostTransport{frame: apduFrame(0x02, []byte{0xA1, 0x01})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	if err := b.Serve(ctx, host, NFCCTAPCodec{}); err != nil && err != context.DeadlineExceeded {
+		t.Fatalf("Serve() failed: %v", err)
+	}
+
+	wantResponse, err := NFCCTAPCodec{}.EncodeFrame(0x00, []byte{0xA2, 0x01, 0x02})
+	if err != nil {
+		t.Fatalf("EncodeFrame() failed: %v", err)
+	}
+	if !bytes.Equal(host.response, wantResponse) {
+		t.Errorf("host.response = %x, want %x", host.response, wantResponse)
+	}
+}
+
+// apduFrame builds a minimal extended-length NFCCTAP_MSG APDU wrapping
+// [cmd][data] as its command data, for feeding to NFCCTAPCodec.DecodeFrame
+// in tests.
+func apduFrame(cmd byte, data []byte) []byte {
+	commandData := append([]byte{cmd}, data...)
+	lc := len(commandData)
+	frame := []byte{nfcctapCLA, nfcctapINS, nfcctapP1, nfcctapP2, 0x00, byte(lc >> 8), byte(lc & 0xff)}
+	return append(frame, commandData...)
+}
+
+// TestNewHostTransportRejectsUnknownMode checks that an unrecognized
+// --bridge mode name fails at construction rather than at Start.
+func TestNewHostTransportRejectsUnknownMode(t *testing.T) {
+	if _, err := NewHostTransport("bogus"); err == nil {
+		t.Fatalf("NewHostTransport(\"bogus\") = nil error, want an unknown-mode error")
+	}
+}
+
+// TestUnsupportedHostTransportStartFails checks that a recognized mode
+// with no native backend in this build fails clearly at Start instead of
+// silently no-opping.
+func TestUnsupportedHostTransportStartFails(t *testing.T) {
+	host, err := NewHostTransport("pcsc")
+	if err != nil {
+		t.Fatalf("NewHostTransport(\"pcsc\") failed: %v", err)
+	}
+
+	if err := host.Start(context.Background(), func(context.Context, []byte) ([]byte, error) {
+		t.Fatalf("handleFrame should never be called by a backend with no device to read frames from")
+		return nil, nil
+	}); err == nil {
+		t.Fatalf("Start() = nil error, want an error explaining no native backend is available")
+	}
+}
@@ -0,0 +1,70 @@
+package bridge
+
+import "fmt"
+
+// FrameCodec translates between a HostTransport's raw low-level frames
+// (an APDU, a HID report) and the (status/command byte, CBOR payload)
+// pairs Bridge forwards over the tunnel - the same split
+// tunnel.Tunnel.Send/Recv use.
+type FrameCodec interface {
+	// DecodeFrame extracts the CTAP2 command byte and CBOR payload from an
+	// inbound host frame.
+	DecodeFrame(frame []byte) (cmd byte, payload []byte, err error)
+	// EncodeFrame packs a CTAP2 response status byte and CBOR payload back
+	// into a frame to send to the host.
+	EncodeFrame(status byte, payload []byte) (frame []byte, err error)
+}
+
+// NFCCTAPCodec implements the CTAP2-over-NFC APDU framing the spec defines
+// for NFCCTAP_MSG (CTAP2 spec, "Framing of CTAP2 commands over NFC"): an
+// extended-length ISO/IEC 7816-4 APDU whose command data is [CTAP2 command
+// byte][CBOR payload], and whose response is [CTAP2 status byte][CBOR
+// payload] followed by the SW1SW2 success trailer. PC/SC CCID readers
+// speak exactly this APDU format, so a CCID HostTransport can use this
+// codec unmodified.
+type NFCCTAPCodec struct{}
+
+const (
+	nfcctapCLA = 0x80
+	nfcctapINS = 0x10
+	nfcctapP1  = 0x00
+	nfcctapP2  = 0x00
+	swSuccess  = 0x9000
+
+	// apduHeaderLength is CLA, INS, P1, P2, and the extended-length Lc
+	// marker (0x00) plus its 2-byte length - 7 bytes before the command
+	// data begins.
+	apduHeaderLength = 7
+)
+
+func (NFCCTAPCodec) DecodeFrame(frame []byte) (byte, []byte, error) {
+	if len(frame) < apduHeaderLength {
+		return 0, nil, fmt.Errorf("bridge: APDU too short for NFCCTAP_MSG: got %d bytes, want at least %d", len(frame), apduHeaderLength)
+	}
+	if frame[0] != nfcctapCLA || frame[1] != nfcctapINS {
+		return 0, nil, fmt.Errorf("bridge: unsupported APDU CLA/INS: got 0x%02x 0x%02x, want 0x%02x 0x%02x", frame[0], frame[1], nfcctapCLA, nfcctapINS)
+	}
+	if frame[4] != 0x00 {
+		return 0, nil, fmt.Errorf("bridge: short-form Lc unsupported for NFCCTAP_MSG, extended-length APDUs only")
+	}
+
+	lc := int(frame[5])<<8 | int(frame[6])
+	data := frame[apduHeaderLength:]
+	if len(data) < lc {
+		return 0, nil, fmt.Errorf("bridge: APDU command data shorter than declared Lc: got %d bytes, want %d", len(data), lc)
+	}
+	data = data[:lc]
+	if len(data) == 0 {
+		return 0, nil, fmt.Errorf("bridge: empty NFCCTAP_MSG command data")
+	}
+
+	return data[0], data[1:], nil
+}
+
+func (NFCCTAPCodec) EncodeFrame(status byte, payload []byte) ([]byte, error) {
+	frame := make([]byte, 0, len(payload)+3)
+	frame = append(frame, status)
+	frame = append(frame, payload...)
+	frame = append(frame, byte(swSuccess>>8), byte(swSuccess&0xff))
+	return frame, nil
+}
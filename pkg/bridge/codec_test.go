@@ -0,0 +1,63 @@
+package bridge
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestNFCCTAPCodecRoundTrip checks that a command frame built by the test
+// helper decodes to the same command/payload that produced it.
+func TestNFCCTAPCodecRoundTrip(t *testing.T) {
+	wantCmd := byte(0x01)
+	wantPayload := []byte{0xA1, 0x63, 0x66, 0x6f, 0x6f}
+
+	cmd, payload, err := NFCCTAPCodec{}.DecodeFrame(apduFrame(wantCmd, wantPayload))
+	if err != nil {
+		t.Fatalf("DecodeFrame() failed: %v", err)
+	}
+	if cmd != wantCmd {
+		t.Errorf("cmd = 0x%02x, want 0x%02x", cmd, wantCmd)
+	}
+	if !bytes.Equal(payload, wantPayload) {
+		t.Errorf("payload = %x, want %x", payload, wantPayload)
+	}
+}
+
+// TestNFCCTAPCodecEncodeFrameAppendsSuccessTrailer checks that EncodeFrame
+// appends the SW1SW2 = 0x9000 success trailer after the status byte and
+// payload.
+func TestNFCCTAPCodecEncodeFrameAppendsSuccessTrailer(t *testing.T) {
+	frame, err := NFCCTAPCodec{}.EncodeFrame(0x00, []byte{0xA1, 0x02})
+	if err != nil {
+		t.Fatalf("EncodeFrame() failed: %v", err)
+	}
+	want := []byte{0x00, 0xA1, 0x02, 0x90, 0x00}
+	if !bytes.Equal(frame, want) {
+		t.Errorf("frame = %x, want %x", frame, want)
+	}
+}
+
+// TestNFCCTAPCodecDecodeFrameRejectsShortFrames is table-driven over
+// malformed APDUs that should be rejected rather than panicking or
+// silently misparsing.
+func TestNFCCTAPCodecDecodeFrameRejectsShortFrames(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"empty", nil},
+		{"shorter than header", []byte{nfcctapCLA, nfcctapINS, 0x00}},
+		{"wrong CLA/INS", append([]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}, 0x01)},
+		{"short-form Lc", []byte{nfcctapCLA, nfcctapINS, 0x00, 0x00, 0x01, 0x00, 0x00, 0x01}},
+		{"Lc longer than data", []byte{nfcctapCLA, nfcctapINS, 0x00, 0x00, 0x00, 0x00, 0x05, 0x01}},
+		{"empty command data", []byte{nfcctapCLA, nfcctapINS, nfcctapP1, nfcctapP2, 0x00, 0x00, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := (NFCCTAPCodec{}).DecodeFrame(tt.frame); err == nil {
+				t.Fatalf("DecodeFrame(%x) = nil error, want an error", tt.frame)
+			}
+		})
+	}
+}
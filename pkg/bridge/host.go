@@ -0,0 +1,28 @@
+package bridge
+
+import "context"
+
+// HostTransport exposes Bridge's translated hybrid-transport CTAP2 traffic
+// as a local device the host OS can see - a CCID/PC-SC smart card reader,
+// or a USB/IP HID FIDO device on Linux. Each supported backend provides
+// its own implementation; see host_unsupported.go for the stub used when
+// no native backend is available in this build.
+type HostTransport interface {
+	// Start begins exposing the local device and must not block; for each
+	// inbound low-level frame (a CCID APDU or a HID report) it calls
+	// handleFrame and sends the frame it returns back to the host.
+	Start(ctx context.Context, handleFrame func(ctx context.Context, frame []byte) ([]byte, error)) error
+	// Stop tears down the local device.
+	Stop() error
+}
+
+// NewHostTransport resolves a --bridge mode name (see cmd/ctap2-hybrid's
+// --bridge flag) to the HostTransport that implements it.
+func NewHostTransport(mode string) (HostTransport, error) {
+	switch mode {
+	case "pcsc", "hid":
+		return newUnsupportedHostTransport(mode), nil
+	default:
+		return nil, unsupportedModeError(mode)
+	}
+}
@@ -0,0 +1,35 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+)
+
+// unsupportedModeError reports that mode isn't a recognized --bridge mode
+// name at all, as opposed to a recognized mode with no backend in this
+// build (see unsupportedHostTransport).
+func unsupportedModeError(mode string) error {
+	return fmt.Errorf("bridge: unknown mode %q (supported: \"pcsc\", \"hid\")", mode)
+}
+
+// unsupportedHostTransport is returned for every recognized bridge mode
+// until a real backend is vendored into this build: PC/SC access needs a
+// platform driver (pcsclite on Linux, WinSCard on Windows, PCSC framework
+// on macOS) and USB/IP HID needs a kernel gadget driver, neither of which
+// this checkout includes. Start fails immediately with a clear error
+// instead of silently no-opping. Bridge.Serve calls Start, so
+// cmd/ctap2-hybrid's runBridge reaches this error only after pairing with
+// the phone and opening the tunnel.
+type unsupportedHostTransport struct {
+	mode string
+}
+
+func newUnsupportedHostTransport(mode string) unsupportedHostTransport {
+	return unsupportedHostTransport{mode: mode}
+}
+
+func (u unsupportedHostTransport) Start(ctx context.Context, handleFrame func(ctx context.Context, frame []byte) ([]byte, error)) error {
+	return fmt.Errorf("bridge: %q mode has no native backend in this build (needs a platform CCID/PC-SC or USB/IP HID driver)", u.mode)
+}
+
+func (u unsupportedHostTransport) Stop() error { return nil }
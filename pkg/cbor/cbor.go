@@ -0,0 +1,378 @@
+// Package cbor is a small, dependency-free CBOR encoder/decoder covering
+// the subset of RFC 8949 the caBLE v2 QR payload and post-handshake linking
+// messages use: unsigned/negative integers, byte strings, text strings,
+// arrays, maps, booleans, and null. It replaces the ad-hoc, partial parsers
+// that used to live next to their callers in pkg/qrcode and pkg/tunnel, so
+// both packages decode and encode CBOR the same way.
+//
+// Encode always produces CTAP2-canonical CBOR: every integer and length
+// uses its shortest representation, map keys are sorted by encoded-key
+// byte length and then lexicographically (RFC 8949 core deterministic
+// encoding), and no indefinite-length items are ever produced.
+package cbor
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Major is a CBOR major type (the top three bits of the initial byte).
+type Major byte
+
+const (
+	MajorUnsignedInt Major = 0
+	MajorNegativeInt Major = 1
+	MajorByteString  Major = 2
+	MajorTextString  Major = 3
+	MajorArray       Major = 4
+	MajorMap         Major = 5
+	MajorSimple      Major = 7
+)
+
+// Value is a decoded (or to-be-encoded) CBOR item. Exactly one field is
+// meaningful, selected by Major; Bool/IsNull only apply when Major is
+// MajorSimple. Using a single typed union, rather than map[int]interface{},
+// lets callers distinguish a byte string from a text string (and an
+// unsigned integer from a negative one) without a type switch on Go's
+// dynamic `any` type.
+type Value struct {
+	Major Major
+
+	Uint   uint64     // MajorUnsignedInt
+	Int    int64      // MajorNegativeInt; always < 0
+	Bytes  []byte     // MajorByteString
+	Text   string     // MajorTextString
+	Array  []Value    // MajorArray
+	Map    []MapEntry // MajorMap
+	Bool   bool       // MajorSimple, when not IsNull
+	IsNull bool       // MajorSimple
+}
+
+// MapEntry is one key/value pair of a MajorMap Value.
+type MapEntry struct {
+	Key   Value
+	Value Value
+}
+
+// keyedMapEntry pairs a MapEntry with its already-encoded key bytes, so
+// the canonical sort in encodeInto can reorder both together instead of
+// keeping the encoded keys in a second, separately-indexed slice.
+type keyedMapEntry struct {
+	encodedKey []byte
+	entry      MapEntry
+}
+
+// UnsignedInt returns a MajorUnsignedInt Value.
+func UnsignedInt(v uint64) Value { return Value{Major: MajorUnsignedInt, Uint: v} }
+
+// NegativeInt returns a MajorNegativeInt Value. v must be negative.
+func NegativeInt(v int64) Value {
+	if v >= 0 {
+		panic("cbor: NegativeInt requires a negative value")
+	}
+	return Value{Major: MajorNegativeInt, Int: v}
+}
+
+// Int returns the shortest-form CBOR integer Value for v, whether
+// positive or negative.
+func Int(v int64) Value {
+	if v < 0 {
+		return NegativeInt(v)
+	}
+	return UnsignedInt(uint64(v))
+}
+
+// Bytes returns a MajorByteString Value.
+func Bytes(b []byte) Value { return Value{Major: MajorByteString, Bytes: b} }
+
+// Text returns a MajorTextString Value.
+func Text(s string) Value { return Value{Major: MajorTextString, Text: s} }
+
+// Arr returns a MajorArray Value.
+func Arr(items ...Value) Value { return Value{Major: MajorArray, Array: items} }
+
+// Entry returns one MapEntry for use with MapOf.
+func Entry(key, value Value) MapEntry { return MapEntry{Key: key, Value: value} }
+
+// MapOf returns a MajorMap Value. Entries may be given in any order;
+// Encode always sorts them into canonical order.
+func MapOf(entries ...MapEntry) Value { return Value{Major: MajorMap, Map: entries} }
+
+// Bool returns a MajorSimple Value holding a boolean.
+func Bool(b bool) Value { return Value{Major: MajorSimple, Bool: b} }
+
+// Null returns a MajorSimple Value holding CBOR null.
+func Null() Value { return Value{Major: MajorSimple, IsNull: true} }
+
+// Get returns the value mapped to key in a MajorMap Value, and whether it
+// was present. Get panics if v is not a MajorMap.
+func (v Value) Get(key Value) (Value, bool) {
+	if v.Major != MajorMap {
+		panic("cbor: Get called on a non-map Value")
+	}
+	for _, entry := range v.Map {
+		if valuesEqual(entry.Key, key) {
+			return entry.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+func valuesEqual(a, b Value) bool {
+	return bytes.Equal(encodeHead(a), encodeHead(b)) && headPayloadEqual(a, b)
+}
+
+// headPayloadEqual compares the major type and, for string types, the
+// byte/text content of two Values; encodeHead's full encoding already
+// covers both, so this repeats that part of valuesEqual's comparison.
+func headPayloadEqual(a, b Value) bool {
+	if a.Major != b.Major {
+		return false
+	}
+	switch a.Major {
+	case MajorByteString:
+		return bytes.Equal(a.Bytes, b.Bytes)
+	case MajorTextString:
+		return a.Text == b.Text
+	default:
+		return true
+	}
+}
+
+// Encode serializes v as CTAP2-canonical CBOR.
+func Encode(v Value) []byte {
+	var buf bytes.Buffer
+	encodeInto(&buf, v)
+	return buf.Bytes()
+}
+
+func encodeInto(buf *bytes.Buffer, v Value) {
+	switch v.Major {
+	case MajorUnsignedInt:
+		writeHead(buf, MajorUnsignedInt, v.Uint)
+	case MajorNegativeInt:
+		writeHead(buf, MajorNegativeInt, uint64(-1-v.Int))
+	case MajorByteString:
+		writeHead(buf, MajorByteString, uint64(len(v.Bytes)))
+		buf.Write(v.Bytes)
+	case MajorTextString:
+		writeHead(buf, MajorTextString, uint64(len(v.Text)))
+		buf.WriteString(v.Text)
+	case MajorArray:
+		writeHead(buf, MajorArray, uint64(len(v.Array)))
+		for _, item := range v.Array {
+			encodeInto(buf, item)
+		}
+	case MajorMap:
+		// Pair each entry with its encoded key and sort that single slice,
+		// not two independently-indexed slices: sort.Slice only permutes
+		// the slice it's given, so a separately-computed "encoded keys"
+		// slice read inside the comparator would stop matching up with
+		// entries after the first swap.
+		keyed := make([]keyedMapEntry, len(v.Map))
+		for i, entry := range v.Map {
+			keyed[i] = keyedMapEntry{encodedKey: Encode(entry.Key), entry: entry}
+		}
+		sort.Slice(keyed, func(i, j int) bool {
+			return lessCanonical(keyed[i].encodedKey, keyed[j].encodedKey)
+		})
+		writeHead(buf, MajorMap, uint64(len(keyed)))
+		for _, k := range keyed {
+			encodeInto(buf, k.entry.Key)
+			encodeInto(buf, k.entry.Value)
+		}
+	case MajorSimple:
+		if v.IsNull {
+			buf.WriteByte(0xf6)
+		} else if v.Bool {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	default:
+		panic(fmt.Sprintf("cbor: Encode: unsupported major type %d", v.Major))
+	}
+}
+
+// lessCanonical implements RFC 8949's core deterministic map-key ordering:
+// shorter encodings sort first; equal-length encodings sort
+// lexicographically by their bytes.
+func lessCanonical(a, b []byte) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return bytes.Compare(a, b) < 0
+}
+
+// encodeHead returns just the encoded form of v, used by valuesEqual to
+// compare two Values irrespective of their underlying Go representation.
+func encodeHead(v Value) []byte {
+	return Encode(v)
+}
+
+// writeHead writes a CBOR initial byte plus any following length/value
+// bytes for major type, using the shortest encoding that fits n.
+func writeHead(buf *bytes.Buffer, major Major, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(byte(major)<<5 | byte(n))
+	case n < 1<<8:
+		buf.WriteByte(byte(major)<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n < 1<<16:
+		buf.WriteByte(byte(major)<<5 | 25)
+		buf.WriteByte(byte(n >> 8))
+		buf.WriteByte(byte(n))
+	case n < 1<<32:
+		buf.WriteByte(byte(major)<<5 | 26)
+		for shift := 24; shift >= 0; shift -= 8 {
+			buf.WriteByte(byte(n >> shift))
+		}
+	default:
+		buf.WriteByte(byte(major)<<5 | 27)
+		for shift := 56; shift >= 0; shift -= 8 {
+			buf.WriteByte(byte(n >> shift))
+		}
+	}
+}
+
+// Decode parses one CBOR item from data, returning the item and the
+// remaining, unconsumed bytes. Indefinite-length items are not supported.
+func Decode(data []byte) (Value, []byte, error) {
+	if len(data) == 0 {
+		return Value{}, nil, fmt.Errorf("cbor: empty input")
+	}
+
+	initial := data[0]
+	major := Major(initial >> 5)
+	additional := initial & 0x1f
+	rest := data[1:]
+
+	switch major {
+	case MajorUnsignedInt:
+		n, rest, err := readLength(additional, rest)
+		if err != nil {
+			return Value{}, nil, err
+		}
+		return UnsignedInt(n), rest, nil
+
+	case MajorNegativeInt:
+		n, rest, err := readLength(additional, rest)
+		if err != nil {
+			return Value{}, nil, err
+		}
+		return NegativeInt(-1 - int64(n)), rest, nil
+
+	case MajorByteString:
+		n, rest, err := readLength(additional, rest)
+		if err != nil {
+			return Value{}, nil, err
+		}
+		if uint64(len(rest)) < n {
+			return Value{}, nil, fmt.Errorf("cbor: byte string length %d exceeds remaining input", n)
+		}
+		return Bytes(append([]byte(nil), rest[:n]...)), rest[n:], nil
+
+	case MajorTextString:
+		n, rest, err := readLength(additional, rest)
+		if err != nil {
+			return Value{}, nil, err
+		}
+		if uint64(len(rest)) < n {
+			return Value{}, nil, fmt.Errorf("cbor: text string length %d exceeds remaining input", n)
+		}
+		return Text(string(rest[:n])), rest[n:], nil
+
+	case MajorArray:
+		n, rest, err := readLength(additional, rest)
+		if err != nil {
+			return Value{}, nil, err
+		}
+		items := make([]Value, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var item Value
+			item, rest, err = Decode(rest)
+			if err != nil {
+				return Value{}, nil, fmt.Errorf("cbor: array element %d: %w", i, err)
+			}
+			items = append(items, item)
+		}
+		return Arr(items...), rest, nil
+
+	case MajorMap:
+		n, rest, err := readLength(additional, rest)
+		if err != nil {
+			return Value{}, nil, err
+		}
+		entries := make([]MapEntry, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var key, value Value
+			key, rest, err = Decode(rest)
+			if err != nil {
+				return Value{}, nil, fmt.Errorf("cbor: map key %d: %w", i, err)
+			}
+			value, rest, err = Decode(rest)
+			if err != nil {
+				return Value{}, nil, fmt.Errorf("cbor: map value %d: %w", i, err)
+			}
+			entries = append(entries, Entry(key, value))
+		}
+		return MapOf(entries...), rest, nil
+
+	case MajorSimple:
+		switch additional {
+		case 20:
+			return Bool(false), rest, nil
+		case 21:
+			return Bool(true), rest, nil
+		case 22:
+			return Null(), rest, nil
+		default:
+			return Value{}, nil, fmt.Errorf("cbor: unsupported simple value %d", additional)
+		}
+
+	default:
+		return Value{}, nil, fmt.Errorf("cbor: unsupported major type %d", major)
+	}
+}
+
+// readLength reads a CBOR length/value field (the bytes following an
+// initial byte whose additional-info nibble is additional) and returns the
+// decoded value along with the remaining input.
+func readLength(additional byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case additional < 24:
+		return uint64(additional), data, nil
+	case additional == 24:
+		if len(data) < 1 {
+			return 0, nil, fmt.Errorf("cbor: truncated 1-byte length")
+		}
+		return uint64(data[0]), data[1:], nil
+	case additional == 25:
+		if len(data) < 2 {
+			return 0, nil, fmt.Errorf("cbor: truncated 2-byte length")
+		}
+		return uint64(data[0])<<8 | uint64(data[1]), data[2:], nil
+	case additional == 26:
+		if len(data) < 4 {
+			return 0, nil, fmt.Errorf("cbor: truncated 4-byte length")
+		}
+		var n uint64
+		for i := 0; i < 4; i++ {
+			n = n<<8 | uint64(data[i])
+		}
+		return n, data[4:], nil
+	case additional == 27:
+		if len(data) < 8 {
+			return 0, nil, fmt.Errorf("cbor: truncated 8-byte length")
+		}
+		var n uint64
+		for i := 0; i < 8; i++ {
+			n = n<<8 | uint64(data[i])
+		}
+		return n, data[8:], nil
+	default:
+		return 0, nil, fmt.Errorf("cbor: unsupported or indefinite-length additional info %d", additional)
+	}
+}
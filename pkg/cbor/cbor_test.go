@@ -0,0 +1,218 @@
+package cbor
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeShortestFormIntegers(t *testing.T) {
+	testCases := []struct {
+		name string
+		v    Value
+		want []byte
+	}{
+		{"small unsigned", UnsignedInt(0), []byte{0x00}},
+		{"unsigned just under 1-byte boundary", UnsignedInt(23), []byte{0x17}},
+		{"unsigned needs 1-byte form", UnsignedInt(24), []byte{0x18, 0x18}},
+		{"unsigned needs 2-byte form", UnsignedInt(256), []byte{0x19, 0x01, 0x00}},
+		{"unsigned needs 4-byte form", UnsignedInt(65536), []byte{0x1a, 0x00, 0x01, 0x00, 0x00}},
+		{"unsigned needs 8-byte form", UnsignedInt(1 << 32), []byte{0x1b, 0, 0, 0, 1, 0, 0, 0, 0}},
+		{"small negative", NegativeInt(-1), []byte{0x20}},
+		{"negative needs 1-byte form", NegativeInt(-25), []byte{0x38, 0x18}},
+		{"Int helper picks unsigned for non-negative", Int(5), []byte{0x05}},
+		{"Int helper picks negative for negative values", Int(-5), []byte{0x24}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Encode(tc.v)
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("Encode(%+v) = %x, want %x", tc.v, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEncodeByteAndTextStrings(t *testing.T) {
+	longText := string(make([]byte, 30))
+
+	testCases := []struct {
+		name string
+		v    Value
+		want []byte
+	}{
+		{"empty byte string", Bytes(nil), []byte{0x40}},
+		{"short byte string", Bytes([]byte{0xAA, 0xBB}), []byte{0x42, 0xAA, 0xBB}},
+		{"short text string", Text("ga"), []byte{0x62, 'g', 'a'}},
+		{"text string needing 1-byte length", Text(longText), append([]byte{0x78, 30}, longText...)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Encode(tc.v)
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("Encode(%+v) = %x, want %x", tc.v, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEncodeArrayAndSimple(t *testing.T) {
+	testCases := []struct {
+		name string
+		v    Value
+		want []byte
+	}{
+		{"empty array", Arr(), []byte{0x80}},
+		{"array of integers", Arr(UnsignedInt(1), UnsignedInt(2)), []byte{0x82, 0x01, 0x02}},
+		{"false", Bool(false), []byte{0xf4}},
+		{"true", Bool(true), []byte{0xf5}},
+		{"null", Null(), []byte{0xf6}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Encode(tc.v)
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("Encode(%+v) = %x, want %x", tc.v, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEncodeMapSortsKeysCanonically(t *testing.T) {
+	// Keys are given out of order and with different encoded lengths; the
+	// canonical encoding must sort by encoded-key byte length first, then
+	// lexicographically, regardless of input order.
+	v := MapOf(
+		Entry(UnsignedInt(65535), UnsignedInt(0)), // encodes as 3 bytes: 19 ff ff
+		Entry(UnsignedInt(1), UnsignedInt(0)),     // encodes as 1 byte: 01
+		Entry(UnsignedInt(0), UnsignedInt(0)),     // encodes as 1 byte: 00
+	)
+
+	want := []byte{
+		0xa3,
+		0x00, 0x00, // key 0
+		0x01, 0x00, // key 1
+		0x19, 0xff, 0xff, 0x00, // key 65535
+	}
+
+	got := Encode(v)
+	if !bytes.Equal(got, want) {
+		t.Errorf("Encode(map) = %x, want %x", got, want)
+	}
+}
+
+func TestEncodeMapSortsLargerMapsCanonically(t *testing.T) {
+	// A 3-entry map happens to come out right even with a comparator that
+	// reads from a second, never-permuted slice (see the regression this
+	// guards against in encodeInto's MajorMap case), so exercise a map
+	// large enough, in a reversed order, that any such mismatch between
+	// the sorted slice and the data it's supposed to describe shows up.
+	entries := make([]MapEntry, 0, 13)
+	for key := 12; key >= 0; key-- {
+		entries = append(entries, Entry(UnsignedInt(uint64(key)), UnsignedInt(0)))
+	}
+	v := MapOf(entries...)
+
+	decoded, rest, err := Decode(Encode(v))
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("Decode() left %d trailing bytes", len(rest))
+	}
+
+	for i, entry := range decoded.Map {
+		if entry.Key.Uint != uint64(i) {
+			t.Fatalf("decoded.Map[%d].Key = %d, want %d (keys must come out in canonical ascending order)", i, entry.Key.Uint, i)
+		}
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	original := MapOf(
+		Entry(UnsignedInt(0), Bytes(bytes.Repeat([]byte{0x01}, 33))),
+		Entry(UnsignedInt(1), Bytes(bytes.Repeat([]byte{0x02}, 16))),
+		Entry(UnsignedInt(2), UnsignedInt(2)),
+		Entry(UnsignedInt(3), NegativeInt(-1)),
+		Entry(UnsignedInt(4), Bool(false)),
+		Entry(UnsignedInt(5), Text("ga")),
+		Entry(UnsignedInt(6), Arr(UnsignedInt(1), Text("nested"))),
+		Entry(UnsignedInt(7), MapOf(Entry(UnsignedInt(1), Null()))),
+	)
+
+	encoded := Encode(original)
+
+	decoded, rest, err := Decode(encoded)
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("Decode() left %d trailing bytes", len(rest))
+	}
+
+	// Canonical encoding is deterministic, so re-encoding the decoded value
+	// must reproduce the exact same bytes.
+	roundTripped := Encode(decoded)
+	if !bytes.Equal(roundTripped, encoded) {
+		t.Errorf("round-tripped encoding = %x, want %x", roundTripped, encoded)
+	}
+
+	tunnelID, ok := decoded.Get(UnsignedInt(6))
+	if !ok || tunnelID.Major != MajorArray || len(tunnelID.Array) != 2 {
+		t.Fatalf("Get(6) = %+v, %v; want a 2-element array", tunnelID, ok)
+	}
+	if tunnelID.Array[1].Text != "nested" {
+		t.Errorf("nested array text = %q, want %q", tunnelID.Array[1].Text, "nested")
+	}
+}
+
+func TestDecodeRejectsTruncatedInput(t *testing.T) {
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{"empty input", nil},
+		{"byte string longer than remaining input", []byte{0x42, 0xAA}},
+		{"truncated 2-byte length", []byte{0x19, 0x01}},
+		{"map missing value", []byte{0xa1, 0x01}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := Decode(tc.data); err == nil {
+				t.Errorf("Decode(%x): want error, got nil", tc.data)
+			}
+		})
+	}
+}
+
+func TestDecodeBrowserGeneratedQRPayload(t *testing.T) {
+	// The raw CBOR bytes of a browser-generated caBLE v2 QR payload, as
+	// used by pkg/qrcode's tests.
+	data := []byte{
+		0xa6,
+		0x00, 0x58, 0x21, // key 0, 33-byte public key
+	}
+	data = append(data, bytes.Repeat([]byte{0x01}, 33)...)
+	data = append(data, 0x01, 0x50) // key 1, 16-byte QR secret
+	data = append(data, bytes.Repeat([]byte{0x02}, 16)...)
+	data = append(data, 0x02, 0x02) // key 2
+	data = append(data, 0x03, 0x00) // key 3
+	data = append(data, 0x04, 0xf4) // key 4, false
+	data = append(data, 0x05, 0x62, 'g', 'a')
+
+	value, rest, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("Decode() left %d trailing bytes", len(rest))
+	}
+
+	getAssertion, ok := value.Get(UnsignedInt(5))
+	if !ok || getAssertion.Text != "ga" {
+		t.Errorf("Get(5) = %+v, %v; want text \"ga\"", getAssertion, ok)
+	}
+}
@@ -0,0 +1,256 @@
+package ctap2
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"ctap2-hybrid-transport/pkg/attestation"
+)
+
+// Authenticator is the backend that actually services CTAP2 commands.
+// Handler is a pure transport-level dispatcher; all credential state and
+// cryptography lives behind this interface so callers can plug in an
+// in-memory, file-backed, or hardware-backed (e.g. keychain) implementation.
+type Authenticator interface {
+	MakeCredential(ctx context.Context, req MakeCredentialRequest) (MakeCredentialResponse, error)
+	GetAssertion(ctx context.Context, req GetAssertionRequest) (GetAssertionResponse, error)
+	GetInfo(ctx context.Context) (GetInfoResponse, error)
+	ClientPIN(ctx context.Context, req ClientPINRequest) (ClientPINResponse, error)
+	Reset(ctx context.Context) error
+	CredentialManagement(ctx context.Context, req CredentialManagementRequest) (CredentialManagementResponse, error)
+}
+
+// storedCredential is a resident credential kept by InMemoryAuthenticator.
+type storedCredential struct {
+	RPID       string                        `json:"rp_id"`
+	User       PublicKeyCredentialUserEntity `json:"user"`
+	PrivateKey []byte                        `json:"private_key"`
+	SignCount  uint32                        `json:"sign_count"`
+}
+
+// InMemoryAuthenticator is the default Authenticator backend: it keeps
+// credentials in memory and writes the whole credential set to outputFile
+// as JSON whenever it changes (credential creation, assertion, reset,
+// credential management). Credentials are not read back from outputFile
+// on startup.
+type InMemoryAuthenticator struct {
+	mu          sync.Mutex
+	outputFile  string
+	aaguid      [16]byte
+	credentials map[string]*storedCredential // keyed by base64-free raw credential ID string
+
+	// signer backs "packed" full (basic) and "fido-u2f" attestation. It is
+	// never used for "packed" self attestation, which signs with the
+	// credential's own key instead.
+	signer attestation.Signer
+
+	// AttestationFormat selects the attStmt format returned by
+	// MakeCredential: "packed" (self attestation, the default), "packed-basic"
+	// (full attestation via signer), "fido-u2f", or "none".
+	AttestationFormat string
+
+	// pinStore persists the PIN hash and retry counters across restarts.
+	pinStore PinStore
+	// keyAgreementKeys holds the authenticator's current ECDH key-agreement
+	// keypair per pinUvAuthProtocol version, regenerated on each
+	// getKeyAgreement call.
+	keyAgreementKeys map[uint64]*ecdh.PrivateKey
+	// currentToken is the most recently issued pinUvAuthToken, if any.
+	currentToken *pinUvAuthToken
+
+	// rpEnumeration and credEnumeration are the cursors left by
+	// enumerateRPsBegin/enumerateCredentialsBegin for the matching
+	// .../GetNext... subCommand to continue from. See credential_management.go.
+	rpEnumeration   []string
+	credEnumeration []string
+}
+
+// maxResidentCredentials is the made-up capacity getCredsMetadata reports
+// remaining room against; this authenticator keeps credentials in memory,
+// so it isn't hardware-capacity-limited the way a real token is.
+const maxResidentCredentials = 100
+
+// NewInMemoryAuthenticator creates an in-memory Authenticator that writes
+// its credential set to outputFile. It also loads (or generates) the
+// persistent attestation signing key stored alongside outputFile.
+func NewInMemoryAuthenticator(outputFile string) (*InMemoryAuthenticator, error) {
+	signer, err := attestation.NewECDSASigner(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize attestation signer: %w", err)
+	}
+	pinStore, err := NewFilePinStore(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize PIN store: %w", err)
+	}
+	return &InMemoryAuthenticator{
+		outputFile:        outputFile,
+		credentials:       make(map[string]*storedCredential),
+		signer:            signer,
+		AttestationFormat: "packed",
+		pinStore:          pinStore,
+		keyAgreementKeys:  make(map[uint64]*ecdh.PrivateKey),
+	}, nil
+}
+
+func (a *InMemoryAuthenticator) MakeCredential(ctx context.Context, req MakeCredentialRequest) (MakeCredentialResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.verifyPinUvAuthToken(req.PinUvAuthParam, req.PinUvAuthProtocol, req.ClientDataHash, PermissionMakeCredential, req.RP.ID); err != nil {
+		return MakeCredentialResponse{}, err
+	}
+
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		return MakeCredentialResponse{}, fmt.Errorf("failed to generate credential ID: %w", err)
+	}
+
+	credKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return MakeCredentialResponse{}, fmt.Errorf("failed to generate credential key: %w", err)
+	}
+	privateKey, err := x509.MarshalECPrivateKey(credKey)
+	if err != nil {
+		return MakeCredentialResponse{}, fmt.Errorf("failed to marshal credential key: %w", err)
+	}
+
+	cred := &storedCredential{
+		RPID:       req.RP.ID,
+		User:       req.User,
+		PrivateKey: privateKey,
+		SignCount:  1,
+	}
+	a.credentials[string(credentialID)] = cred
+
+	if err := a.persist(); err != nil {
+		return MakeCredentialResponse{}, fmt.Errorf("failed to persist credential: %w", err)
+	}
+
+	attestedCredData, err := attestation.AttestedCredentialData(a.aaguid, credentialID, &credKey.PublicKey)
+	if err != nil {
+		return MakeCredentialResponse{}, fmt.Errorf("failed to build attested credential data: %w", err)
+	}
+	authData := attestation.BuildAuthData(req.RP.ID, attestation.FlagUserPresent|attestation.FlagAttestedCredentials, cred.SignCount, attestedCredData)
+
+	fmtName, attStmt, err := a.buildAttestationStatement(authData, req.ClientDataHash, credKey, credentialID, req.RP.ID)
+	if err != nil {
+		return MakeCredentialResponse{}, fmt.Errorf("failed to build attestation statement: %w", err)
+	}
+
+	return MakeCredentialResponse{
+		Fmt:      fmtName,
+		AuthData: authData,
+		AttStmt:  attStmt,
+	}, nil
+}
+
+// buildAttestationStatement produces the attStmt for a.AttestationFormat.
+// Must be called with a.mu held.
+func (a *InMemoryAuthenticator) buildAttestationStatement(authData, clientDataHash []byte, credKey *ecdsa.PrivateKey, credentialID []byte, rpID string) (string, map[string]interface{}, error) {
+	switch a.AttestationFormat {
+	case "", "packed":
+		stmt, err := attestation.PackedSelfAttestation(credKey, authData, clientDataHash)
+		return "packed", stmt, err
+	case "packed-basic":
+		stmt, err := attestation.PackedBasicAttestation(a.signer, authData, clientDataHash)
+		return "packed", stmt, err
+	case "fido-u2f":
+		stmt, err := attestation.FIDOU2FAttestation(a.signer, rpID, clientDataHash, credentialID, &credKey.PublicKey)
+		return "fido-u2f", stmt, err
+	case "none":
+		return "none", attestation.NoneAttestation(), nil
+	default:
+		return "", nil, fmt.Errorf("unsupported attestation format %q", a.AttestationFormat)
+	}
+}
+
+func (a *InMemoryAuthenticator) GetAssertion(ctx context.Context, req GetAssertionRequest) (GetAssertionResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.verifyPinUvAuthToken(req.PinUvAuthParam, req.PinUvAuthProtocol, req.ClientDataHash, PermissionGetAssertion, req.RPID); err != nil {
+		return GetAssertionResponse{}, err
+	}
+
+	for id, cred := range a.credentials {
+		if cred.RPID != req.RPID {
+			continue
+		}
+		cred.SignCount++
+
+		credKey, err := x509.ParseECPrivateKey(cred.PrivateKey)
+		if err != nil {
+			return GetAssertionResponse{}, fmt.Errorf("failed to parse stored credential key: %w", err)
+		}
+
+		authData := attestation.BuildAuthData(req.RPID, attestation.FlagUserPresent, cred.SignCount, nil)
+		digest := sha256.Sum256(append(append([]byte{}, authData...), req.ClientDataHash...))
+		sig, err := ecdsa.SignASN1(rand.Reader, credKey, digest[:])
+		if err != nil {
+			return GetAssertionResponse{}, fmt.Errorf("failed to sign assertion: %w", err)
+		}
+
+		if err := a.persist(); err != nil {
+			return GetAssertionResponse{}, fmt.Errorf("failed to persist sign count: %w", err)
+		}
+
+		return GetAssertionResponse{
+			Credential: PublicKeyCredentialDescriptor{Type: "public-key", ID: []byte(id)},
+			AuthData:   authData,
+			Signature:  sig,
+			User:       cred.User,
+		}, nil
+	}
+
+	return GetAssertionResponse{}, fmt.Errorf("no credential found for rpId %q", req.RPID)
+}
+
+func (a *InMemoryAuthenticator) GetInfo(ctx context.Context) (GetInfoResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return GetInfoResponse{
+		Versions: []string{"FIDO_2_0", "FIDO_2_1"},
+		AAGUID:   a.aaguid[:],
+		Options: map[string]bool{
+			"rk":        true,
+			"up":        true,
+			"plat":      false,
+			"clientPin": a.pinStore.IsSet(),
+		},
+		PinUvAuthProtocols: []uint64{1, 2},
+	}, nil
+}
+
+func (a *InMemoryAuthenticator) Reset(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.credentials = make(map[string]*storedCredential)
+	a.currentToken = nil
+	a.rpEnumeration = nil
+	a.credEnumeration = nil
+	if err := a.pinStore.SetHash(nil); err != nil {
+		return fmt.Errorf("failed to reset PIN store: %w", err)
+	}
+	return a.persist()
+}
+
+// persist writes the current credential set to outputFile as JSON. Must be
+// called with a.mu held.
+func (a *InMemoryAuthenticator) persist() error {
+	data, err := json.MarshalIndent(a.credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(a.outputFile, data, 0644)
+}
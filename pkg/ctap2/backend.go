@@ -0,0 +1,18 @@
+package ctap2
+
+import "fmt"
+
+// NewAuthenticator resolves a --backend name (see cmd/ctap2-hybrid's
+// --backend flag) to the Authenticator that implements it. outputFile is
+// the file-backed credential store path (used by "file"); tpmDevice is
+// the TPM device path (used by "tpm").
+func NewAuthenticator(backend, outputFile, tpmDevice string) (Authenticator, error) {
+	switch backend {
+	case "", "file":
+		return NewInMemoryAuthenticator(outputFile)
+	case "tpm":
+		return newUnsupportedTPMAuthenticator(tpmDevice)
+	default:
+		return nil, fmt.Errorf("ctap2: unknown backend %q (supported: \"file\", \"tpm\")", backend)
+	}
+}
@@ -0,0 +1,34 @@
+package ctap2
+
+import "testing"
+
+// TestNewAuthenticatorRejectsUnknownBackend checks that an unrecognized
+// --backend name fails at construction rather than at use.
+func TestNewAuthenticatorRejectsUnknownBackend(t *testing.T) {
+	if _, err := NewAuthenticator("bogus", t.TempDir()+"/attestation.json", ""); err == nil {
+		t.Fatalf(`NewAuthenticator("bogus", ...) = nil error, want an unknown-backend error`)
+	}
+}
+
+// TestNewAuthenticatorFileBackend checks that "file" (and the default,
+// empty, backend name) resolve to a working InMemoryAuthenticator.
+func TestNewAuthenticatorFileBackend(t *testing.T) {
+	for _, backend := range []string{"", "file"} {
+		auth, err := NewAuthenticator(backend, t.TempDir()+"/attestation.json", "")
+		if err != nil {
+			t.Fatalf("NewAuthenticator(%q, ...) failed: %v", backend, err)
+		}
+		if _, ok := auth.(*InMemoryAuthenticator); !ok {
+			t.Errorf("NewAuthenticator(%q, ...) = %T, want *InMemoryAuthenticator", backend, auth)
+		}
+	}
+}
+
+// TestNewAuthenticatorTPMBackendUnsupported checks that --backend=tpm
+// fails clearly at construction instead of silently falling back to the
+// file backend, since no TPM client is vendored in this build.
+func TestNewAuthenticatorTPMBackendUnsupported(t *testing.T) {
+	if _, err := NewAuthenticator("tpm", t.TempDir()+"/attestation.json", "/dev/tpmrm0"); err == nil {
+		t.Fatal(`NewAuthenticator("tpm", ...) = nil error, want an unsupported-backend error`)
+	}
+}
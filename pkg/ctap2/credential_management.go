@@ -0,0 +1,219 @@
+package ctap2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"sort"
+)
+
+// coseAlgES256 is the COSE algorithm identifier for ECDSA P-256 w/ SHA-256
+// (RFC 9053), used for credential public keys as opposed to the ECDH-ES
+// key-agreement keys pin_protocol.go's publicKeyToCOSE encodes.
+const coseAlgES256 = -7
+
+// ecdsaPublicKeyToCOSE encodes an ECDSA P-256 public key as a COSE_Key.
+func ecdsaPublicKeyToCOSE(pub *ecdsa.PublicKey) COSEKey {
+	return COSEKey{
+		Kty: coseKtyEC2,
+		Alg: coseAlgES256,
+		Crv: coseCrvP256,
+		X:   pub.X.FillBytes(make([]byte, 32)),
+		Y:   pub.Y.FillBytes(make([]byte, 32)),
+	}
+}
+
+// coseKeyPtr is a small helper for returning a COSEKey value's address from
+// an expression, since CredentialManagementResponse.PublicKey is a pointer.
+func coseKeyPtr(k COSEKey) *COSEKey { return &k }
+
+// CredentialManagement implements authenticatorCredentialManagement
+// subCommand dispatch (CTAP2.1 section 6.8): enumerating the RPs and
+// credentials InMemoryAuthenticator holds as resident credentials, and
+// deleting or updating them.
+func (a *InMemoryAuthenticator) CredentialManagement(ctx context.Context, req CredentialManagementRequest) (CredentialManagementResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.verifyCredentialManagementAuth(req); err != nil {
+		return CredentialManagementResponse{}, err
+	}
+
+	switch req.SubCommand {
+	case CredMgmtSubCmdGetCredsMetadata:
+		return CredentialManagementResponse{
+			ExistingResidentCredentialsCount:             uint64(len(a.credentials)),
+			MaxPossibleRemainingResidentCredentialsCount: uint64(maxResidentCredentials - len(a.credentials)),
+		}, nil
+
+	case CredMgmtSubCmdEnumerateRPsBegin:
+		a.rpEnumeration = a.residentRPIDs()
+		if len(a.rpEnumeration) == 0 {
+			return CredentialManagementResponse{}, newStatusError(CTAP2ErrNoCredentials, "no resident credentials")
+		}
+		rpID := a.rpEnumeration[0]
+		a.rpEnumeration = a.rpEnumeration[1:]
+		return rpEnumerationResponse(rpID, uint64(len(a.rpEnumeration)+1)), nil
+
+	case CredMgmtSubCmdEnumerateRPsGetNextRP:
+		if len(a.rpEnumeration) == 0 {
+			return CredentialManagementResponse{}, newStatusError(CTAP2ErrNoCredentials, "no more RPs to enumerate")
+		}
+		rpID := a.rpEnumeration[0]
+		a.rpEnumeration = a.rpEnumeration[1:]
+		return rpEnumerationResponse(rpID, 0), nil
+
+	case CredMgmtSubCmdEnumerateCredentialsBegin:
+		rpID, err := a.rpIDForRequest(req)
+		if err != nil {
+			return CredentialManagementResponse{}, err
+		}
+		a.credEnumeration = a.residentCredentialIDsForRP(rpID)
+		if len(a.credEnumeration) == 0 {
+			return CredentialManagementResponse{}, newStatusError(CTAP2ErrNoCredentials, "no resident credentials for this rpId")
+		}
+		id := a.credEnumeration[0]
+		a.credEnumeration = a.credEnumeration[1:]
+		resp, err := a.credentialEnumerationResponse(id)
+		if err != nil {
+			return CredentialManagementResponse{}, err
+		}
+		resp.TotalCredentials = uint64(len(a.credEnumeration) + 1)
+		return resp, nil
+
+	case CredMgmtSubCmdEnumerateCredentialsGetNextCredential:
+		if len(a.credEnumeration) == 0 {
+			return CredentialManagementResponse{}, newStatusError(CTAP2ErrNoCredentials, "no more credentials to enumerate")
+		}
+		id := a.credEnumeration[0]
+		a.credEnumeration = a.credEnumeration[1:]
+		return a.credentialEnumerationResponse(id)
+
+	case CredMgmtSubCmdDeleteCredential:
+		if req.SubCommandParams == nil || req.SubCommandParams.CredentialID == nil {
+			return CredentialManagementResponse{}, newStatusError(CTAP2ErrMissingParameter, "deleteCredential requires a credentialId")
+		}
+		id := string(req.SubCommandParams.CredentialID.ID)
+		if _, ok := a.credentials[id]; !ok {
+			return CredentialManagementResponse{}, newStatusError(CTAP2ErrInvalidCredential, "no such resident credential")
+		}
+		delete(a.credentials, id)
+		if err := a.persist(); err != nil {
+			return CredentialManagementResponse{}, err
+		}
+		return CredentialManagementResponse{}, nil
+
+	case CredMgmtSubCmdUpdateUserInformation:
+		if req.SubCommandParams == nil || req.SubCommandParams.CredentialID == nil || req.SubCommandParams.User == nil {
+			return CredentialManagementResponse{}, newStatusError(CTAP2ErrMissingParameter, "updateUserInformation requires a credentialId and user")
+		}
+		cred, ok := a.credentials[string(req.SubCommandParams.CredentialID.ID)]
+		if !ok {
+			return CredentialManagementResponse{}, newStatusError(CTAP2ErrInvalidCredential, "no such resident credential")
+		}
+		cred.User = *req.SubCommandParams.User
+		if err := a.persist(); err != nil {
+			return CredentialManagementResponse{}, err
+		}
+		return CredentialManagementResponse{}, nil
+
+	default:
+		return CredentialManagementResponse{}, newStatusError(CTAP1ErrInvalidParameter, "unsupported CredentialManagement subCommand 0x%02x", req.SubCommand)
+	}
+}
+
+// verifyCredentialManagementAuth checks req's pinUvAuthParam the same way
+// MakeCredential/GetAssertion do, over the CTAP2.1-specified message
+// (subCommand || CBOR(subCommandParams)) instead of a clientDataHash, and
+// with the "cm" permission rather than "mc"/"ga". Must be called with a.mu
+// held.
+func (a *InMemoryAuthenticator) verifyCredentialManagementAuth(req CredentialManagementRequest) error {
+	message := []byte{byte(req.SubCommand)}
+	if req.SubCommandParams != nil {
+		params, err := ctap2EncMode.Marshal(req.SubCommandParams)
+		if err != nil {
+			return newStatusError(CTAP2ErrInvalidCBOR, "failed to re-encode subCommandParams: %v", err)
+		}
+		message = append(message, params...)
+	}
+	return a.verifyPinUvAuthToken(req.PinUvAuthParam, req.PinUvAuthProtocol, message, PermissionCredentialManagement, "")
+}
+
+// residentRPIDs returns the distinct RP IDs with at least one resident
+// credential, sorted for a stable enumeration order across calls. Must be
+// called with a.mu held.
+func (a *InMemoryAuthenticator) residentRPIDs() []string {
+	seen := make(map[string]bool)
+	var rpIDs []string
+	for _, cred := range a.credentials {
+		if !seen[cred.RPID] {
+			seen[cred.RPID] = true
+			rpIDs = append(rpIDs, cred.RPID)
+		}
+	}
+	sort.Strings(rpIDs)
+	return rpIDs
+}
+
+// residentCredentialIDsForRP returns the credential IDs resident for rpID,
+// sorted for a stable enumeration order across calls. Must be called with
+// a.mu held.
+func (a *InMemoryAuthenticator) residentCredentialIDsForRP(rpID string) []string {
+	var ids []string
+	for id, cred := range a.credentials {
+		if cred.RPID == rpID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// rpIDForRequest recovers the plaintext rpId enumerateCredentialsBegin's
+// subCommandParams identifies only by rpIdHash, by matching it against
+// this authenticator's resident RPs. Must be called with a.mu held.
+func (a *InMemoryAuthenticator) rpIDForRequest(req CredentialManagementRequest) (string, error) {
+	if req.SubCommandParams == nil || len(req.SubCommandParams.RPIDHash) == 0 {
+		return "", newStatusError(CTAP2ErrMissingParameter, "enumerateCredentialsBegin requires an rpIdHash")
+	}
+	for _, rpID := range a.residentRPIDs() {
+		hash := sha256.Sum256([]byte(rpID))
+		if string(hash[:]) == string(req.SubCommandParams.RPIDHash) {
+			return rpID, nil
+		}
+	}
+	return "", newStatusError(CTAP2ErrInvalidCredential, "no resident credentials for this rpIdHash")
+}
+
+// rpEnumerationResponse builds the response for enumerateRPsBegin/GetNextRP.
+// totalRPs is only set (non-zero) for the Begin response.
+func rpEnumerationResponse(rpID string, totalRPs uint64) CredentialManagementResponse {
+	hash := sha256.Sum256([]byte(rpID))
+	resp := CredentialManagementResponse{
+		RP:       &PublicKeyCredentialRpEntity{ID: rpID},
+		RPIDHash: hash[:],
+	}
+	if totalRPs > 0 {
+		resp.TotalRPs = totalRPs
+	}
+	return resp
+}
+
+// credentialEnumerationResponse builds the response for
+// enumerateCredentialsBegin/GetNextCredential for the resident credential
+// keyed by id. Must be called with a.mu held.
+func (a *InMemoryAuthenticator) credentialEnumerationResponse(id string) (CredentialManagementResponse, error) {
+	cred := a.credentials[id]
+	credKey, err := x509.ParseECPrivateKey(cred.PrivateKey)
+	if err != nil {
+		return CredentialManagementResponse{}, newStatusError(CTAP2ErrProcessing, "failed to parse stored credential key: %v", err)
+	}
+
+	user := cred.User
+	return CredentialManagementResponse{
+		User:         &user,
+		CredentialID: &PublicKeyCredentialDescriptor{Type: "public-key", ID: []byte(id)},
+		PublicKey:    coseKeyPtr(ecdsaPublicKeyToCOSE(&credKey.PublicKey)),
+	}, nil
+}
@@ -0,0 +1,120 @@
+package ctap2
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+)
+
+// TestCredentialManagementEnumeratesRPsAndCredentials exercises the
+// getCredsMetadata/enumerateRPsBegin/enumerateCredentialsBegin happy path
+// against two resident credentials under two different RPs.
+func TestCredentialManagementEnumeratesRPsAndCredentials(t *testing.T) {
+	auth, err := NewInMemoryAuthenticator(t.TempDir() + "/attestation.json")
+	if err != nil {
+		t.Fatalf("NewInMemoryAuthenticator() failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := auth.MakeCredential(ctx, MakeCredentialRequest{
+		RP:   PublicKeyCredentialRpEntity{ID: "a.example.com"},
+		User: PublicKeyCredentialUserEntity{ID: []byte{0x01}},
+	}); err != nil {
+		t.Fatalf("MakeCredential() failed: %v", err)
+	}
+	if _, err := auth.MakeCredential(ctx, MakeCredentialRequest{
+		RP:   PublicKeyCredentialRpEntity{ID: "b.example.com"},
+		User: PublicKeyCredentialUserEntity{ID: []byte{0x02}},
+	}); err != nil {
+		t.Fatalf("MakeCredential() failed: %v", err)
+	}
+
+	meta, err := auth.CredentialManagement(ctx, CredentialManagementRequest{SubCommand: CredMgmtSubCmdGetCredsMetadata})
+	if err != nil {
+		t.Fatalf("getCredsMetadata failed: %v", err)
+	}
+	if meta.ExistingResidentCredentialsCount != 2 {
+		t.Errorf("ExistingResidentCredentialsCount = %d, want 2", meta.ExistingResidentCredentialsCount)
+	}
+
+	firstRP, err := auth.CredentialManagement(ctx, CredentialManagementRequest{SubCommand: CredMgmtSubCmdEnumerateRPsBegin})
+	if err != nil {
+		t.Fatalf("enumerateRPsBegin failed: %v", err)
+	}
+	if firstRP.TotalRPs != 2 {
+		t.Errorf("TotalRPs = %d, want 2", firstRP.TotalRPs)
+	}
+
+	secondRP, err := auth.CredentialManagement(ctx, CredentialManagementRequest{SubCommand: CredMgmtSubCmdEnumerateRPsGetNextRP})
+	if err != nil {
+		t.Fatalf("enumerateRPsGetNextRP failed: %v", err)
+	}
+	if firstRP.RP.ID == secondRP.RP.ID {
+		t.Errorf("enumerateRPsGetNextRP returned the same rpId twice: %q", firstRP.RP.ID)
+	}
+
+	if _, err := auth.CredentialManagement(ctx, CredentialManagementRequest{SubCommand: CredMgmtSubCmdEnumerateRPsGetNextRP}); err == nil {
+		t.Error("expected enumerateRPsGetNextRP to fail once the RP list is exhausted")
+	}
+
+	credsResp, err := auth.CredentialManagement(ctx, CredentialManagementRequest{
+		SubCommand: CredMgmtSubCmdEnumerateCredentialsBegin,
+		SubCommandParams: &CredentialManagementSubCommandParams{
+			RPIDHash: rpIDHash(firstRP.RP.ID),
+		},
+	})
+	if err != nil {
+		t.Fatalf("enumerateCredentialsBegin failed: %v", err)
+	}
+	if credsResp.TotalCredentials != 1 {
+		t.Errorf("TotalCredentials = %d, want 1", credsResp.TotalCredentials)
+	}
+	if credsResp.PublicKey == nil {
+		t.Error("expected a non-nil public key in the credential enumeration response")
+	}
+}
+
+// TestCredentialManagementDeleteCredential checks that deleteCredential
+// removes a resident credential so it's no longer usable for assertions.
+func TestCredentialManagementDeleteCredential(t *testing.T) {
+	auth, err := NewInMemoryAuthenticator(t.TempDir() + "/attestation.json")
+	if err != nil {
+		t.Fatalf("NewInMemoryAuthenticator() failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := auth.MakeCredential(ctx, MakeCredentialRequest{
+		RP:   PublicKeyCredentialRpEntity{ID: "example.com"},
+		User: PublicKeyCredentialUserEntity{ID: []byte{0x01}},
+	}); err != nil {
+		t.Fatalf("MakeCredential() failed: %v", err)
+	}
+
+	credsResp, err := auth.CredentialManagement(ctx, CredentialManagementRequest{
+		SubCommand: CredMgmtSubCmdEnumerateCredentialsBegin,
+		SubCommandParams: &CredentialManagementSubCommandParams{
+			RPIDHash: rpIDHash("example.com"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("enumerateCredentialsBegin failed: %v", err)
+	}
+
+	if _, err := auth.CredentialManagement(ctx, CredentialManagementRequest{
+		SubCommand: CredMgmtSubCmdDeleteCredential,
+		SubCommandParams: &CredentialManagementSubCommandParams{
+			CredentialID: credsResp.CredentialID,
+		},
+	}); err != nil {
+		t.Fatalf("deleteCredential failed: %v", err)
+	}
+
+	if _, err := auth.GetAssertion(ctx, GetAssertionRequest{RPID: "example.com"}); err == nil {
+		t.Error("expected GetAssertion to fail for a deleted credential's rpId, but it succeeded")
+	}
+}
+
+func rpIDHash(rpID string) []byte {
+	h := sha256.Sum256([]byte(rpID))
+	return h[:]
+}
@@ -7,70 +7,88 @@ import (
 	"log"
 	"time"
 
-	"ctap2-hybrid-transport/pkg/tunnel"
+	"github.com/fxamacker/cbor/v2"
+
+	attestationpkg "ctap2-hybrid-transport/pkg/attestation"
+	"ctap2-hybrid-transport/pkg/events"
 )
 
+// AttestationData is the repo-wide attestation result type; it lives in
+// pkg/attestation so that package can build it without importing ctap2.
+// Re-exported here for callers that only need the transport layer.
+type AttestationData = attestationpkg.AttestationData
+
 // CTAP2 Command codes
 const (
-	CTAP2MakeCredential    = 0x01
-	CTAP2GetAssertion      = 0x02
-	CTAP2GetInfo           = 0x04
-	CTAP2ClientPIN         = 0x06
-	CTAP2Reset             = 0x07
-	CTAP2GetNextAssertion  = 0x08
-	CTAP2BioEnrollment     = 0x09
+	CTAP2MakeCredential       = 0x01
+	CTAP2GetAssertion         = 0x02
+	CTAP2GetInfo              = 0x04
+	CTAP2ClientPIN            = 0x06
+	CTAP2Reset                = 0x07
+	CTAP2GetNextAssertion     = 0x08
+	CTAP2BioEnrollment        = 0x09
 	CTAP2CredentialManagement = 0x0A
 )
 
 // CTAP2 Response status codes
 const (
-	CTAP1ErrSuccess               = 0x00
-	CTAP1ErrInvalidCommand        = 0x01
-	CTAP1ErrInvalidParameter      = 0x02
-	CTAP1ErrInvalidLength         = 0x03
-	CTAP1ErrInvalidSeq            = 0x04
-	CTAP1ErrTimeout               = 0x05
-	CTAP1ErrChannelBusy           = 0x06
-	CTAP1ErrLockRequired          = 0x0A
-	CTAP1ErrInvalidChannel        = 0x0B
-	CTAP2ErrCBORUnexpectedType    = 0x11
-	CTAP2ErrInvalidCBOR           = 0x12
-	CTAP2ErrMissingParameter      = 0x14
-	CTAP2ErrLimitExceeded         = 0x15
-	CTAP2ErrUnsupportedExtension  = 0x16
-	CTAP2ErrCredentialExcluded    = 0x19
-	CTAP2ErrProcessing            = 0x21
-	CTAP2ErrInvalidCredential     = 0x22
-	CTAP2ErrUserActionPending     = 0x23
-	CTAP2ErrOperationPending      = 0x24
-	CTAP2ErrNoOperations          = 0x25
-	CTAP2ErrUnsupportedAlgorithm  = 0x26
-	CTAP2ErrOperationDenied       = 0x27
-	CTAP2ErrKeyStoreFull          = 0x28
-	CTAP2ErrNotBusy               = 0x29
-	CTAP2ErrNoOperationPending    = 0x2A
-	CTAP2ErrUnsupportedOption     = 0x2B
-	CTAP2ErrInvalidOption         = 0x2C
-	CTAP2ErrKeepaliveCancel       = 0x2D
-	CTAP2ErrNoCredentials         = 0x2E
-	CTAP2ErrUserActionTimeout     = 0x2F
-	CTAP2ErrNotAllowed            = 0x30
-	CTAP2ErrPinInvalid            = 0x31
-	CTAP2ErrPinBlocked            = 0x32
-	CTAP2ErrPinAuthInvalid        = 0x33
-	CTAP2ErrPinAuthBlocked        = 0x34
-	CTAP2ErrPinNotSet             = 0x35
-	CTAP2ErrPinRequired           = 0x36
-	CTAP2ErrPinPolicyViolation    = 0x37
-	CTAP2ErrPinTokenExpired       = 0x38
-	CTAP2ErrRequestTooLarge       = 0x39
-	CTAP2ErrActionTimeout         = 0x3A
-	CTAP2ErrUpRequired            = 0x3B
-	CTAP2ErrUvBlocked             = 0x3C
-	CTAP2ErrUvInvalid             = 0x3D
+	CTAP1ErrSuccess                = 0x00
+	CTAP1ErrInvalidCommand         = 0x01
+	CTAP1ErrInvalidParameter       = 0x02
+	CTAP1ErrInvalidLength          = 0x03
+	CTAP1ErrInvalidSeq             = 0x04
+	CTAP1ErrTimeout                = 0x05
+	CTAP1ErrChannelBusy            = 0x06
+	CTAP1ErrLockRequired           = 0x0A
+	CTAP1ErrInvalidChannel         = 0x0B
+	CTAP2ErrCBORUnexpectedType     = 0x11
+	CTAP2ErrInvalidCBOR            = 0x12
+	CTAP2ErrMissingParameter       = 0x14
+	CTAP2ErrLimitExceeded          = 0x15
+	CTAP2ErrUnsupportedExtension   = 0x16
+	CTAP2ErrCredentialExcluded     = 0x19
+	CTAP2ErrProcessing             = 0x21
+	CTAP2ErrInvalidCredential      = 0x22
+	CTAP2ErrUserActionPending      = 0x23
+	CTAP2ErrOperationPending       = 0x24
+	CTAP2ErrNoOperations           = 0x25
+	CTAP2ErrUnsupportedAlgorithm   = 0x26
+	CTAP2ErrOperationDenied        = 0x27
+	CTAP2ErrKeyStoreFull           = 0x28
+	CTAP2ErrNotBusy                = 0x29
+	CTAP2ErrNoOperationPending     = 0x2A
+	CTAP2ErrUnsupportedOption      = 0x2B
+	CTAP2ErrInvalidOption          = 0x2C
+	CTAP2ErrKeepaliveCancel        = 0x2D
+	CTAP2ErrNoCredentials          = 0x2E
+	CTAP2ErrUserActionTimeout      = 0x2F
+	CTAP2ErrNotAllowed             = 0x30
+	CTAP2ErrPinInvalid             = 0x31
+	CTAP2ErrPinBlocked             = 0x32
+	CTAP2ErrPinAuthInvalid         = 0x33
+	CTAP2ErrPinAuthBlocked         = 0x34
+	CTAP2ErrPinNotSet              = 0x35
+	CTAP2ErrPinRequired            = 0x36
+	CTAP2ErrPinPolicyViolation     = 0x37
+	CTAP2ErrPinTokenExpired        = 0x38
+	CTAP2ErrRequestTooLarge        = 0x39
+	CTAP2ErrActionTimeout          = 0x3A
+	CTAP2ErrUpRequired             = 0x3B
+	CTAP2ErrUvBlocked              = 0x3C
+	CTAP2ErrUvInvalid              = 0x3D
 	CTAP2ErrUnauthorizedPermission = 0x3E
 )
 
+// ctap2EncMode is the canonical CTAP2 CBOR encoding mode: deterministic
+// integer-key ordering, shortest-form integers, no indefinite-length items.
+var ctap2EncMode = func() cbor.EncMode {
+	em, err := cbor.CTAP2EncOptions().EncMode()
+	if err != nil {
+		panic("ctap2: failed to build CBOR encode mode: " + err.Error())
+	}
+	return em
+}()
+
 // CTAP2Message represents a parsed CTAP2 message
 type CTAP2Message struct {
 	Command   byte
@@ -82,59 +100,51 @@ type CTAP2Message struct {
 type HybridTransport struct {
 	TunnelURL  string
 	OutputFile string
-}
 
-// Handler handles CTAP2 protocol messages
-type Handler struct {
-	conn       *tunnel.Connection
-	outputFile string
+	// LinkStorePath is where pkg/linking persists state-assisted
+	// reconnect state between runs, if non-empty.
+	LinkStorePath string
+
+	// Backend selects the Authenticator implementation (see
+	// NewAuthenticator): "file" (the default) or "tpm".
+	Backend string
+	// TPMDevice is the backend-specific TPM device path, used only when
+	// Backend is "tpm".
+	TPMDevice string
+
+	// Events, if set, receives structured NDJSON records for this run; see
+	// pkg/events. Left nil, no events are emitted.
+	Events *events.Emitter
 }
 
-// AttestationData represents the attestation data
-type AttestationData struct {
-	RequestID     []byte                 `json:"request_id"`
-	Timestamp     time.Time              `json:"timestamp"`
-	AttestationObject map[string]interface{} `json:"attestation_object"`
-	ClientDataJSON     []byte                 `json:"client_data_json"`
+// MessageSink is anything a Handler can exchange raw CTAP2 frames with.
+// *tunnel.Connection satisfies it; pkg/replay's recorded-session sink
+// does too, so the handler can be driven offline without a live tunnel.
+type MessageSink interface {
+	ReadCTAP() ([]byte, error)
+	WriteCTAP(payload []byte) error
 }
 
-// NewHandler creates a new CTAP2 handler
-func NewHandler(conn *tunnel.Connection, outputFile string) *Handler {
-	return &Handler{
-		conn:       conn,
-		outputFile: outputFile,
-	}
+// Handler is a transport-level dispatcher: it decodes CBOR request maps,
+// forwards them to an Authenticator backend, and encodes the result back
+// to canonical CTAP2 CBOR. It holds no credential state of its own.
+type Handler struct {
+	conn          MessageSink
+	authenticator Authenticator
+
+	// Events, if set, receives a ctap2_request/ctap2_response (or error)
+	// record for every command ProcessCTAP2Message handles. Left nil, no
+	// events are emitted.
+	Events *events.Emitter
 }
 
-// HandleAuthentication handles the authentication process
-func (h *Handler) HandleAuthentication(ctx context.Context) (*AttestationData, error) {
-	log.Println("Starting CTAP2 authentication handler")
-
-	// TODO: Implement actual CTAP2 protocol handling
-	// For now, return stub data
-	
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-time.After(5 * time.Second):
-		// Simulate authentication process
-		log.Println("Authentication process completed (stub implementation)")
-		
-		attestationData := &AttestationData{
-			RequestID:     []byte("stub_request_id"),
-			Timestamp:     time.Now(),
-			AttestationObject: map[string]interface{}{
-				"fmt":      "packed",
-				"authData": []byte("stub_auth_data"),
-				"attStmt":  map[string]interface{}{
-					"alg": -7,
-					"sig": []byte("stub_signature"),
-				},
-			},
-			ClientDataJSON: []byte(`{"type":"webauthn.create","challenge":"stub_challenge"}`),
-		}
-		
-		return attestationData, nil
+// NewHandler creates a new CTAP2 handler dispatching to authenticator.
+// conn may be nil, or any MessageSink - a live *tunnel.Connection, or a
+// recorded-session sink such as pkg/replay's.
+func NewHandler(conn MessageSink, authenticator Authenticator) *Handler {
+	return &Handler{
+		conn:          conn,
+		authenticator: authenticator,
 	}
 }
 
@@ -143,22 +153,22 @@ func ParseCTAP2Message(data []byte) (*CTAP2Message, error) {
 	if len(data) == 0 {
 		return nil, errors.New("empty message data")
 	}
-	
+
 	// CTAP2 message format:
 	// - First byte: command code
 	// - Remaining bytes: CBOR-encoded data
-	
+
 	command := data[0]
 	var messageData []byte
 	if len(data) > 1 {
 		messageData = data[1:]
 	}
-	
+
 	message := &CTAP2Message{
 		Command: command,
 		Data:    messageData,
 	}
-	
+
 	log.Printf("Parsed CTAP2 message:")
 	log.Printf("  Command: 0x%02x (%s)", command, GetCommandName(command))
 	log.Printf("  Data length: %d bytes", len(messageData))
@@ -166,7 +176,7 @@ func ParseCTAP2Message(data []byte) (*CTAP2Message, error) {
 		log.Printf("  Data (hex): %x", messageData)
 		log.Printf("  Data (first 32 bytes): %x", messageData[:min(32, len(messageData))])
 	}
-	
+
 	return message, nil
 }
 
@@ -197,7 +207,33 @@ func GetCommandName(command byte) string {
 // ProcessCTAP2Message processes a parsed CTAP2 message and generates appropriate response
 func (h *Handler) ProcessCTAP2Message(message *CTAP2Message) ([]byte, error) {
 	log.Printf("Processing CTAP2 command: %s", GetCommandName(message.Command))
-	
+
+	start := time.Now()
+	h.Events.Emit(events.Event{
+		Stage:       events.StageCTAP2Request,
+		Command:     message.Command,
+		MessageSize: len(message.Data),
+	})
+
+	response, err := h.dispatch(message)
+
+	if err != nil {
+		h.Events.Emit(events.Event{Stage: events.StageError, Class: "ctap2", Err: err.Error()})
+		return response, err
+	}
+	h.Events.Emit(events.Event{
+		Stage:       events.StageCTAP2Response,
+		Command:     message.Command,
+		DurationMS:  float64(time.Since(start).Microseconds()) / 1000,
+		MessageSize: len(response),
+	})
+	return response, nil
+}
+
+// dispatch is ProcessCTAP2Message's command switch, split out so the
+// event-emission/timing wrapper above doesn't have to be repeated in
+// every case.
+func (h *Handler) dispatch(message *CTAP2Message) ([]byte, error) {
 	switch message.Command {
 	case CTAP2MakeCredential:
 		return h.handleMakeCredential(message.Data)
@@ -209,85 +245,124 @@ func (h *Handler) ProcessCTAP2Message(message *CTAP2Message) ([]byte, error) {
 		return h.handleClientPIN(message.Data)
 	case CTAP2Reset:
 		return h.handleReset()
+	case CTAP2CredentialManagement:
+		return h.handleCredentialManagement(message.Data)
 	default:
 		log.Printf("Unsupported CTAP2 command: 0x%02x", message.Command)
 		return []byte{CTAP1ErrInvalidCommand}, nil
 	}
 }
 
+// encodeResponse prepends the success status byte to the CTAP2-canonical
+// CBOR encoding of v.
+func encodeResponse(v interface{}) ([]byte, error) {
+	body, err := ctap2EncMode.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode CBOR response: %w", err)
+	}
+	return append([]byte{CTAP1ErrSuccess}, body...), nil
+}
+
 // handleMakeCredential handles the authenticatorMakeCredential command
 func (h *Handler) handleMakeCredential(data []byte) ([]byte, error) {
-	log.Printf("Handling authenticatorMakeCredential command")
-	log.Printf("  Request data length: %d bytes", len(data))
-	log.Printf("  Request data (hex): %x", data)
-	
-	// TODO: Implement proper CBOR decoding and credential creation
-	// For now, return a success response with stub data
-	
-	// CTAP2 response format: [status byte] + [CBOR response data]
-	response := []byte{CTAP1ErrSuccess} // Success status
-	
-	// TODO: Add proper CBOR-encoded response data
-	log.Printf("Returning success response (stub implementation)")
-	
-	return response, nil
+	log.Printf("Handling authenticatorMakeCredential command (%d bytes)", len(data))
+
+	var req MakeCredentialRequest
+	if err := cbor.Unmarshal(data, &req); err != nil {
+		log.Printf("Failed to decode MakeCredential request: %v", err)
+		return []byte{CTAP2ErrInvalidCBOR}, nil
+	}
+
+	resp, err := h.authenticator.MakeCredential(context.Background(), req)
+	if err != nil {
+		log.Printf("MakeCredential failed: %v", err)
+		return []byte{statusCodeOf(err, CTAP2ErrOperationDenied)}, nil
+	}
+
+	return encodeResponse(resp)
 }
 
 // handleGetAssertion handles the authenticatorGetAssertion command
 func (h *Handler) handleGetAssertion(data []byte) ([]byte, error) {
-	log.Printf("Handling authenticatorGetAssertion command")
-	log.Printf("  Request data length: %d bytes", len(data))
-	log.Printf("  Request data (hex): %x", data)
-	
-	// TODO: Implement proper CBOR decoding and assertion generation
-	// For now, return a success response with stub data
-	
-	response := []byte{CTAP1ErrSuccess} // Success status
-	
-	// TODO: Add proper CBOR-encoded response data
-	log.Printf("Returning success response (stub implementation)")
-	
-	return response, nil
+	log.Printf("Handling authenticatorGetAssertion command (%d bytes)", len(data))
+
+	var req GetAssertionRequest
+	if err := cbor.Unmarshal(data, &req); err != nil {
+		log.Printf("Failed to decode GetAssertion request: %v", err)
+		return []byte{CTAP2ErrInvalidCBOR}, nil
+	}
+
+	resp, err := h.authenticator.GetAssertion(context.Background(), req)
+	if err != nil {
+		log.Printf("GetAssertion failed: %v", err)
+		return []byte{statusCodeOf(err, CTAP2ErrNoCredentials)}, nil
+	}
+
+	return encodeResponse(resp)
 }
 
 // handleGetInfo handles the authenticatorGetInfo command
 func (h *Handler) handleGetInfo() ([]byte, error) {
 	log.Printf("Handling authenticatorGetInfo command")
-	
-	// Return basic authenticator info
-	// TODO: Implement proper CBOR encoding
-	response := []byte{CTAP1ErrSuccess} // Success status
-	
-	// TODO: Add proper CBOR-encoded authenticator info
-	log.Printf("Returning authenticator info (stub implementation)")
-	
-	return response, nil
+
+	resp, err := h.authenticator.GetInfo(context.Background())
+	if err != nil {
+		log.Printf("GetInfo failed: %v", err)
+		return []byte{CTAP2ErrProcessing}, nil
+	}
+
+	return encodeResponse(resp)
 }
 
 // handleClientPIN handles the authenticatorClientPIN command
 func (h *Handler) handleClientPIN(data []byte) ([]byte, error) {
-	log.Printf("Handling authenticatorClientPIN command")
-	log.Printf("  Request data length: %d bytes", len(data))
-	log.Printf("  Request data (hex): %x", data)
-	
-	// TODO: Implement PIN protocol
-	response := []byte{CTAP2ErrPinNotSet} // PIN not set
-	
-	log.Printf("Returning PIN not set response")
-	
-	return response, nil
+	log.Printf("Handling authenticatorClientPIN command (%d bytes)", len(data))
+
+	var req ClientPINRequest
+	if err := cbor.Unmarshal(data, &req); err != nil {
+		log.Printf("Failed to decode ClientPIN request: %v", err)
+		return []byte{CTAP2ErrInvalidCBOR}, nil
+	}
+
+	resp, err := h.authenticator.ClientPIN(context.Background(), req)
+	if err != nil {
+		log.Printf("ClientPIN failed: %v", err)
+		return []byte{statusCodeOf(err, CTAP2ErrPinNotSet)}, nil
+	}
+
+	return encodeResponse(resp)
 }
 
 // handleReset handles the authenticatorReset command
 func (h *Handler) handleReset() ([]byte, error) {
 	log.Printf("Handling authenticatorReset command")
-	
-	// TODO: Implement reset functionality
-	response := []byte{CTAP1ErrSuccess} // Success status
-	
-	log.Printf("Returning reset success response (stub implementation)")
-	
-	return response, nil
+
+	if err := h.authenticator.Reset(context.Background()); err != nil {
+		log.Printf("Reset failed: %v", err)
+		return []byte{CTAP2ErrOperationDenied}, nil
+	}
+
+	return []byte{CTAP1ErrSuccess}, nil
+}
+
+// handleCredentialManagement handles the authenticatorCredentialManagement
+// command
+func (h *Handler) handleCredentialManagement(data []byte) ([]byte, error) {
+	log.Printf("Handling authenticatorCredentialManagement command (%d bytes)", len(data))
+
+	var req CredentialManagementRequest
+	if err := cbor.Unmarshal(data, &req); err != nil {
+		log.Printf("Failed to decode CredentialManagement request: %v", err)
+		return []byte{CTAP2ErrInvalidCBOR}, nil
+	}
+
+	resp, err := h.authenticator.CredentialManagement(context.Background(), req)
+	if err != nil {
+		log.Printf("CredentialManagement failed: %v", err)
+		return []byte{statusCodeOf(err, CTAP2ErrOperationDenied)}, nil
+	}
+
+	return encodeResponse(resp)
 }
 
 // min returns the minimum of two integers
@@ -296,4 +371,4 @@ func min(a, b int) int {
 		return a
 	}
 	return b
-}
\ No newline at end of file
+}
@@ -0,0 +1,219 @@
+package ctap2
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"ctap2-hybrid-transport/pkg/events"
+)
+
+// TestMakeCredentialRequestDecode encodes a MakeCredentialRequest with
+// ctap2EncMode into a CTAP2-canonical CBOR map (field numbers per the
+// spec: 1=clientDataHash, 2=rp, 3=user, 4=pubKeyCredParams), decodes it
+// back and checks the typed struct comes out right.
+func TestMakeCredentialRequestDecode(t *testing.T) {
+	clientDataHash := bytes.Repeat([]byte{0xAB}, 32)
+
+	req := MakeCredentialRequest{
+		ClientDataHash: clientDataHash,
+		RP:             PublicKeyCredentialRpEntity{ID: "example.com", Name: "Example"},
+		User:           PublicKeyCredentialUserEntity{ID: []byte{0x01, 0x02}, Name: "alice"},
+		PubKeyCredParams: []PublicKeyCredentialParam{
+			{Type: "public-key", Alg: -7},
+		},
+	}
+
+	encoded, err := ctap2EncMode.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+
+	var decoded MakeCredentialRequest
+	if err := cbor.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+
+	if !bytes.Equal(decoded.ClientDataHash, clientDataHash) {
+		t.Errorf("ClientDataHash = %x, want %x", decoded.ClientDataHash, clientDataHash)
+	}
+	if decoded.RP.ID != "example.com" {
+		t.Errorf("RP.ID = %q, want %q", decoded.RP.ID, "example.com")
+	}
+	if decoded.User.Name != "alice" {
+		t.Errorf("User.Name = %q, want %q", decoded.User.Name, "alice")
+	}
+	if len(decoded.PubKeyCredParams) != 1 || decoded.PubKeyCredParams[0].Alg != -7 {
+		t.Errorf("PubKeyCredParams = %+v, want one entry with alg -7", decoded.PubKeyCredParams)
+	}
+}
+
+// TestMakeCredentialRequestCanonicalKeyOrder verifies that the encoder
+// puts the lowest integer map key first, as CTAP2 canonical CBOR's
+// ascending key order requires.
+func TestMakeCredentialRequestCanonicalKeyOrder(t *testing.T) {
+	req := MakeCredentialRequest{
+		ClientDataHash: []byte{0x01},
+		RP:             PublicKeyCredentialRpEntity{ID: "a"},
+		User:           PublicKeyCredentialUserEntity{ID: []byte{0x02}},
+		PubKeyCredParams: []PublicKeyCredentialParam{
+			{Type: "public-key", Alg: -7},
+		},
+	}
+
+	encoded, err := ctap2EncMode.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+
+	// First byte is the map header (0xa0 | n); the lowest key, 1
+	// (clientDataHash), must come right after it. Later keys are not
+	// checked here.
+	if encoded[0]&0xe0 != 0xa0 {
+		t.Fatalf("expected a CBOR map, got first byte 0x%02x", encoded[0])
+	}
+	if encoded[1] != 0x01 {
+		t.Errorf("first key = 0x%02x, want 0x01", encoded[1])
+	}
+}
+
+// TestGetInfoResponseRoundTrip exercises handleGetInfo via the dispatcher.
+func TestGetInfoResponseRoundTrip(t *testing.T) {
+	auth, err := NewInMemoryAuthenticator(t.TempDir() + "/attestation.json")
+	if err != nil {
+		t.Fatalf("NewInMemoryAuthenticator() failed: %v", err)
+	}
+	handler := NewHandler(nil, auth)
+
+	response, err := handler.handleGetInfo()
+	if err != nil {
+		t.Fatalf("handleGetInfo() failed: %v", err)
+	}
+	if len(response) == 0 || response[0] != CTAP1ErrSuccess {
+		t.Fatalf("expected success status byte, got %x", response)
+	}
+
+	var info GetInfoResponse
+	if err := cbor.Unmarshal(response[1:], &info); err != nil {
+		t.Fatalf("failed to decode GetInfoResponse: %v", err)
+	}
+	if len(info.Versions) == 0 {
+		t.Error("expected at least one supported version")
+	}
+}
+
+// TestMakeCredentialDispatch exercises the full decode -> Authenticator ->
+// encode path used by ProcessCTAP2Message.
+func TestMakeCredentialDispatch(t *testing.T) {
+	auth, err := NewInMemoryAuthenticator(t.TempDir() + "/attestation.json")
+	if err != nil {
+		t.Fatalf("NewInMemoryAuthenticator() failed: %v", err)
+	}
+	handler := NewHandler(nil, auth)
+
+	req := MakeCredentialRequest{
+		ClientDataHash:   bytes.Repeat([]byte{0x01}, 32),
+		RP:               PublicKeyCredentialRpEntity{ID: "example.com"},
+		User:             PublicKeyCredentialUserEntity{ID: []byte{0x01}},
+		PubKeyCredParams: []PublicKeyCredentialParam{{Type: "public-key", Alg: -7}},
+	}
+	data, err := ctap2EncMode.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+
+	response, err := handler.handleMakeCredential(data)
+	if err != nil {
+		t.Fatalf("handleMakeCredential() failed: %v", err)
+	}
+	if response[0] != CTAP1ErrSuccess {
+		t.Fatalf("expected success status byte, got 0x%02x", response[0])
+	}
+
+	var resp MakeCredentialResponse
+	if err := cbor.Unmarshal(response[1:], &resp); err != nil {
+		t.Fatalf("failed to decode MakeCredentialResponse: %v", err)
+	}
+	if resp.Fmt == "" {
+		t.Error("expected a non-empty attestation format")
+	}
+}
+
+// TestMakeCredentialInvalidCBOR verifies malformed CBOR is rejected with the
+// CTAP2 invalid-CBOR status rather than a Go panic.
+func TestMakeCredentialInvalidCBOR(t *testing.T) {
+	auth, err := NewInMemoryAuthenticator(t.TempDir() + "/attestation.json")
+	if err != nil {
+		t.Fatalf("NewInMemoryAuthenticator() failed: %v", err)
+	}
+	handler := NewHandler(nil, auth)
+
+	garbage, _ := hex.DecodeString("ff")
+	response, err := handler.handleMakeCredential(garbage)
+	if err != nil {
+		t.Fatalf("handleMakeCredential() returned error: %v", err)
+	}
+	if response[0] != CTAP2ErrInvalidCBOR {
+		t.Errorf("status = 0x%02x, want CTAP2ErrInvalidCBOR (0x%02x)", response[0], CTAP2ErrInvalidCBOR)
+	}
+}
+
+func TestResetClearsCredentials(t *testing.T) {
+	auth, err := NewInMemoryAuthenticator(t.TempDir() + "/attestation.json")
+	if err != nil {
+		t.Fatalf("NewInMemoryAuthenticator() failed: %v", err)
+	}
+	ctx := context.Background()
+
+	_, err = auth.MakeCredential(ctx, MakeCredentialRequest{
+		RP:   PublicKeyCredentialRpEntity{ID: "example.com"},
+		User: PublicKeyCredentialUserEntity{ID: []byte{0x01}},
+	})
+	if err != nil {
+		t.Fatalf("MakeCredential() failed: %v", err)
+	}
+
+	if err := auth.Reset(ctx); err != nil {
+		t.Fatalf("Reset() failed: %v", err)
+	}
+
+	if _, err := auth.GetAssertion(ctx, GetAssertionRequest{RPID: "example.com"}); err == nil {
+		t.Error("expected GetAssertion to fail after Reset, but it succeeded")
+	}
+}
+
+// TestProcessCTAP2MessageEmitsEvents checks that ProcessCTAP2Message emits
+// a ctap2_request/ctap2_response pair (not an error event) to Handler.Events
+// for a successful command.
+func TestProcessCTAP2MessageEmitsEvents(t *testing.T) {
+	auth, err := NewInMemoryAuthenticator(t.TempDir() + "/attestation.json")
+	if err != nil {
+		t.Fatalf("NewInMemoryAuthenticator() failed: %v", err)
+	}
+	emitter, err := events.NewEmitter(t.TempDir() + "/events.ndjson")
+	if err != nil {
+		t.Fatalf("NewEmitter() failed: %v", err)
+	}
+	handler := NewHandler(nil, auth)
+	handler.Events = emitter
+
+	message := &CTAP2Message{Command: CTAP2GetInfo}
+	response, err := handler.ProcessCTAP2Message(message)
+	if err != nil {
+		t.Fatalf("ProcessCTAP2Message() failed: %v", err)
+	}
+	if response[0] != CTAP1ErrSuccess {
+		t.Fatalf("expected success status byte, got 0x%02x", response[0])
+	}
+
+	rendered := emitter.Metrics.Render()
+	if !bytes.Contains([]byte(rendered), []byte(`command="0x04"`)) {
+		t.Errorf("expected a ctap2_command_latency_seconds observation for command 0x04, got:\n%s", rendered)
+	}
+	if bytes.Contains([]byte(rendered), []byte(`ctap2_hybrid_errors_total{class=`)) {
+		t.Errorf("expected no error events for a successful command, got:\n%s", rendered)
+	}
+}
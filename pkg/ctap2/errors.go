@@ -0,0 +1,31 @@
+package ctap2
+
+import (
+	"errors"
+	"fmt"
+)
+
+// StatusError carries a specific CTAP2 response status byte (e.g.
+// CTAP2ErrPinInvalid, CTAP2ErrPinBlocked) out of an Authenticator method, so
+// that Handler can report the precise failure instead of a generic one.
+type StatusError struct {
+	Code byte
+	Msg  string
+}
+
+func (e *StatusError) Error() string { return e.Msg }
+
+// newStatusError builds a StatusError with a formatted message.
+func newStatusError(code byte, format string, args ...interface{}) error {
+	return &StatusError{Code: code, Msg: fmt.Sprintf(format, args...)}
+}
+
+// statusCodeOf returns err's CTAP2 status code if it is (or wraps) a
+// StatusError, otherwise fallback.
+func statusCodeOf(err error, fallback byte) byte {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	return fallback
+}
@@ -0,0 +1,216 @@
+package ctap2
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"ctap2-hybrid-transport/pkg/ble"
+	"ctap2-hybrid-transport/pkg/events"
+	"ctap2-hybrid-transport/pkg/tunnel"
+)
+
+// UserVerificationHook is invoked before an authenticator operation that
+// requires user verification (e.g. a PIN prompt or biometric check).
+// Returning an error aborts the in-flight CTAP2 command with
+// CTAP2ErrOperationDenied.
+type UserVerificationHook func(ctx context.Context) error
+
+// HybridClient drives a full caBLE v2 hybrid transport exchange: it waits
+// for the phone's BLE advertisement, opens the tunnel connection, and runs
+// the CTAP2 request/response loop against an Authenticator until a
+// credential has been created or the context is cancelled. It ties
+// together ble.CableV2Decryptor (via ble.Scanner), tunnel.Connection, and
+// the CTAP2 CBOR codec.
+type HybridClient struct {
+	qrSecret   []byte
+	privateKey []byte
+	publicKey  []byte
+
+	authenticator Authenticator
+
+	// OnUserVerification, if set, is called before authenticatorMakeCredential
+	// and authenticatorGetAssertion are forwarded to the authenticator.
+	OnUserVerification UserVerificationHook
+
+	// Events, if set, receives ble_adv_received/tunnel_connected/error
+	// records for this ceremony, and is passed through to the Handler it
+	// creates so CTAP2 request/response records share the same stream.
+	Events *events.Emitter
+
+	tunnelClient *tunnel.Client
+	linkingInfo  *tunnel.LinkingInfo
+}
+
+// NewHybridClient creates a HybridClient for a single authentication
+// ceremony. qrSecret/privateKey/publicKey come from the QR code session
+// (see pkg/qrcode), and authenticator services the CTAP2 commands once the
+// tunnel is established.
+func NewHybridClient(qrSecret, privateKey, publicKey []byte, authenticator Authenticator) *HybridClient {
+	return &HybridClient{
+		qrSecret:      qrSecret,
+		privateKey:    privateKey,
+		publicKey:     publicKey,
+		authenticator: authenticator,
+	}
+}
+
+// NewHybridClientForReconnect creates a HybridClient for the
+// state-assisted reconnect flow (see Reconnect): it has no QR secret of
+// its own since a reconnect skips the QR/BLE ceremony, reusing the
+// identity keypair persisted from the original pairing instead.
+func NewHybridClientForReconnect(privateKey, publicKey []byte, authenticator Authenticator) *HybridClient {
+	return &HybridClient{
+		privateKey:    privateKey,
+		publicKey:     publicKey,
+		authenticator: authenticator,
+	}
+}
+
+// LinkingInfo returns the linking info the phone sent in the most recent
+// handshake's mandatory post-handshake message, or nil before any
+// handshake has completed. Callers (see pkg/linking) persist this to skip
+// the QR/BLE ceremony on a later run.
+func (c *HybridClient) LinkingInfo() *tunnel.LinkingInfo {
+	return c.linkingInfo
+}
+
+// TunnelURL returns the tunnel service URL the most recent handshake
+// connected to, or "" before any handshake has completed.
+func (c *HybridClient) TunnelURL() string {
+	if c.tunnelClient == nil {
+		return ""
+	}
+	tunnelURL, _, _ := c.tunnelClient.GetTunnelInfo()
+	return tunnelURL
+}
+
+// Authenticate waits for the phone to advertise, establishes the tunnel
+// connection, and services CTAP2 commands until authenticatorMakeCredential
+// succeeds, returning the resulting attestation. The context governs both
+// the BLE wait and the whole exchange; cancelling it aborts the ceremony.
+func (c *HybridClient) Authenticate(ctx context.Context) (*AttestationData, error) {
+	scanner, err := ble.NewScanner(c.qrSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BLE scanner: %w", err)
+	}
+
+	tunnelClient, err := tunnel.NewClient("", c.privateKey, c.publicKey, c.qrSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tunnel client: %w", err)
+	}
+
+	log.Printf("HybridClient: waiting for BLE advertisement and connecting to tunnel service")
+	start := time.Now()
+	conn, err := tunnelClient.AwaitAdvertAndConnect(ctx, scanner)
+	if err != nil {
+		c.Events.Emit(events.Event{Stage: events.StageError, Class: "ble", Err: err.Error()})
+		return nil, fmt.Errorf("failed to connect to tunnel service: %w", err)
+	}
+	defer conn.Close()
+	c.Events.Emit(events.Event{Stage: events.StageBLEAdvReceived, DurationMS: float64(time.Since(start).Microseconds()) / 1000})
+
+	c.tunnelClient = tunnelClient
+	c.linkingInfo = conn.LinkingInfo()
+
+	return c.serveCTAP(ctx, conn)
+}
+
+// Reconnect re-establishes a tunnel connection to a previously-linked
+// authenticator using its persisted contact ID and pairing secret instead
+// of waiting for a fresh BLE advertisement (the caBLE v2 state-assisted
+// reconnect flow), then services CTAP2 commands exactly like Authenticate
+// until authenticatorMakeCredential succeeds.
+func (c *HybridClient) Reconnect(ctx context.Context, tunnelURL string, contactID []byte, linkingData *tunnel.LinkingInfo) (*AttestationData, error) {
+	tunnelClient, err := tunnel.NewReconnectClient(tunnelURL, c.privateKey, c.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tunnel client: %w", err)
+	}
+
+	log.Printf("HybridClient: reconnecting to %s using stored contact ID", tunnelURL)
+	start := time.Now()
+	conn, err := tunnelClient.Reconnect(ctx, contactID, linkingData)
+	if err != nil {
+		c.Events.Emit(events.Event{Stage: events.StageError, Class: "tunnel", Err: err.Error()})
+		return nil, fmt.Errorf("failed to reconnect to tunnel service: %w", err)
+	}
+	defer conn.Close()
+	c.Events.Emit(events.Event{Stage: events.StageTunnelConnected, DurationMS: float64(time.Since(start).Microseconds()) / 1000})
+
+	c.tunnelClient = tunnelClient
+	c.linkingInfo = conn.LinkingInfo()
+
+	return c.serveCTAP(ctx, conn)
+}
+
+// serveCTAP runs the CTAP2 request/response loop shared by Authenticate
+// and Reconnect against an already-established conn, servicing commands
+// against c.authenticator until authenticatorMakeCredential succeeds or
+// ctx is cancelled.
+func (c *HybridClient) serveCTAP(ctx context.Context, conn *tunnel.Connection) (*AttestationData, error) {
+	handler := NewHandler(conn, c.authenticator)
+	handler.Events = c.Events
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		rawMessage, err := conn.ReadCTAP()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CTAP2 message: %w", err)
+		}
+
+		message, err := ParseCTAP2Message(rawMessage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CTAP2 message: %w", err)
+		}
+
+		if message.Command == CTAP2MakeCredential || message.Command == CTAP2GetAssertion {
+			if c.OnUserVerification != nil {
+				if err := c.OnUserVerification(ctx); err != nil {
+					if werr := conn.WriteCTAP([]byte{CTAP2ErrOperationDenied}); werr != nil {
+						log.Printf("HybridClient: failed to send user-verification denial: %v", werr)
+					}
+					continue
+				}
+			}
+		}
+
+		response, err := handler.ProcessCTAP2Message(message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process CTAP2 message: %w", err)
+		}
+
+		if err := conn.WriteCTAP(response); err != nil {
+			return nil, fmt.Errorf("failed to send CTAP2 response: %w", err)
+		}
+
+		if message.Command == CTAP2MakeCredential && len(response) > 0 && response[0] == CTAP1ErrSuccess {
+			return attestationFromResponse(response[1:])
+		}
+	}
+}
+
+// attestationFromResponse decodes a successful authenticatorMakeCredential
+// response body into the repo's AttestationData shape.
+func attestationFromResponse(body []byte) (*AttestationData, error) {
+	var resp MakeCredentialResponse
+	if err := cbor.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode MakeCredential response: %w", err)
+	}
+
+	return &AttestationData{
+		Timestamp: time.Now(),
+		AttestationObject: map[string]interface{}{
+			"fmt":      resp.Fmt,
+			"authData": resp.AuthData,
+			"attStmt":  resp.AttStmt,
+		},
+	}, nil
+}
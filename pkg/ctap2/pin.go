@@ -0,0 +1,281 @@
+package ctap2
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+)
+
+const (
+	pinMinLength = 4
+	pinMaxLength = 63
+)
+
+// ClientPIN implements authenticatorClientPIN subCommand dispatch (CTAP2.1
+// section 6.5).
+func (a *InMemoryAuthenticator) ClientPIN(ctx context.Context, req ClientPINRequest) (ClientPINResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch req.SubCommand {
+	case PinSubCmdGetPINRetries:
+		return ClientPINResponse{
+			PinRetries:      uint64(a.pinStore.Retries()),
+			PowerCycleState: a.pinStore.ConsecutiveFailures() >= pinMaxConsecutiveRetries,
+		}, nil
+	case PinSubCmdGetUVRetries:
+		return ClientPINResponse{}, newStatusError(CTAP2ErrInvalidOption, "built-in user verification is not supported")
+	case PinSubCmdGetKeyAgreement:
+		return a.handleGetKeyAgreement(req)
+	case PinSubCmdSetPIN:
+		return a.handleSetPIN(req)
+	case PinSubCmdChangePIN:
+		return a.handleChangePIN(req)
+	case PinSubCmdGetPINToken:
+		return a.handleGetPinToken(req, PermissionMakeCredential|PermissionGetAssertion)
+	case PinSubCmdGetPinUvAuthTokenUsingPinWithPermissions:
+		return a.handleGetPinToken(req, uint8(req.Permissions))
+	case PinSubCmdGetPinUvAuthTokenUsingUvWithPermissions:
+		return ClientPINResponse{}, newStatusError(CTAP2ErrInvalidOption, "built-in user verification is not supported")
+	default:
+		return ClientPINResponse{}, newStatusError(CTAP1ErrInvalidParameter, "unsupported ClientPIN subCommand 0x%02x", req.SubCommand)
+	}
+}
+
+// handleGetKeyAgreement generates a fresh ECDH key-agreement keypair for
+// req.PinUvAuthProtocol and returns its public half. Must be called with
+// a.mu held.
+func (a *InMemoryAuthenticator) handleGetKeyAgreement(req ClientPINRequest) (ClientPINResponse, error) {
+	if _, err := NewPinUvAuthProtocol(req.PinUvAuthProtocol); err != nil {
+		return ClientPINResponse{}, newStatusError(CTAP1ErrInvalidParameter, "%v", err)
+	}
+
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return ClientPINResponse{}, fmt.Errorf("failed to generate key-agreement key: %w", err)
+	}
+	a.keyAgreementKeys[req.PinUvAuthProtocol] = priv
+
+	pub := publicKeyToCOSE(priv.PublicKey())
+	return ClientPINResponse{KeyAgreement: &pub}, nil
+}
+
+// sharedSecretFor derives the ECDH shared secret for req against the
+// authenticator's current key-agreement key for req.PinUvAuthProtocol. Must
+// be called with a.mu held.
+func (a *InMemoryAuthenticator) sharedSecretFor(req ClientPINRequest) (PinUvAuthProtocol, []byte, error) {
+	proto, err := NewPinUvAuthProtocol(req.PinUvAuthProtocol)
+	if err != nil {
+		return nil, nil, newStatusError(CTAP1ErrInvalidParameter, "%v", err)
+	}
+	if req.KeyAgreement == nil {
+		return nil, nil, newStatusError(CTAP2ErrMissingParameter, "missing keyAgreement")
+	}
+	priv, ok := a.keyAgreementKeys[req.PinUvAuthProtocol]
+	if !ok {
+		return nil, nil, newStatusError(CTAP2ErrPinAuthInvalid, "getKeyAgreement was not called for pinUvAuthProtocol %d", req.PinUvAuthProtocol)
+	}
+	secret, err := proto.SharedSecret(priv, *req.KeyAgreement)
+	if err != nil {
+		return nil, nil, newStatusError(CTAP1ErrInvalidParameter, "%v", err)
+	}
+	return proto, secret, nil
+}
+
+// decodePaddedPIN decrypts and unpads a newPinEnc value, validating its
+// length against the CTAP2 PIN length bounds.
+func decodePaddedPIN(proto PinUvAuthProtocol, sharedSecret, newPinEnc []byte) ([]byte, error) {
+	padded, err := proto.Decrypt(sharedSecret, newPinEnc)
+	if err != nil {
+		return nil, err
+	}
+	pin := bytes.TrimRight(padded, "\x00")
+	if len(pin) < pinMinLength || len(pin) > pinMaxLength {
+		return nil, fmt.Errorf("PIN length %d is outside the allowed range [%d,%d]", len(pin), pinMinLength, pinMaxLength)
+	}
+	return pin, nil
+}
+
+// verifyPinHash decrypts pinHashEnc and compares it against the stored PIN
+// hash, applying the 3-consecutive / 8-total retry lockout rules and
+// persisting the updated counters. Must be called with a.mu held.
+func (a *InMemoryAuthenticator) verifyPinHash(proto PinUvAuthProtocol, sharedSecret, pinHashEnc []byte) error {
+	if a.pinStore.Retries() <= 0 {
+		return newStatusError(CTAP2ErrPinBlocked, "PIN is permanently blocked; an authenticatorReset is required")
+	}
+	if a.pinStore.ConsecutiveFailures() >= pinMaxConsecutiveRetries {
+		return newStatusError(CTAP2ErrPinAuthBlocked, "PIN entry is blocked until the next power cycle")
+	}
+
+	hash, err := proto.Decrypt(sharedSecret, pinHashEnc)
+	if err != nil {
+		return newStatusError(CTAP1ErrInvalidParameter, "%v", err)
+	}
+
+	if subtle.ConstantTimeCompare(hash, a.pinStore.Hash()) != 1 {
+		retries, consecutive, ferr := a.pinStore.RegisterFailure()
+		if ferr != nil {
+			return fmt.Errorf("failed to persist PIN retry state: %w", ferr)
+		}
+		if retries <= 0 {
+			return newStatusError(CTAP2ErrPinBlocked, "PIN is permanently blocked; an authenticatorReset is required")
+		}
+		if consecutive >= pinMaxConsecutiveRetries {
+			return newStatusError(CTAP2ErrPinAuthBlocked, "PIN entry is blocked until the next power cycle")
+		}
+		return newStatusError(CTAP2ErrPinInvalid, "incorrect PIN")
+	}
+
+	if err := a.pinStore.RegisterSuccess(); err != nil {
+		return fmt.Errorf("failed to persist PIN retry state: %w", err)
+	}
+	return nil
+}
+
+// handleSetPIN implements the setPIN subCommand. It is only valid while no
+// PIN is configured yet; use changePIN afterwards. Must be called with a.mu
+// held.
+func (a *InMemoryAuthenticator) handleSetPIN(req ClientPINRequest) (ClientPINResponse, error) {
+	if a.pinStore.IsSet() {
+		return ClientPINResponse{}, newStatusError(CTAP2ErrPinAuthInvalid, "a PIN is already set; use changePIN")
+	}
+	proto, secret, err := a.sharedSecretFor(req)
+	if err != nil {
+		return ClientPINResponse{}, err
+	}
+	if len(req.NewPinEnc) == 0 || len(req.PinUvAuthParam) == 0 {
+		return ClientPINResponse{}, newStatusError(CTAP2ErrMissingParameter, "missing newPinEnc or pinUvAuthParam")
+	}
+	if !hmac.Equal(proto.Authenticate(secret, req.NewPinEnc), req.PinUvAuthParam) {
+		return ClientPINResponse{}, newStatusError(CTAP2ErrPinAuthInvalid, "pinUvAuthParam does not match newPinEnc")
+	}
+
+	pin, err := decodePaddedPIN(proto, secret, req.NewPinEnc)
+	if err != nil {
+		return ClientPINResponse{}, newStatusError(CTAP2ErrPinPolicyViolation, "%v", err)
+	}
+	hash := sha256.Sum256(pin)
+	if err := a.pinStore.SetHash(hash[:16]); err != nil {
+		return ClientPINResponse{}, fmt.Errorf("failed to persist PIN: %w", err)
+	}
+	return ClientPINResponse{}, nil
+}
+
+// handleChangePIN implements the changePIN subCommand. Must be called with
+// a.mu held.
+func (a *InMemoryAuthenticator) handleChangePIN(req ClientPINRequest) (ClientPINResponse, error) {
+	if !a.pinStore.IsSet() {
+		return ClientPINResponse{}, newStatusError(CTAP2ErrPinNotSet, "no PIN is set")
+	}
+	proto, secret, err := a.sharedSecretFor(req)
+	if err != nil {
+		return ClientPINResponse{}, err
+	}
+	if len(req.NewPinEnc) == 0 || len(req.PinHashEnc) == 0 || len(req.PinUvAuthParam) == 0 {
+		return ClientPINResponse{}, newStatusError(CTAP2ErrMissingParameter, "missing newPinEnc, pinHashEnc or pinUvAuthParam")
+	}
+
+	message := append(append([]byte{}, req.NewPinEnc...), req.PinHashEnc...)
+	if !hmac.Equal(proto.Authenticate(secret, message), req.PinUvAuthParam) {
+		return ClientPINResponse{}, newStatusError(CTAP2ErrPinAuthInvalid, "pinUvAuthParam does not match newPinEnc || pinHashEnc")
+	}
+
+	if err := a.verifyPinHash(proto, secret, req.PinHashEnc); err != nil {
+		return ClientPINResponse{}, err
+	}
+
+	pin, err := decodePaddedPIN(proto, secret, req.NewPinEnc)
+	if err != nil {
+		return ClientPINResponse{}, newStatusError(CTAP2ErrPinPolicyViolation, "%v", err)
+	}
+	hash := sha256.Sum256(pin)
+	if err := a.pinStore.SetHash(hash[:16]); err != nil {
+		return ClientPINResponse{}, fmt.Errorf("failed to persist PIN: %w", err)
+	}
+	a.currentToken = nil
+	return ClientPINResponse{}, nil
+}
+
+// handleGetPinToken implements getPinToken and
+// getPinUvAuthTokenUsingPinWithPermissions. defaultPermissions is used when
+// req carries none (the legacy getPinToken subCommand does not send a
+// permissions field). Must be called with a.mu held.
+func (a *InMemoryAuthenticator) handleGetPinToken(req ClientPINRequest, defaultPermissions uint8) (ClientPINResponse, error) {
+	if !a.pinStore.IsSet() {
+		return ClientPINResponse{}, newStatusError(CTAP2ErrPinNotSet, "no PIN is set")
+	}
+	proto, secret, err := a.sharedSecretFor(req)
+	if err != nil {
+		return ClientPINResponse{}, err
+	}
+	if len(req.PinHashEnc) == 0 {
+		return ClientPINResponse{}, newStatusError(CTAP2ErrMissingParameter, "missing pinHashEnc")
+	}
+	if err := a.verifyPinHash(proto, secret, req.PinHashEnc); err != nil {
+		return ClientPINResponse{}, err
+	}
+
+	permissions := uint8(req.Permissions)
+	if permissions == 0 {
+		permissions = defaultPermissions
+	}
+	if permissions == 0 {
+		return ClientPINResponse{}, newStatusError(CTAP2ErrMissingParameter, "missing permissions")
+	}
+
+	value := make([]byte, 32)
+	if _, err := rand.Read(value); err != nil {
+		return ClientPINResponse{}, fmt.Errorf("failed to generate pinUvAuthToken: %w", err)
+	}
+	a.currentToken = &pinUvAuthToken{
+		value:       value,
+		protocol:    req.PinUvAuthProtocol,
+		permissions: permissions,
+		rpID:        req.RPID,
+	}
+
+	enc, err := proto.Encrypt(secret, value)
+	if err != nil {
+		return ClientPINResponse{}, fmt.Errorf("failed to encrypt pinUvAuthToken: %w", err)
+	}
+	return ClientPINResponse{PinUvAuthToken: enc}, nil
+}
+
+// verifyPinUvAuthToken checks a pinUvAuthParam presented alongside
+// MakeCredential/GetAssertion against the currently issued pinUvAuthToken.
+// If no PIN has ever been set, the check is skipped entirely so that the
+// authenticator keeps behaving like a no-PIN device. Must be called with
+// a.mu held.
+func (a *InMemoryAuthenticator) verifyPinUvAuthToken(pinUvAuthParam []byte, pinUvAuthProtocol uint64, message []byte, permission uint8, rpID string) error {
+	if !a.pinStore.IsSet() {
+		return nil
+	}
+	if len(pinUvAuthParam) == 0 {
+		return newStatusError(CTAP2ErrPinRequired, "pinUvAuthParam is required once a PIN is set")
+	}
+	if a.currentToken == nil {
+		return newStatusError(CTAP2ErrPinAuthInvalid, "no pinUvAuthToken has been obtained")
+	}
+	if a.currentToken.protocol != pinUvAuthProtocol {
+		return newStatusError(CTAP2ErrPinAuthInvalid, "pinUvAuthProtocol does not match the issued token")
+	}
+	proto, err := NewPinUvAuthProtocol(pinUvAuthProtocol)
+	if err != nil {
+		return newStatusError(CTAP1ErrInvalidParameter, "%v", err)
+	}
+	if !hmac.Equal(proto.Authenticate(a.currentToken.value, message), pinUvAuthParam) {
+		return newStatusError(CTAP2ErrPinAuthInvalid, "pinUvAuthParam is invalid")
+	}
+	if !a.currentToken.hasPermission(permission) {
+		return newStatusError(CTAP2ErrUnauthorizedPermission, "pinUvAuthToken does not have the required permission")
+	}
+	if !a.currentToken.allowsRPID(rpID) {
+		return newStatusError(CTAP2ErrUnauthorizedPermission, "pinUvAuthToken is bound to a different rpId")
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package ctap2
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// PinUvAuthProtocol implements the shared-secret derivation and the
+// encrypt/decrypt/authenticate primitives built on it, for one of the two
+// CTAP2.1 PIN/UV auth protocols (section 6.5.6). Authenticator owns the
+// ECDH key-agreement keypair lifecycle; the protocol only knows how to turn
+// an ECDH Z value into usable keys and use them.
+type PinUvAuthProtocol interface {
+	// Version is the pinUvAuthProtocol identifier (1 or 2).
+	Version() uint64
+
+	// SharedSecret runs ECDH between priv and the peer's COSE_Key EC2
+	// point, then the protocol's KDF over the resulting Z value.
+	SharedSecret(priv *ecdh.PrivateKey, peer COSEKey) ([]byte, error)
+
+	// Encrypt encrypts plaintext (which must already be a multiple of the
+	// AES block size) under sharedSecret.
+	Encrypt(sharedSecret, plaintext []byte) ([]byte, error)
+
+	// Decrypt is the inverse of Encrypt.
+	Decrypt(sharedSecret, ciphertext []byte) ([]byte, error)
+
+	// Authenticate computes the pinUvAuthParam-style MAC of message under
+	// sharedSecret.
+	Authenticate(sharedSecret, message []byte) []byte
+}
+
+// NewPinUvAuthProtocol returns the protocol implementation for the given
+// pinUvAuthProtocol version (1 or 2).
+func NewPinUvAuthProtocol(version uint64) (PinUvAuthProtocol, error) {
+	switch version {
+	case 1:
+		return pinUvAuthProtocol1{}, nil
+	case 2:
+		return pinUvAuthProtocol2{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported pinUvAuthProtocol %d", version)
+	}
+}
+
+// coseKeyToECDH converts a COSE_Key EC2 point into an ecdh.PublicKey.
+func coseKeyToECDH(k COSEKey) (*ecdh.PublicKey, error) {
+	if len(k.X) != 32 || len(k.Y) != 32 {
+		return nil, fmt.Errorf("invalid P-256 COSE_Key coordinates")
+	}
+	point := make([]byte, 0, 65)
+	point = append(point, 0x04)
+	point = append(point, k.X...)
+	point = append(point, k.Y...)
+	return ecdh.P256().NewPublicKey(point)
+}
+
+// ecdhZ performs ECDH and returns the raw shared point's X-coordinate (Z).
+func ecdhZ(priv *ecdh.PrivateKey, peer COSEKey) ([]byte, error) {
+	pub, err := coseKeyToECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse peer key-agreement key: %w", err)
+	}
+	z, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, fmt.Errorf("ECDH failed: %w", err)
+	}
+	return z, nil
+}
+
+// publicKeyToCOSE encodes an ECDH P-256 public key as a COSE_Key.
+func publicKeyToCOSE(pub *ecdh.PublicKey) COSEKey {
+	raw := pub.Bytes() // 0x04 || X || Y
+	return COSEKey{
+		Kty: coseKtyEC2,
+		Alg: coseAlgECDHES,
+		Crv: coseCrvP256,
+		X:   append([]byte(nil), raw[1:33]...),
+		Y:   append([]byte(nil), raw[33:65]...),
+	}
+}
+
+const (
+	coseKtyEC2    = 2
+	coseAlgECDHES = -25 // ECDH-ES + HKDF-256, per CTAP2's use of COSE_Key for keyAgreement
+	coseCrvP256   = 1
+)
+
+// pinUvAuthProtocol1 is PIN/UV Auth Protocol One: sharedSecret = SHA-256(Z),
+// used directly as both the AES-256-CBC key (zero IV) and the HMAC-SHA-256
+// key (tag truncated to 16 bytes).
+type pinUvAuthProtocol1 struct{}
+
+func (pinUvAuthProtocol1) Version() uint64 { return 1 }
+
+func (pinUvAuthProtocol1) SharedSecret(priv *ecdh.PrivateKey, peer COSEKey) ([]byte, error) {
+	z, err := ecdhZ(priv, peer)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(z)
+	return sum[:], nil
+}
+
+func (pinUvAuthProtocol1) Encrypt(sharedSecret, plaintext []byte) ([]byte, error) {
+	return aesCBCEncrypt(sharedSecret, make([]byte, aes.BlockSize), plaintext)
+}
+
+func (pinUvAuthProtocol1) Decrypt(sharedSecret, ciphertext []byte) ([]byte, error) {
+	return aesCBCDecrypt(sharedSecret, make([]byte, aes.BlockSize), ciphertext)
+}
+
+func (pinUvAuthProtocol1) Authenticate(sharedSecret, message []byte) []byte {
+	mac := hmac.New(sha256.New, sharedSecret)
+	mac.Write(message)
+	return mac.Sum(nil)[:16]
+}
+
+// pinUvAuthProtocol2 is PIN/UV Auth Protocol Two: sharedSecret is two
+// HKDF-SHA-256-derived 32-byte keys (HMAC key then AES key) over Z; Encrypt
+// prepends a random IV, and Authenticate returns the full 32-byte HMAC tag.
+type pinUvAuthProtocol2 struct{}
+
+func (pinUvAuthProtocol2) Version() uint64 { return 2 }
+
+func (pinUvAuthProtocol2) SharedSecret(priv *ecdh.PrivateKey, peer COSEKey) ([]byte, error) {
+	z, err := ecdhZ(priv, peer)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, sha256.Size) // all-zero salt, per spec
+	hmacKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, z, salt, []byte("CTAP2 HMAC key")), hmacKey); err != nil {
+		return nil, fmt.Errorf("HKDF failed for HMAC key: %w", err)
+	}
+	aesKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, z, salt, []byte("CTAP2 AES key")), aesKey); err != nil {
+		return nil, fmt.Errorf("HKDF failed for AES key: %w", err)
+	}
+	return append(hmacKey, aesKey...), nil
+}
+
+func (pinUvAuthProtocol2) Encrypt(sharedSecret, plaintext []byte) ([]byte, error) {
+	aesKey := sharedSecret[32:64]
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("failed to generate IV: %w", err)
+	}
+	ciphertext, err := aesCBCEncrypt(aesKey, iv, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return append(iv, ciphertext...), nil
+}
+
+func (pinUvAuthProtocol2) Decrypt(sharedSecret, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aes.BlockSize {
+		return nil, fmt.Errorf("ciphertext too short to contain an IV")
+	}
+	aesKey := sharedSecret[32:64]
+	return aesCBCDecrypt(aesKey, ciphertext[:aes.BlockSize], ciphertext[aes.BlockSize:])
+}
+
+func (pinUvAuthProtocol2) Authenticate(sharedSecret, message []byte) []byte {
+	hmacKey := sharedSecret[:32]
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+func aesCBCEncrypt(key, iv, plaintext []byte) ([]byte, error) {
+	if len(plaintext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("plaintext length %d is not a multiple of the AES block size", len(plaintext))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+	return ciphertext, nil
+}
+
+func aesCBCDecrypt(key, iv, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("ciphertext length %d is not a multiple of the AES block size", len(ciphertext))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	return plaintext, nil
+}
@@ -0,0 +1,126 @@
+package ctap2
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// pinMaxConsecutiveRetries is the number of wrong-PIN attempts allowed
+	// before the authenticator must be power-cycled (CTAP2ErrPinAuthBlocked).
+	pinMaxConsecutiveRetries = 3
+	// pinMaxTotalRetries is the number of wrong-PIN attempts allowed in
+	// total before the PIN is permanently blocked (CTAP2ErrPinBlocked),
+	// requiring a full authenticatorReset.
+	pinMaxTotalRetries = 8
+)
+
+// PinStore persists the authenticator's PIN hash and retry counters across
+// process restarts, the same way InMemoryAuthenticator persists credentials
+// to outputFile.
+type PinStore interface {
+	// IsSet reports whether a PIN has been configured.
+	IsSet() bool
+	// Hash returns the left 16 bytes of SHA-256(pin) currently on file.
+	Hash() []byte
+	// SetHash records a new PIN hash and resets retry counters.
+	SetHash(hash []byte) error
+	// Retries returns the remaining total retry count.
+	Retries() int
+	// ConsecutiveFailures returns the count of consecutive wrong attempts
+	// since the last correct PIN or power cycle.
+	ConsecutiveFailures() int
+	// RegisterFailure records one more wrong attempt, decrementing the
+	// total retry counter, and returns the updated counters.
+	RegisterFailure() (retries int, consecutive int, err error)
+	// RegisterSuccess clears the consecutive-failure counter.
+	RegisterSuccess() error
+	// ResetPowerCycle clears the consecutive-failure counter, simulating
+	// a power cycle (the only way to clear a CTAP2ErrPinAuthBlocked state).
+	ResetPowerCycle()
+}
+
+// filePinStoreState is the JSON document persisted to outputFile's
+// directory.
+type filePinStoreState struct {
+	Hash    []byte `json:"hash,omitempty"`
+	Retries int    `json:"retries"`
+}
+
+// FilePinStore is the default PinStore, persisting PIN state as JSON
+// alongside the authenticator's other output file.
+type FilePinStore struct {
+	path                string
+	state               filePinStoreState
+	consecutiveFailures int
+}
+
+const pinStoreFileName = "pin-store.json"
+
+// NewFilePinStore loads (or initializes) PIN state from a file named
+// pin-store.json next to outputFile.
+func NewFilePinStore(outputFile string) (*FilePinStore, error) {
+	path := filepath.Join(filepath.Dir(outputFile), pinStoreFileName)
+
+	s := &FilePinStore{path: path, state: filePinStoreState{Retries: pinMaxTotalRetries}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read PIN store: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, fmt.Errorf("failed to parse PIN store: %w", err)
+	}
+	return s, nil
+}
+
+func (s *FilePinStore) persist() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode PIN store: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write PIN store: %w", err)
+	}
+	return nil
+}
+
+func (s *FilePinStore) IsSet() bool { return len(s.state.Hash) > 0 }
+
+func (s *FilePinStore) Hash() []byte { return s.state.Hash }
+
+func (s *FilePinStore) SetHash(hash []byte) error {
+	s.state.Hash = hash
+	s.state.Retries = pinMaxTotalRetries
+	s.consecutiveFailures = 0
+	return s.persist()
+}
+
+func (s *FilePinStore) Retries() int { return s.state.Retries }
+
+func (s *FilePinStore) ConsecutiveFailures() int { return s.consecutiveFailures }
+
+func (s *FilePinStore) RegisterFailure() (int, int, error) {
+	if s.state.Retries > 0 {
+		s.state.Retries--
+	}
+	s.consecutiveFailures++
+	if err := s.persist(); err != nil {
+		return s.state.Retries, s.consecutiveFailures, err
+	}
+	return s.state.Retries, s.consecutiveFailures, nil
+}
+
+func (s *FilePinStore) RegisterSuccess() error {
+	s.consecutiveFailures = 0
+	return nil
+}
+
+func (s *FilePinStore) ResetPowerCycle() {
+	s.consecutiveFailures = 0
+}
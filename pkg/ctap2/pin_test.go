@@ -0,0 +1,310 @@
+package ctap2
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+)
+
+// generateTestKeyAgreement returns an ephemeral ECDH P-256 keypair and its
+// public half encoded as a COSE_Key, standing in for a platform's side of
+// the getKeyAgreement exchange.
+func generateTestKeyAgreement(t *testing.T) (*ecdh.PrivateKey, COSEKey) {
+	t.Helper()
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	return priv, publicKeyToCOSE(priv.PublicKey())
+}
+
+func TestPinUvAuthProtocolSharedSecret(t *testing.T) {
+	for _, version := range []uint64{1, 2} {
+		t.Run(protocolName(version), func(t *testing.T) {
+			proto, err := NewPinUvAuthProtocol(version)
+			if err != nil {
+				t.Fatalf("NewPinUvAuthProtocol(%d) failed: %v", version, err)
+			}
+
+			platformPriv, platformPub := generateTestKeyAgreement(t)
+			authenticatorPriv, authenticatorPub := generateTestKeyAgreement(t)
+
+			platformSecret, err := proto.SharedSecret(platformPriv, authenticatorPub)
+			if err != nil {
+				t.Fatalf("platform SharedSecret() failed: %v", err)
+			}
+			authenticatorSecret, err := proto.SharedSecret(authenticatorPriv, platformPub)
+			if err != nil {
+				t.Fatalf("authenticator SharedSecret() failed: %v", err)
+			}
+
+			if !bytes.Equal(platformSecret, authenticatorSecret) {
+				t.Errorf("shared secrets differ: platform=%x authenticator=%x", platformSecret, authenticatorSecret)
+			}
+		})
+	}
+}
+
+func TestPinUvAuthProtocolAuthenticate(t *testing.T) {
+	for _, version := range []uint64{1, 2} {
+		t.Run(protocolName(version), func(t *testing.T) {
+			proto, err := NewPinUvAuthProtocol(version)
+			if err != nil {
+				t.Fatalf("NewPinUvAuthProtocol(%d) failed: %v", version, err)
+			}
+
+			secret := bytes.Repeat([]byte{0x11}, 64)
+			message := []byte("clientDataHash-or-newPinEnc")
+
+			wantLen := 16
+			if version == 2 {
+				wantLen = 32
+			}
+
+			tag := proto.Authenticate(secret, message)
+			if len(tag) != wantLen {
+				t.Errorf("Authenticate() returned %d bytes, want %d", len(tag), wantLen)
+			}
+
+			other := proto.Authenticate(secret, append(append([]byte{}, message...), 0x00))
+			if bytes.Equal(tag, other) {
+				t.Errorf("Authenticate() produced the same tag for two different messages")
+			}
+		})
+	}
+}
+
+func TestPinUvAuthProtocolEncryptDecryptRoundTrip(t *testing.T) {
+	for _, version := range []uint64{1, 2} {
+		t.Run(protocolName(version), func(t *testing.T) {
+			proto, err := NewPinUvAuthProtocol(version)
+			if err != nil {
+				t.Fatalf("NewPinUvAuthProtocol(%d) failed: %v", version, err)
+			}
+
+			secretLen := 32
+			if version == 2 {
+				secretLen = 64
+			}
+			secret := bytes.Repeat([]byte{0x22}, secretLen)
+			plaintext := bytes.Repeat([]byte{0}, 64)
+			copy(plaintext, "1234")
+
+			ciphertext, err := proto.Encrypt(secret, plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt() failed: %v", err)
+			}
+
+			got, err := proto.Decrypt(secret, ciphertext)
+			if err != nil {
+				t.Fatalf("Decrypt() failed: %v", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("round trip = %x, want %x", got, plaintext)
+			}
+
+			pin, err := decodePaddedPIN(proto, secret, ciphertext)
+			if err != nil {
+				t.Fatalf("decodePaddedPIN() failed: %v", err)
+			}
+			if string(pin) != "1234" {
+				t.Errorf("decodePaddedPIN() = %q, want %q", pin, "1234")
+			}
+		})
+	}
+}
+
+func TestDecodePaddedPINRejectsOutOfRangeLength(t *testing.T) {
+	proto, err := NewPinUvAuthProtocol(1)
+	if err != nil {
+		t.Fatalf("NewPinUvAuthProtocol(1) failed: %v", err)
+	}
+	secret := bytes.Repeat([]byte{0x33}, 32)
+
+	tooShort := make([]byte, 64)
+	copy(tooShort, "abc") // 3 bytes, below pinMinLength
+	enc, err := proto.Encrypt(secret, tooShort)
+	if err != nil {
+		t.Fatalf("Encrypt() failed: %v", err)
+	}
+	if _, err := decodePaddedPIN(proto, secret, enc); err == nil {
+		t.Errorf("decodePaddedPIN() with a too-short PIN: want error, got nil")
+	}
+}
+
+// padPIN returns pin padded with zero bytes to the 64-byte newPinEnc
+// plaintext size required by CTAP2.1.
+func padPIN(pin string) []byte {
+	padded := make([]byte, 64)
+	copy(padded, pin)
+	return padded
+}
+
+// TestClientPINSetAndUseToken exercises getKeyAgreement -> setPIN ->
+// getPinUvAuthTokenUsingPinWithPermissions -> a PIN-protected MakeCredential,
+// the full protocol-1 happy path a real platform would drive.
+func TestClientPINSetAndUseToken(t *testing.T) {
+	auth, err := NewInMemoryAuthenticator(t.TempDir() + "/attestation.json")
+	if err != nil {
+		t.Fatalf("NewInMemoryAuthenticator() failed: %v", err)
+	}
+	ctx := context.Background()
+
+	keyAgreementResp, err := auth.ClientPIN(ctx, ClientPINRequest{
+		PinUvAuthProtocol: 1,
+		SubCommand:        PinSubCmdGetKeyAgreement,
+	})
+	if err != nil {
+		t.Fatalf("getKeyAgreement failed: %v", err)
+	}
+
+	proto, err := NewPinUvAuthProtocol(1)
+	if err != nil {
+		t.Fatalf("NewPinUvAuthProtocol(1) failed: %v", err)
+	}
+	platformPriv, platformPub := generateTestKeyAgreement(t)
+	secret, err := proto.SharedSecret(platformPriv, *keyAgreementResp.KeyAgreement)
+	if err != nil {
+		t.Fatalf("SharedSecret() failed: %v", err)
+	}
+
+	newPinEnc, err := proto.Encrypt(secret, padPIN("1234"))
+	if err != nil {
+		t.Fatalf("Encrypt(newPin) failed: %v", err)
+	}
+	if _, err := auth.ClientPIN(ctx, ClientPINRequest{
+		PinUvAuthProtocol: 1,
+		SubCommand:        PinSubCmdSetPIN,
+		KeyAgreement:      &platformPub,
+		NewPinEnc:         newPinEnc,
+		PinUvAuthParam:    proto.Authenticate(secret, newPinEnc),
+	}); err != nil {
+		t.Fatalf("setPIN failed: %v", err)
+	}
+
+	pinHash := sha256.Sum256([]byte("1234"))
+	pinHashEnc, err := proto.Encrypt(secret, pinHash[:16])
+	if err != nil {
+		t.Fatalf("Encrypt(pinHash) failed: %v", err)
+	}
+	tokenResp, err := auth.ClientPIN(ctx, ClientPINRequest{
+		PinUvAuthProtocol: 1,
+		SubCommand:        PinSubCmdGetPinUvAuthTokenUsingPinWithPermissions,
+		KeyAgreement:      &platformPub,
+		PinHashEnc:        pinHashEnc,
+		Permissions:       uint64(PermissionMakeCredential),
+		RPID:              "example.com",
+	})
+	if err != nil {
+		t.Fatalf("getPinUvAuthTokenUsingPinWithPermissions failed: %v", err)
+	}
+	token, err := proto.Decrypt(secret, tokenResp.PinUvAuthToken)
+	if err != nil {
+		t.Fatalf("Decrypt(pinUvAuthToken) failed: %v", err)
+	}
+
+	clientDataHash := bytes.Repeat([]byte{0xAB}, 32)
+	_, err = auth.MakeCredential(ctx, MakeCredentialRequest{
+		ClientDataHash:    clientDataHash,
+		RP:                PublicKeyCredentialRpEntity{ID: "example.com"},
+		User:              PublicKeyCredentialUserEntity{ID: []byte{0x01}},
+		PinUvAuthParam:    proto.Authenticate(token, clientDataHash),
+		PinUvAuthProtocol: 1,
+	})
+	if err != nil {
+		t.Fatalf("MakeCredential() with a valid pinUvAuthToken failed: %v", err)
+	}
+
+	// The token only carries the mc permission, so ga must be refused.
+	_, err = auth.GetAssertion(ctx, GetAssertionRequest{
+		RPID:              "example.com",
+		ClientDataHash:    clientDataHash,
+		PinUvAuthParam:    proto.Authenticate(token, clientDataHash),
+		PinUvAuthProtocol: 1,
+	})
+	if se, ok := err.(*StatusError); !ok || se.Code != CTAP2ErrUnauthorizedPermission {
+		t.Errorf("GetAssertion() with an mc-only token: err = %v, want CTAP2ErrUnauthorizedPermission", err)
+	}
+}
+
+// TestClientPINWrongPinLockout checks the 3-consecutive PIN retry lockout
+// rule: the third wrong PIN in a row gets CTAP2ErrPinAuthBlocked. The
+// 8-total rule is not exercised here.
+func TestClientPINWrongPinLockout(t *testing.T) {
+	auth, err := NewInMemoryAuthenticator(t.TempDir() + "/attestation.json")
+	if err != nil {
+		t.Fatalf("NewInMemoryAuthenticator() failed: %v", err)
+	}
+	ctx := context.Background()
+	proto, err := NewPinUvAuthProtocol(1)
+	if err != nil {
+		t.Fatalf("NewPinUvAuthProtocol(1) failed: %v", err)
+	}
+
+	keyAgreementResp, err := auth.ClientPIN(ctx, ClientPINRequest{PinUvAuthProtocol: 1, SubCommand: PinSubCmdGetKeyAgreement})
+	if err != nil {
+		t.Fatalf("getKeyAgreement failed: %v", err)
+	}
+	platformPriv, platformPub := generateTestKeyAgreement(t)
+	secret, err := proto.SharedSecret(platformPriv, *keyAgreementResp.KeyAgreement)
+	if err != nil {
+		t.Fatalf("SharedSecret() failed: %v", err)
+	}
+
+	newPinEnc, err := proto.Encrypt(secret, padPIN("1234"))
+	if err != nil {
+		t.Fatalf("Encrypt(newPin) failed: %v", err)
+	}
+	if _, err := auth.ClientPIN(ctx, ClientPINRequest{
+		PinUvAuthProtocol: 1,
+		SubCommand:        PinSubCmdSetPIN,
+		KeyAgreement:      &platformPub,
+		NewPinEnc:         newPinEnc,
+		PinUvAuthParam:    proto.Authenticate(secret, newPinEnc),
+	}); err != nil {
+		t.Fatalf("setPIN failed: %v", err)
+	}
+
+	wrongHash := sha256.Sum256([]byte("0000"))
+	wrongHashEnc, err := proto.Encrypt(secret, wrongHash[:16])
+	if err != nil {
+		t.Fatalf("Encrypt(wrongHash) failed: %v", err)
+	}
+
+	for i := 1; i <= pinMaxConsecutiveRetries; i++ {
+		_, err := auth.ClientPIN(ctx, ClientPINRequest{
+			PinUvAuthProtocol: 1,
+			SubCommand:        PinSubCmdGetPINToken,
+			KeyAgreement:      &platformPub,
+			PinHashEnc:        wrongHashEnc,
+		})
+		se, ok := err.(*StatusError)
+		if !ok {
+			t.Fatalf("attempt %d: err = %v, want *StatusError", i, err)
+		}
+		wantCode := byte(CTAP2ErrPinInvalid)
+		if i == pinMaxConsecutiveRetries {
+			wantCode = CTAP2ErrPinAuthBlocked
+		}
+		if se.Code != wantCode {
+			t.Errorf("attempt %d: status = 0x%02x, want 0x%02x", i, se.Code, wantCode)
+		}
+	}
+
+	// Recovery by a power cycle (a fresh authenticator against the same
+	// outputFile/PIN store) is not exercised here.
+}
+
+func protocolName(version uint64) string {
+	switch version {
+	case 1:
+		return "protocol1"
+	case 2:
+		return "protocol2"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,32 @@
+package ctap2
+
+// PinUvAuthToken permission bits (CTAP2.1 section 6.5.5.7).
+const (
+	PermissionMakeCredential       uint8 = 0x01 // mc
+	PermissionGetAssertion         uint8 = 0x02 // ga
+	PermissionCredentialManagement uint8 = 0x04 // cm
+	PermissionBioEnrollment        uint8 = 0x08 // be
+	PermissionLargeBlobWrite       uint8 = 0x10 // lbw
+	PermissionAuthenticatorConfig  uint8 = 0x20 // acfg
+)
+
+// pinUvAuthToken is an issued token: a random value the platform uses as the
+// PinUvAuthProtocol HMAC key on subsequent commands, scoped to a set of
+// permissions and, optionally, a single rpId.
+type pinUvAuthToken struct {
+	value       []byte
+	protocol    uint64
+	permissions uint8
+	rpID        string // empty means not bound to any rpId
+}
+
+// hasPermission reports whether the token grants permission p.
+func (t *pinUvAuthToken) hasPermission(p uint8) bool {
+	return t != nil && t.permissions&p != 0
+}
+
+// allowsRPID reports whether the token may be used for rpID: unbound tokens
+// (rpID == "") allow any RP, bound tokens only their own.
+func (t *pinUvAuthToken) allowsRPID(rpID string) bool {
+	return t.rpID == "" || t.rpID == rpID
+}
@@ -0,0 +1,24 @@
+package ctap2
+
+import "fmt"
+
+// newUnsupportedTPMAuthenticator is returned for --backend=tpm until a
+// real TPM 2.0 client is vendored into this build: creating restricted
+// ECDSA/RSA keys under the endorsement hierarchy and producing genuine
+// TPM attestation statements needs a TSS client (Linux /dev/tpmrm0, or
+// the Windows TBS API), neither of which this checkout vendors.
+// Construction fails immediately with a clear error instead of silently
+// falling back to the file backend, so callers find out at startup
+// rather than after pairing with the phone.
+func newUnsupportedTPMAuthenticator(tpmDevice string) (Authenticator, error) {
+	return nil, fmt.Errorf("ctap2: --backend=tpm has no TPM backend in this build (needs a vendored TPM 2.0 client for %s)", tpmDeviceDescription(tpmDevice))
+}
+
+// tpmDeviceDescription returns a human-readable description of the TPM
+// device --tpm-device selects, for the unsupported-backend error message.
+func tpmDeviceDescription(tpmDevice string) string {
+	if tpmDevice == "" {
+		return "the platform TPM (Linux /dev/tpmrm0 or Windows TBS)"
+	}
+	return tpmDevice
+}
@@ -0,0 +1,164 @@
+package ctap2
+
+// COSEKey represents a COSE_Key encoded public key as used in CTAP2
+// (e.g. the platform's key-agreement key exchanged during ClientPIN).
+type COSEKey struct {
+	Kty int64  `cbor:"1,keyasint"`
+	Alg int64  `cbor:"3,keyasint"`
+	Crv int64  `cbor:"-1,keyasint"`
+	X   []byte `cbor:"-2,keyasint"`
+	Y   []byte `cbor:"-3,keyasint"`
+}
+
+// PublicKeyCredentialRpEntity is the "rp" field of a MakeCredential request.
+type PublicKeyCredentialRpEntity struct {
+	ID   string `cbor:"id"`
+	Name string `cbor:"name,omitempty"`
+}
+
+// PublicKeyCredentialUserEntity is the "user" field of a MakeCredential request.
+type PublicKeyCredentialUserEntity struct {
+	ID          []byte `cbor:"id"`
+	Name        string `cbor:"name,omitempty"`
+	DisplayName string `cbor:"displayName,omitempty"`
+}
+
+// PublicKeyCredentialParam is one entry of "pubKeyCredParams".
+type PublicKeyCredentialParam struct {
+	Type string `cbor:"type"`
+	Alg  int64  `cbor:"alg"`
+}
+
+// PublicKeyCredentialDescriptor identifies a credential in an exclude/allow list.
+type PublicKeyCredentialDescriptor struct {
+	Type string `cbor:"type"`
+	ID   []byte `cbor:"id"`
+}
+
+// MakeCredentialRequest is the CBOR request map for authenticatorMakeCredential.
+type MakeCredentialRequest struct {
+	ClientDataHash        []byte                          `cbor:"1,keyasint"`
+	RP                    PublicKeyCredentialRpEntity     `cbor:"2,keyasint"`
+	User                  PublicKeyCredentialUserEntity   `cbor:"3,keyasint"`
+	PubKeyCredParams      []PublicKeyCredentialParam      `cbor:"4,keyasint"`
+	ExcludeList           []PublicKeyCredentialDescriptor `cbor:"5,keyasint,omitempty"`
+	Extensions            map[string]interface{}          `cbor:"6,keyasint,omitempty"`
+	Options               map[string]bool                 `cbor:"7,keyasint,omitempty"`
+	PinUvAuthParam        []byte                          `cbor:"8,keyasint,omitempty"`
+	PinUvAuthProtocol     uint64                          `cbor:"9,keyasint,omitempty"`
+	EnterpriseAttestation uint64                          `cbor:"10,keyasint,omitempty"`
+}
+
+// MakeCredentialResponse is the CBOR response map for authenticatorMakeCredential.
+type MakeCredentialResponse struct {
+	Fmt      string                 `cbor:"1,keyasint"`
+	AuthData []byte                 `cbor:"2,keyasint"`
+	AttStmt  map[string]interface{} `cbor:"3,keyasint"`
+}
+
+// GetAssertionRequest is the CBOR request map for authenticatorGetAssertion.
+type GetAssertionRequest struct {
+	RPID              string                          `cbor:"1,keyasint"`
+	ClientDataHash    []byte                          `cbor:"2,keyasint"`
+	AllowList         []PublicKeyCredentialDescriptor `cbor:"3,keyasint,omitempty"`
+	Extensions        map[string]interface{}          `cbor:"4,keyasint,omitempty"`
+	Options           map[string]bool                 `cbor:"5,keyasint,omitempty"`
+	PinUvAuthParam    []byte                          `cbor:"6,keyasint,omitempty"`
+	PinUvAuthProtocol uint64                          `cbor:"7,keyasint,omitempty"`
+}
+
+// GetAssertionResponse is the CBOR response map for authenticatorGetAssertion.
+type GetAssertionResponse struct {
+	Credential          PublicKeyCredentialDescriptor `cbor:"1,keyasint,omitempty"`
+	AuthData            []byte                        `cbor:"2,keyasint"`
+	Signature           []byte                        `cbor:"3,keyasint"`
+	User                PublicKeyCredentialUserEntity `cbor:"4,keyasint,omitempty"`
+	NumberOfCredentials uint64                        `cbor:"5,keyasint,omitempty"`
+}
+
+// GetInfoResponse is the CBOR response map for authenticatorGetInfo.
+type GetInfoResponse struct {
+	Versions           []string        `cbor:"1,keyasint"`
+	Extensions         []string        `cbor:"2,keyasint,omitempty"`
+	AAGUID             []byte          `cbor:"3,keyasint"`
+	Options            map[string]bool `cbor:"4,keyasint,omitempty"`
+	MaxMsgSize         uint64          `cbor:"5,keyasint,omitempty"`
+	PinUvAuthProtocols []uint64        `cbor:"6,keyasint,omitempty"`
+}
+
+// ClientPINRequest is the CBOR request map for authenticatorClientPIN.
+type ClientPINRequest struct {
+	PinUvAuthProtocol uint64   `cbor:"1,keyasint"`
+	SubCommand        uint64   `cbor:"2,keyasint"`
+	KeyAgreement      *COSEKey `cbor:"3,keyasint,omitempty"`
+	PinUvAuthParam    []byte   `cbor:"4,keyasint,omitempty"`
+	NewPinEnc         []byte   `cbor:"5,keyasint,omitempty"`
+	PinHashEnc        []byte   `cbor:"6,keyasint,omitempty"`
+	Permissions       uint64   `cbor:"9,keyasint,omitempty"`
+	RPID              string   `cbor:"10,keyasint,omitempty"`
+}
+
+// ClientPINResponse is the CBOR response map for authenticatorClientPIN.
+type ClientPINResponse struct {
+	KeyAgreement    *COSEKey `cbor:"1,keyasint,omitempty"`
+	PinUvAuthToken  []byte   `cbor:"2,keyasint,omitempty"`
+	PinRetries      uint64   `cbor:"3,keyasint,omitempty"`
+	PowerCycleState bool     `cbor:"4,keyasint,omitempty"`
+	UvRetries       uint64   `cbor:"5,keyasint,omitempty"`
+}
+
+// ClientPIN subCommand values (CTAP2.1 section 6.5.5).
+const (
+	PinSubCmdGetPINRetries                            = 0x01
+	PinSubCmdGetKeyAgreement                          = 0x02
+	PinSubCmdSetPIN                                   = 0x03
+	PinSubCmdChangePIN                                = 0x04
+	PinSubCmdGetPINToken                              = 0x05
+	PinSubCmdGetPinUvAuthTokenUsingUvWithPermissions  = 0x06
+	PinSubCmdGetUVRetries                             = 0x07
+	PinSubCmdGetPinUvAuthTokenUsingPinWithPermissions = 0x09
+)
+
+// CredentialManagementSubCommandParams is the "subCommandParams" (key 2)
+// map of an authenticatorCredentialManagement request; which fields are
+// present depends on SubCommand.
+type CredentialManagementSubCommandParams struct {
+	RPIDHash     []byte                         `cbor:"1,keyasint,omitempty"`
+	CredentialID *PublicKeyCredentialDescriptor `cbor:"2,keyasint,omitempty"`
+	User         *PublicKeyCredentialUserEntity `cbor:"3,keyasint,omitempty"`
+}
+
+// CredentialManagementRequest is the CBOR request map for
+// authenticatorCredentialManagement.
+type CredentialManagementRequest struct {
+	SubCommand        uint64                                `cbor:"1,keyasint"`
+	SubCommandParams  *CredentialManagementSubCommandParams `cbor:"2,keyasint,omitempty"`
+	PinUvAuthProtocol uint64                                `cbor:"3,keyasint,omitempty"`
+	PinUvAuthParam    []byte                                `cbor:"4,keyasint,omitempty"`
+}
+
+// CredentialManagementResponse is the CBOR response map for
+// authenticatorCredentialManagement; which fields are populated depends on
+// the subCommand that produced it.
+type CredentialManagementResponse struct {
+	ExistingResidentCredentialsCount             uint64                         `cbor:"1,keyasint,omitempty"`
+	MaxPossibleRemainingResidentCredentialsCount uint64                         `cbor:"2,keyasint,omitempty"`
+	RP                                           *PublicKeyCredentialRpEntity   `cbor:"3,keyasint,omitempty"`
+	RPIDHash                                     []byte                         `cbor:"4,keyasint,omitempty"`
+	TotalRPs                                     uint64                         `cbor:"5,keyasint,omitempty"`
+	User                                         *PublicKeyCredentialUserEntity `cbor:"6,keyasint,omitempty"`
+	CredentialID                                 *PublicKeyCredentialDescriptor `cbor:"7,keyasint,omitempty"`
+	PublicKey                                    *COSEKey                       `cbor:"8,keyasint,omitempty"`
+	TotalCredentials                             uint64                         `cbor:"9,keyasint,omitempty"`
+}
+
+// authenticatorCredentialManagement subCommand values (CTAP2.1 section 6.8).
+const (
+	CredMgmtSubCmdGetCredsMetadata                      = 0x01
+	CredMgmtSubCmdEnumerateRPsBegin                     = 0x02
+	CredMgmtSubCmdEnumerateRPsGetNextRP                 = 0x03
+	CredMgmtSubCmdEnumerateCredentialsBegin             = 0x04
+	CredMgmtSubCmdEnumerateCredentialsGetNextCredential = 0x05
+	CredMgmtSubCmdDeleteCredential                      = 0x06
+	CredMgmtSubCmdUpdateUserInformation                 = 0x07
+)
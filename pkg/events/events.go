@@ -0,0 +1,131 @@
+// Package events provides a structured, machine-readable trace of a
+// hybrid-transport run, as an alternative to grepping the human-readable
+// log package output. Each Emitter writes one NDJSON record per pipeline
+// stage to a file (see cmd/ctap2-hybrid's fixed log/events.ndjson path)
+// and feeds the same records into a Metrics so they can also be scraped
+// over HTTP in Prometheus exposition format (see http.go).
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Stage names recorded by Emit. Each corresponds to one point in the
+// hybrid-transport pipeline: QR code generation, the phone's BLE
+// advertisement arriving, the noise tunnel handshake completing, and each
+// CTAP2 command/response pair. Stage is a free-form string rather than a
+// closed type so callers elsewhere in the repo can add stages without
+// touching this package.
+const (
+	StageQRGenerated     = "qr_generated"
+	StageBLEAdvReceived  = "ble_adv_received"
+	StageTunnelConnected = "tunnel_connected"
+	StageCTAP2Request    = "ctap2_request"
+	StageCTAP2Response   = "ctap2_response"
+	StageError           = "error"
+)
+
+// Event is a single NDJSON record. Which fields are populated depends on
+// Stage: DurationMS/MessageSize/Command are meaningful for the CTAP2 and
+// connection stages, Class/Err only for StageError.
+type Event struct {
+	Time          time.Time `json:"time"`
+	Stage         string    `json:"stage"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	DurationMS    float64   `json:"duration_ms,omitempty"`
+	MessageSize   int       `json:"message_size,omitempty"`
+	Command       byte      `json:"command,omitempty"`
+	Class         string    `json:"class,omitempty"`
+	Err           string    `json:"error,omitempty"`
+}
+
+// Emitter appends Event records as NDJSON to a file and updates Metrics
+// with each one. The zero value is not usable; create one with NewEmitter.
+// A nil *Emitter is safe to call Emit/Close on (both become no-ops), so
+// callers that don't wire one up can leave the field nil instead of
+// branching on whether tracing is enabled.
+type Emitter struct {
+	mu            sync.Mutex
+	file          *os.File
+	correlationID string
+
+	Metrics *Metrics
+}
+
+// NewEmitter creates (truncating) path and returns an Emitter that writes
+// NDJSON records to it, each tagged with a correlation ID generated once
+// per Emitter. path is truncated on open, so the file only holds records
+// from the current run.
+func NewEmitter(path string) (*Emitter, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("events: failed to create directory for %s: %w", path, err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("events: failed to open %s: %w", path, err)
+	}
+	correlationID, err := newCorrelationID()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Emitter{file: f, correlationID: correlationID, Metrics: NewMetrics()}, nil
+}
+
+// newCorrelationID generates a short random hex identifier tagging every
+// event from one Emitter (and therefore one run of the ceremony).
+func newCorrelationID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("events: failed to generate correlation id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Emit appends ev to the NDJSON stream and records it against e.Metrics.
+// Time and CorrelationID are filled in if unset. Marshal/write failures
+// are swallowed: a broken event stream must never fail the ceremony it's
+// observing.
+func (e *Emitter) Emit(ev Event) {
+	if e == nil {
+		return
+	}
+
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if ev.CorrelationID == "" {
+		ev.CorrelationID = e.correlationID
+	}
+
+	e.Metrics.observe(ev)
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.file.Write(data)
+}
+
+// Close closes the underlying NDJSON file. A nil *Emitter is a no-op.
+func (e *Emitter) Close() error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
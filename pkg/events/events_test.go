@@ -0,0 +1,67 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestEmitterWritesNDJSON checks that Emit appends one JSON object per
+// line, filling in Time and CorrelationID when they're unset.
+func TestEmitterWritesNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	e, err := NewEmitter(path)
+	if err != nil {
+		t.Fatalf("NewEmitter() failed: %v", err)
+	}
+
+	e.Emit(Event{Stage: StageQRGenerated})
+	e.Emit(Event{Stage: StageBLEAdvReceived, DurationMS: 250})
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("failed to decode event line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, ev)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].Stage != StageQRGenerated {
+		t.Errorf("events[0].Stage = %q, want %q", events[0].Stage, StageQRGenerated)
+	}
+	if events[0].CorrelationID == "" {
+		t.Error("events[0].CorrelationID was not filled in")
+	}
+	if events[0].Time.IsZero() {
+		t.Error("events[0].Time was not filled in")
+	}
+	if events[0].CorrelationID != events[1].CorrelationID {
+		t.Errorf("events from the same Emitter got different correlation ids: %q vs %q", events[0].CorrelationID, events[1].CorrelationID)
+	}
+}
+
+// TestNilEmitterIsNoOp checks that a nil *Emitter can be used freely by
+// callers that don't wire one up.
+func TestNilEmitterIsNoOp(t *testing.T) {
+	var e *Emitter
+	e.Emit(Event{Stage: StageError})
+	if err := e.Close(); err != nil {
+		t.Errorf("Close() on a nil Emitter = %v, want nil", err)
+	}
+}
@@ -0,0 +1,12 @@
+package events
+
+import "net/http"
+
+// Handler returns an http.Handler serving m in Prometheus text exposition
+// format, for wiring up under cmd/ctap2-hybrid's --metrics-addr.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(m.Render()))
+	})
+}
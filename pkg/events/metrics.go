@@ -0,0 +1,173 @@
+package events
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics accumulates the counters and histograms Render exposes in
+// Prometheus text exposition format: advertisement wait time, tunnel RTT,
+// CTAP2 command latency by command byte, and error counts by class. It is
+// fed by Emitter.Emit and is safe for concurrent use.
+type Metrics struct {
+	mu sync.Mutex
+
+	bleAdvWaitSeconds   *histogram
+	tunnelRTTSeconds    *histogram
+	ctap2LatencySeconds map[byte]*histogram
+	errorsByClass       map[string]uint64
+}
+
+// latencyBuckets are the histogram upper bounds (seconds) shared by every
+// duration metric this package tracks; they span the range a CTAP2
+// exchange over a phone tunnel is expected to take, from sub-100ms
+// signing operations up to the multi-second BLE advertisement wait.
+var latencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// NewMetrics returns an empty Metrics ready for Emitter.Emit to observe
+// events into.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		bleAdvWaitSeconds:   newHistogram(latencyBuckets),
+		tunnelRTTSeconds:    newHistogram(latencyBuckets),
+		ctap2LatencySeconds: make(map[byte]*histogram),
+		errorsByClass:       make(map[string]uint64),
+	}
+}
+
+// observe updates the metric(s) ev.Stage corresponds to.
+func (m *Metrics) observe(ev Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch ev.Stage {
+	case StageBLEAdvReceived:
+		m.bleAdvWaitSeconds.observe(ev.DurationMS / 1000)
+	case StageTunnelConnected:
+		m.tunnelRTTSeconds.observe(ev.DurationMS / 1000)
+	case StageCTAP2Response:
+		h, ok := m.ctap2LatencySeconds[ev.Command]
+		if !ok {
+			h = newHistogram(latencyBuckets)
+			m.ctap2LatencySeconds[ev.Command] = h
+		}
+		h.observe(ev.DurationMS / 1000)
+	case StageError:
+		class := ev.Class
+		if class == "" {
+			class = "unknown"
+		}
+		m.errorsByClass[class]++
+	}
+}
+
+// Render writes every metric in Prometheus text exposition format
+// (https://prometheus.io/docs/instrumenting/exposition_formats/).
+func (m *Metrics) Render() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sb strings.Builder
+
+	sb.WriteString("# HELP ctap2_hybrid_ble_advertisement_wait_seconds Time spent waiting for the phone's BLE advertisement.\n")
+	sb.WriteString("# TYPE ctap2_hybrid_ble_advertisement_wait_seconds histogram\n")
+	m.bleAdvWaitSeconds.writeTo(&sb, "ctap2_hybrid_ble_advertisement_wait_seconds", nil)
+
+	sb.WriteString("# HELP ctap2_hybrid_tunnel_rtt_seconds Time spent establishing the noise tunnel connection.\n")
+	sb.WriteString("# TYPE ctap2_hybrid_tunnel_rtt_seconds histogram\n")
+	m.tunnelRTTSeconds.writeTo(&sb, "ctap2_hybrid_tunnel_rtt_seconds", nil)
+
+	sb.WriteString("# HELP ctap2_hybrid_ctap2_command_latency_seconds CTAP2 command processing latency, by command byte.\n")
+	sb.WriteString("# TYPE ctap2_hybrid_ctap2_command_latency_seconds histogram\n")
+	for _, cmd := range sortedCommandBytes(m.ctap2LatencySeconds) {
+		m.ctap2LatencySeconds[cmd].writeTo(&sb, "ctap2_hybrid_ctap2_command_latency_seconds", map[string]string{
+			"command": fmt.Sprintf("0x%02x", cmd),
+		})
+	}
+
+	sb.WriteString("# HELP ctap2_hybrid_errors_total Errors encountered, by class.\n")
+	sb.WriteString("# TYPE ctap2_hybrid_errors_total counter\n")
+	for _, class := range sortedClasses(m.errorsByClass) {
+		fmt.Fprintf(&sb, "ctap2_hybrid_errors_total{class=%q} %d\n", class, m.errorsByClass[class])
+	}
+
+	return sb.String()
+}
+
+func sortedCommandBytes(m map[byte]*histogram) []byte {
+	cmds := make([]byte, 0, len(m))
+	for cmd := range m {
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i] < cmds[j] })
+	return cmds
+}
+
+func sortedClasses(m map[string]uint64) []string {
+	classes := make([]string, 0, len(m))
+	for class := range m {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// histogram is a fixed-bucket cumulative histogram, matching Prometheus's
+// "le" (less-than-or-equal) bucket semantics.
+type histogram struct {
+	buckets []float64 // upper bounds, ascending
+	counts  []uint64  // cumulative count <= buckets[i]; counts[len(buckets)] is the +Inf bucket
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	h.sum += v
+	h.count++
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(h.buckets)]++
+}
+
+// writeTo appends this histogram's bucket/sum/count lines for a metric
+// named name, with labels merged into every line (nil for none).
+func (h *histogram) writeTo(sb *strings.Builder, name string, labels map[string]string) {
+	for i, bound := range h.buckets {
+		fmt.Fprintf(sb, "%s_bucket{%s} %d\n", name, labelString(labels, "le", formatBound(bound)), h.counts[i])
+	}
+	fmt.Fprintf(sb, "%s_bucket{%s} %d\n", name, labelString(labels, "le", "+Inf"), h.counts[len(h.buckets)])
+	fmt.Fprintf(sb, "%s_sum{%s} %g\n", name, labelString(labels, "", ""), h.sum)
+	fmt.Fprintf(sb, "%s_count{%s} %d\n", name, labelString(labels, "", ""), h.count)
+}
+
+// labelString renders labels (plus an optional extra key/value, used for
+// "le") as a Prometheus label set body, e.g. `command="0x01",le="0.5"`.
+func labelString(labels map[string]string, extraKey, extraVal string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	if extraKey != "" {
+		parts = append(parts, fmt.Sprintf("%s=%q", extraKey, extraVal))
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatBound(bound float64) string {
+	return fmt.Sprintf("%g", bound)
+}
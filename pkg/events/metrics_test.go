@@ -0,0 +1,51 @@
+package events
+
+import "testing"
+
+// TestMetricsRenderIncludesObservations checks that observed events show
+// up in Render's Prometheus exposition output, under the expected metric
+// names and labels.
+func TestMetricsRenderIncludesObservations(t *testing.T) {
+	m := NewMetrics()
+
+	m.observe(Event{Stage: StageBLEAdvReceived, DurationMS: 500})
+	m.observe(Event{Stage: StageTunnelConnected, DurationMS: 120})
+	m.observe(Event{Stage: StageCTAP2Response, Command: 0x01, DurationMS: 15})
+	m.observe(Event{Stage: StageError, Class: "tunnel"})
+	m.observe(Event{Stage: StageError, Class: "tunnel"})
+
+	out := m.Render()
+
+	for _, want := range []string{
+		"ctap2_hybrid_ble_advertisement_wait_seconds_count{} 1",
+		"ctap2_hybrid_tunnel_rtt_seconds_count{} 1",
+		`ctap2_hybrid_ctap2_command_latency_seconds_count{command="0x01"} 1`,
+		`ctap2_hybrid_errors_total{class="tunnel"} 2`,
+	} {
+		if !contains(out, want) {
+			t.Errorf("Render() missing %q, got:\n%s", want, out)
+		}
+	}
+}
+
+// TestMetricsObserveWithoutClassFallsBackToUnknown checks an error event
+// with no Class still shows up, under "unknown", rather than being
+// silently dropped.
+func TestMetricsObserveWithoutClassFallsBackToUnknown(t *testing.T) {
+	m := NewMetrics()
+	m.observe(Event{Stage: StageError})
+
+	out := m.Render()
+	if !contains(out, `ctap2_hybrid_errors_total{class="unknown"} 1`) {
+		t.Errorf("Render() missing unknown-class error count, got:\n%s", out)
+	}
+}
+
+func contains(haystack, needle string) bool {
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		if haystack[i:i+len(needle)] == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package linking
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Store persists a single LinkedDevice between runs. Load returns (nil,
+// nil) if nothing has been linked yet. A keyring-backed Store could
+// implement this interface too; none is included here since no OS keyring
+// library is vendored in this build.
+type Store interface {
+	Load() (*LinkedDevice, error)
+	Save(device *LinkedDevice) error
+	Forget() error
+}
+
+// FileStore is a Store backed by a single JSON file, created with
+// permissions restricted to the owner since it holds a long-term pairing
+// secret.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore creates a FileStore persisting to path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load reads the persisted LinkedDevice, or returns (nil, nil) if path
+// doesn't exist yet.
+func (s *FileStore) Load() (*LinkedDevice, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("linking: failed to read %s: %w", s.path, err)
+	}
+
+	var device LinkedDevice
+	if err := json.Unmarshal(data, &device); err != nil {
+		return nil, fmt.Errorf("linking: failed to parse %s: %w", s.path, err)
+	}
+	return &device, nil
+}
+
+// Save writes device to path, creating its parent directory if needed.
+func (s *FileStore) Save(device *LinkedDevice) error {
+	if dir := filepath.Dir(s.path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("linking: failed to create %s: %w", dir, err)
+		}
+	}
+
+	data, err := json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("linking: failed to encode linked-device state: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("linking: failed to write %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Forget deletes the persisted state, if any, forcing the next run back
+// to a fresh QR pairing.
+func (s *FileStore) Forget() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("linking: failed to remove %s: %w", s.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package linking
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStoreLoadReturnsNilWhenUnset(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "link_state.json"))
+
+	device, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if device != nil {
+		t.Errorf("Load() = %+v, want nil before anything has been saved", device)
+	}
+}
+
+func TestFileStoreSaveAndLoadRoundTrip(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "nested", "link_state.json"))
+
+	want := &LinkedDevice{
+		PrivateKey:             bytes.Repeat([]byte{0x01}, 32),
+		PublicKey:              bytes.Repeat([]byte{0x02}, 33),
+		AuthenticatorPublicKey: bytes.Repeat([]byte{0x03}, 33),
+		ContactID:              bytes.Repeat([]byte{0x04}, 16),
+		PairingSecret:          bytes.Repeat([]byte{0x05}, 32),
+		Name:                   "Test Phone",
+		TunnelURL:              "wss://cable.example.com",
+		LinkedAt:               time.Now().Truncate(time.Second),
+	}
+
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if !bytes.Equal(got.PrivateKey, want.PrivateKey) ||
+		!bytes.Equal(got.PublicKey, want.PublicKey) ||
+		!bytes.Equal(got.AuthenticatorPublicKey, want.AuthenticatorPublicKey) ||
+		!bytes.Equal(got.ContactID, want.ContactID) ||
+		!bytes.Equal(got.PairingSecret, want.PairingSecret) ||
+		got.Name != want.Name ||
+		got.TunnelURL != want.TunnelURL ||
+		!got.LinkedAt.Equal(want.LinkedAt) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFileStoreForgetRemovesState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "link_state.json")
+	store := NewFileStore(path)
+
+	if err := store.Save(&LinkedDevice{Name: "Test Phone"}); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if err := store.Forget(); err != nil {
+		t.Fatalf("Forget() failed: %v", err)
+	}
+
+	device, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() after Forget() failed: %v", err)
+	}
+	if device != nil {
+		t.Errorf("Load() after Forget() = %+v, want nil", device)
+	}
+}
+
+func TestFileStoreForgetIsIdempotent(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "link_state.json"))
+
+	if err := store.Forget(); err != nil {
+		t.Errorf("Forget() on a never-saved store failed: %v", err)
+	}
+}
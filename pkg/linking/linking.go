@@ -0,0 +1,66 @@
+// Package linking persists the caBLE v2 "state-assisted" pairing state an
+// authenticator hands back after a fresh QR pairing (tunnel.LinkingInfo),
+// so a later run can skip the QR/BLE ceremony entirely and reconnect
+// straight to the tunnel service with a stored contact ID
+// (tunnel.Client.Reconnect).
+package linking
+
+import (
+	"time"
+
+	"ctap2-hybrid-transport/pkg/tunnel"
+)
+
+// DefaultContactIDTTL bounds how long a stored contact ID is trusted
+// before a fresh QR pairing is forced again. caBLE v2 doesn't mandate a
+// contact ID lifetime; this is a conservative client-side rotation policy
+// so a stale store doesn't keep silently reconnecting indefinitely.
+const DefaultContactIDTTL = 30 * 24 * time.Hour
+
+// LinkedDevice is the persisted state from one successful caBLE v2
+// pairing: the desktop's own identity keypair (which the phone learned
+// from the original QR code, and which Client.Reconnect's Noise_KNpsk0
+// handshake must reuse unchanged) plus the authenticator's linking info
+// from that pairing's mandatory post-handshake message.
+type LinkedDevice struct {
+	PrivateKey             []byte // 32 bytes - the desktop's original P-256 identity key
+	PublicKey              []byte // 33 bytes - its compressed counterpart
+	AuthenticatorPublicKey []byte
+	ContactID              []byte
+	PairingSecret          []byte
+	Name                   string
+	TunnelURL              string
+	LinkedAt               time.Time
+}
+
+// FromLinkingInfo builds a LinkedDevice from a fresh pairing or reconnect's
+// linking info, the desktop identity keypair used for that handshake, and
+// the tunnel URL it connected to.
+func FromLinkingInfo(info *tunnel.LinkingInfo, privateKey, publicKey []byte, tunnelURL string) *LinkedDevice {
+	return &LinkedDevice{
+		PrivateKey:             privateKey,
+		PublicKey:              publicKey,
+		AuthenticatorPublicKey: info.AuthenticatorPublicKey,
+		ContactID:              info.ContactID,
+		PairingSecret:          info.PairingSecret,
+		Name:                   info.Name,
+		TunnelURL:              tunnelURL,
+		LinkedAt:               time.Now(),
+	}
+}
+
+// ToLinkingInfo converts back to the tunnel.LinkingInfo shape
+// Client.Reconnect expects.
+func (d *LinkedDevice) ToLinkingInfo() *tunnel.LinkingInfo {
+	return &tunnel.LinkingInfo{
+		AuthenticatorPublicKey: d.AuthenticatorPublicKey,
+		ContactID:              d.ContactID,
+		PairingSecret:          d.PairingSecret,
+		Name:                   d.Name,
+	}
+}
+
+// Expired reports whether d was linked more than DefaultContactIDTTL ago.
+func (d *LinkedDevice) Expired() bool {
+	return time.Since(d.LinkedAt) > DefaultContactIDTTL
+}
@@ -0,0 +1,55 @@
+package linking
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"ctap2-hybrid-transport/pkg/tunnel"
+)
+
+func TestFromLinkingInfoRoundTripsToLinkingInfo(t *testing.T) {
+	info := &tunnel.LinkingInfo{
+		AuthenticatorPublicKey: bytes.Repeat([]byte{0x01}, 33),
+		ContactID:              bytes.Repeat([]byte{0x02}, 16),
+		PairingSecret:          bytes.Repeat([]byte{0x03}, 32),
+		Name:                   "Test Phone",
+	}
+	privateKey := bytes.Repeat([]byte{0x04}, 32)
+	publicKey := bytes.Repeat([]byte{0x05}, 33)
+
+	device := FromLinkingInfo(info, privateKey, publicKey, "wss://cable.example.com")
+
+	if !bytes.Equal(device.PrivateKey, privateKey) {
+		t.Errorf("PrivateKey = %x, want %x", device.PrivateKey, privateKey)
+	}
+	if !bytes.Equal(device.PublicKey, publicKey) {
+		t.Errorf("PublicKey = %x, want %x", device.PublicKey, publicKey)
+	}
+	if device.TunnelURL != "wss://cable.example.com" {
+		t.Errorf("TunnelURL = %q, want %q", device.TunnelURL, "wss://cable.example.com")
+	}
+	if device.LinkedAt.IsZero() {
+		t.Errorf("LinkedAt = zero value, want it set to roughly now")
+	}
+
+	got := device.ToLinkingInfo()
+	if !bytes.Equal(got.AuthenticatorPublicKey, info.AuthenticatorPublicKey) ||
+		!bytes.Equal(got.ContactID, info.ContactID) ||
+		!bytes.Equal(got.PairingSecret, info.PairingSecret) ||
+		got.Name != info.Name {
+		t.Errorf("ToLinkingInfo() = %+v, want %+v", got, info)
+	}
+}
+
+func TestLinkedDeviceExpired(t *testing.T) {
+	fresh := &LinkedDevice{LinkedAt: time.Now()}
+	if fresh.Expired() {
+		t.Errorf("Expired() = true for a device linked just now, want false")
+	}
+
+	stale := &LinkedDevice{LinkedAt: time.Now().Add(-DefaultContactIDTTL - time.Hour)}
+	if !stale.Expired() {
+		t.Errorf("Expired() = false for a device linked %v ago, want true", DefaultContactIDTTL+time.Hour)
+	}
+}
@@ -0,0 +1,70 @@
+package qrcode
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// FuzzDigitRoundTrip exercises digitEncode's packed-chunk layout (7-byte
+// little-endian chunks -> 17 decimal digits, with a partialChunkDigits hex
+// table for the tail) against digitDecode, its inverse, for arbitrary
+// inputs - including lengths that don't divide evenly into 7-byte chunks,
+// which is where an off-by-one in the tail branch would show up.
+func FuzzDigitRoundTrip(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0x01})
+	f.Add(bytes.Repeat([]byte{0xFF}, 6))
+	f.Add(bytes.Repeat([]byte{0xFF}, 7))
+	f.Add(bytes.Repeat([]byte{0xAB}, 20))
+	f.Add(bytes.Repeat([]byte{0x00}, 49))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		encoded := digitEncode(data)
+
+		decoded, err := digitDecode(encoded)
+		if err != nil {
+			t.Fatalf("digitDecode(%q) failed: %v", encoded, err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("round trip mismatch: digitDecode(digitEncode(%x)) = %x", data, decoded)
+		}
+	})
+}
+
+// FuzzQRContentsRoundTrip exercises encodeQRContents/decodeCableV2URL
+// together: for an arbitrary public key, QR secret, and operation hint, the
+// FIDO:/ URL they produce must decode back to the same public key and QR
+// secret.
+func FuzzQRContentsRoundTrip(f *testing.F) {
+	f.Add(make([]byte, 49), "ga")
+	f.Add(bytes.Repeat([]byte{0xFF}, 49), "mc")
+
+	f.Fuzz(func(t *testing.T, seed []byte, operationHint string) {
+		var publicKey [33]byte
+		var secret [16]byte
+		for i := range publicKey {
+			if i < len(seed) {
+				publicKey[i] = seed[i]
+			}
+		}
+		for i := range secret {
+			if j := 33 + i; j < len(seed) {
+				secret[i] = seed[j]
+			}
+		}
+
+		contents := encodeQRContents(&publicKey, &secret, time.Now().Unix(), operationHint, nil, nil, false)
+
+		decoded, err := decodeCableV2URL(contents)
+		if err != nil {
+			t.Fatalf("decodeCableV2URL(%q) failed: %v", contents, err)
+		}
+		if !bytes.Equal(decoded.PublicKey, publicKey[:]) {
+			t.Fatalf("round trip mismatch: PublicKey = %x, want %x", decoded.PublicKey, publicKey)
+		}
+		if !bytes.Equal(decoded.QRSecret, secret[:]) {
+			t.Fatalf("round trip mismatch: QRSecret = %x, want %x", decoded.QRSecret, secret)
+		}
+	})
+}
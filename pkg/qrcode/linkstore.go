@@ -0,0 +1,139 @@
+package qrcode
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Contact is the "linking information" a phone returns after a fresh
+// caBLE v2 hybrid handshake: enough to reconnect to that specific phone
+// in a later ceremony (a silent SessionOptions.Silent QR, or a fully
+// state-assisted reconnect such as ble.ConnectLinked) without re-scanning
+// its QR code.
+type Contact struct {
+	Name                   string // phone's self-reported device name, if any
+	AuthenticatorPublicKey []byte // phone's P-256 identity public key
+	ContactID              []byte // opaque reconnect identifier the phone assigned; also the LinkStore key
+	LinkID                 []byte // phone-assigned link identifier, distinct from ContactID
+	LinkSecret             []byte // shared secret a reconnect's PSK is derived from
+	TunnelServerDomain     string // tunnel server domain this phone paired through
+	LinkedAt               time.Time
+}
+
+// contactKey is the hex-encoded ContactID LinkStore implementations key
+// Contacts by.
+func contactKey(contactID []byte) string {
+	return hex.EncodeToString(contactID)
+}
+
+// LinkStore persists the Contacts a phone has linked, so a later ceremony
+// can reconnect without re-scanning its QR code. A keyring-backed
+// LinkStore could implement this interface too; none is included here
+// since no OS keyring library is vendored in this build.
+type LinkStore interface {
+	Save(contact *Contact) error
+	Load(contactID []byte) (*Contact, error)
+	List() ([]*Contact, error)
+	Delete(contactID []byte) error
+}
+
+// FileLinkStore is a LinkStore backed by a single JSON file holding every
+// linked Contact, keyed by hex-encoded ContactID, created with permissions
+// restricted to the owner since it holds long-term pairing secrets.
+type FileLinkStore struct {
+	path string
+}
+
+// NewFileLinkStore creates a FileLinkStore persisting to path.
+func NewFileLinkStore(path string) *FileLinkStore {
+	return &FileLinkStore{path: path}
+}
+
+// load reads path's Contacts, keyed by contactKey, or returns an empty map
+// if path doesn't exist yet.
+func (s *FileLinkStore) load() (map[string]*Contact, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return map[string]*Contact{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("qrcode: failed to read %s: %w", s.path, err)
+	}
+
+	contacts := map[string]*Contact{}
+	if err := json.Unmarshal(data, &contacts); err != nil {
+		return nil, fmt.Errorf("qrcode: failed to parse %s: %w", s.path, err)
+	}
+	return contacts, nil
+}
+
+// store writes contacts to path, creating its parent directory if needed.
+func (s *FileLinkStore) store(contacts map[string]*Contact) error {
+	if dir := filepath.Dir(s.path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("qrcode: failed to create %s: %w", dir, err)
+		}
+	}
+
+	data, err := json.Marshal(contacts)
+	if err != nil {
+		return fmt.Errorf("qrcode: failed to encode link store state: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("qrcode: failed to write %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Save persists contact, replacing any existing Contact with the same
+// ContactID.
+func (s *FileLinkStore) Save(contact *Contact) error {
+	if len(contact.ContactID) == 0 {
+		return fmt.Errorf("qrcode: Save: contact has no ContactID")
+	}
+
+	contacts, err := s.load()
+	if err != nil {
+		return err
+	}
+	contacts[contactKey(contact.ContactID)] = contact
+	return s.store(contacts)
+}
+
+// Load returns the Contact saved under contactID, or (nil, nil) if none
+// has been linked yet.
+func (s *FileLinkStore) Load(contactID []byte) (*Contact, error) {
+	contacts, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return contacts[contactKey(contactID)], nil
+}
+
+// List returns every linked Contact, in no particular order.
+func (s *FileLinkStore) List() ([]*Contact, error) {
+	contacts, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*Contact, 0, len(contacts))
+	for _, contact := range contacts {
+		list = append(list, contact)
+	}
+	return list, nil
+}
+
+// Delete removes the Contact saved under contactID, if any.
+func (s *FileLinkStore) Delete(contactID []byte) error {
+	contacts, err := s.load()
+	if err != nil {
+		return err
+	}
+	delete(contacts, contactKey(contactID))
+	return s.store(contacts)
+}
@@ -0,0 +1,125 @@
+package qrcode
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLinkStoreLoadReturnsNilWhenUnset(t *testing.T) {
+	store := NewFileLinkStore(filepath.Join(t.TempDir(), "link_store.json"))
+
+	contact, err := store.Load([]byte{0x01, 0x02})
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if contact != nil {
+		t.Errorf("Load() = %+v, want nil before anything has been saved", contact)
+	}
+}
+
+func TestFileLinkStoreSaveAndLoadRoundTrip(t *testing.T) {
+	store := NewFileLinkStore(filepath.Join(t.TempDir(), "nested", "link_store.json"))
+
+	want := &Contact{
+		Name:                   "Test Phone",
+		AuthenticatorPublicKey: bytes.Repeat([]byte{0x01}, 33),
+		ContactID:              bytes.Repeat([]byte{0x02}, 16),
+		LinkID:                 bytes.Repeat([]byte{0x03}, 8),
+		LinkSecret:             bytes.Repeat([]byte{0x04}, 32),
+		TunnelServerDomain:     "cable.example.com",
+		LinkedAt:               time.Now().Truncate(time.Second),
+	}
+
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	got, err := store.Load(want.ContactID)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if got == nil {
+		t.Fatalf("Load() = nil, want %+v", want)
+	}
+	if got.Name != want.Name ||
+		!bytes.Equal(got.AuthenticatorPublicKey, want.AuthenticatorPublicKey) ||
+		!bytes.Equal(got.ContactID, want.ContactID) ||
+		!bytes.Equal(got.LinkID, want.LinkID) ||
+		!bytes.Equal(got.LinkSecret, want.LinkSecret) ||
+		got.TunnelServerDomain != want.TunnelServerDomain ||
+		!got.LinkedAt.Equal(want.LinkedAt) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFileLinkStoreListReturnsEveryContact(t *testing.T) {
+	store := NewFileLinkStore(filepath.Join(t.TempDir(), "link_store.json"))
+
+	first := &Contact{Name: "Phone A", ContactID: []byte{0x01}}
+	second := &Contact{Name: "Phone B", ContactID: []byte{0x02}}
+	if err := store.Save(first); err != nil {
+		t.Fatalf("Save(first) failed: %v", err)
+	}
+	if err := store.Save(second); err != nil {
+		t.Fatalf("Save(second) failed: %v", err)
+	}
+
+	contacts, err := store.List()
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	if len(contacts) != 2 {
+		t.Fatalf("List() returned %d contacts, want 2", len(contacts))
+	}
+
+	names := map[string]bool{}
+	for _, c := range contacts {
+		names[c.Name] = true
+	}
+	if !names["Phone A"] || !names["Phone B"] {
+		t.Errorf("List() = %+v, want both Phone A and Phone B", contacts)
+	}
+}
+
+func TestFileLinkStoreDeleteRemovesOnlyThatContact(t *testing.T) {
+	store := NewFileLinkStore(filepath.Join(t.TempDir(), "link_store.json"))
+
+	keep := &Contact{Name: "Keep", ContactID: []byte{0x01}}
+	remove := &Contact{Name: "Remove", ContactID: []byte{0x02}}
+	if err := store.Save(keep); err != nil {
+		t.Fatalf("Save(keep) failed: %v", err)
+	}
+	if err := store.Save(remove); err != nil {
+		t.Fatalf("Save(remove) failed: %v", err)
+	}
+
+	if err := store.Delete(remove.ContactID); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+
+	gotRemove, err := store.Load(remove.ContactID)
+	if err != nil {
+		t.Fatalf("Load(remove) failed: %v", err)
+	}
+	if gotRemove != nil {
+		t.Errorf("Load(remove) after Delete() = %+v, want nil", gotRemove)
+	}
+
+	gotKeep, err := store.Load(keep.ContactID)
+	if err != nil {
+		t.Fatalf("Load(keep) failed: %v", err)
+	}
+	if gotKeep == nil {
+		t.Errorf("Load(keep) after deleting a different contact = nil, want %+v", keep)
+	}
+}
+
+func TestFileLinkStoreDeleteIsIdempotent(t *testing.T) {
+	store := NewFileLinkStore(filepath.Join(t.TempDir(), "link_store.json"))
+
+	if err := store.Delete([]byte{0xff}); err != nil {
+		t.Errorf("Delete() on a never-saved store failed: %v", err)
+	}
+}
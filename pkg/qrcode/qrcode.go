@@ -1,39 +1,161 @@
 package qrcode
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/skip2/go-qrcode"
-)
+	"golang.org/x/crypto/hkdf"
 
-// CBOR constants from CTAP2 specification
-const (
-	cborMajorByteString = 2
+	"ctap2-hybrid-transport/pkg/cbor"
 )
 
-// Global variables as per CTAP2 specification
-var (
-	qrSecret [16]byte
-	// The ecdsa package is used for its convenient public/private key structures,
-	// but these are ECDH keys, not ECDSA.
-	identityKey *ecdsa.PrivateKey
-	// Number of assigned tunnel server domains - match browser implementation
-	assignedTunnelServerDomains = []string{"cable.ua5v.com", "cable.auth.com"}
-)
+// Number of assigned tunnel server domains - match browser implementation
+var assignedTunnelServerDomains = []string{"cable.ua5v.com", "cable.auth.com"}
+
+// caBLE v2 key purposes for HKDF. Mirrors pkg/ble's keyPurposeEIDKey; the
+// two packages don't share a type because a Session only ever needs to
+// derive the EID key, never the tunnel ID or PSK (tunnel.Client derives
+// those itself from the QR secret it's handed).
+const keyPurposeEIDKey uint32 = 1
+
+// eidKeyLength is the length of the EID key ble.CableV2Decryptor uses to
+// trial-decrypt a BLE advertisement: 32 bytes AES + 32 bytes HMAC.
+const eidKeyLength = 64
+
+// Session owns the private key material and derived state for a single
+// caBLE v2 QR pairing ceremony. Unlike the package-level globals it
+// replaces, a Session can be used by many concurrent ceremonies without
+// one clobbering another's secret, and Close zeroes its key material once
+// the ceremony is done.
+type Session struct {
+	privateKey    *ecdsa.PrivateKey
+	qrSecret      [16]byte
+	timestamp     int64
+	operationHint string // "ga" (getAssertion) or "mc" (makeCredential)
+	linkingHints  []byte
+	knownDomains  []string
+	silent        bool
+	closed        bool
+}
+
+// SessionOptions configures a new Session. OperationHint defaults to "ga"
+// when left empty. Silent marks the QR as a non-discoverable,
+// silent-reconnect ceremony (CBOR key 4) rather than a normal visible
+// pairing prompt - set it when re-displaying a QR for a phone that's
+// already in a qrcode.LinkStore, so it can skip its own confirmation UI.
+type SessionOptions struct {
+	OperationHint string
+	LinkingHints  []byte
+	KnownDomains  []string
+	Silent        bool
+}
+
+// NewSession starts a new QR pairing ceremony: a fresh P-256 identity key
+// and QR secret, scoped to the returned Session instead of shared
+// package-level state.
+func NewSession(opts SessionOptions) (*Session, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate identity key: %w", err)
+	}
+
+	var secret [16]byte
+	if _, err := rand.Read(secret[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate QR secret: %w", err)
+	}
+
+	hint := opts.OperationHint
+	if hint == "" {
+		hint = "ga"
+	}
+
+	return &Session{
+		privateKey:    privateKey,
+		qrSecret:      secret,
+		timestamp:     time.Now().Unix(),
+		operationHint: hint,
+		linkingHints:  opts.LinkingHints,
+		knownDomains:  opts.KnownDomains,
+		silent:        opts.Silent,
+	}, nil
+}
+
+// PublicKey returns the session's compressed P-256 identity public key.
+func (s *Session) PublicKey() [33]byte {
+	return compressECKey(&s.privateKey.PublicKey)
+}
+
+// QRSecret returns a copy of the session's QR secret, for callers (e.g.
+// ble.NewScanner, tunnel.NewClient) that still take a raw secret.
+func (s *Session) QRSecret() []byte {
+	secret := make([]byte, len(s.qrSecret))
+	copy(secret, s.qrSecret[:])
+	return secret
+}
+
+// QRContents returns the FIDO:/ URL to render as a QR code for this
+// session's ceremony.
+func (s *Session) QRContents() (string, error) {
+	if s.closed {
+		return "", errors.New("qrcode: session is closed")
+	}
+	publicKey := s.PublicKey()
+	return encodeQRContents(&publicKey, &s.qrSecret, s.timestamp, s.operationHint, s.linkingHints, s.knownDomains, s.silent), nil
+}
+
+// DeriveEIDKey derives the 64-byte EID key ble.CableV2Decryptor needs to
+// trial-decrypt the phone's BLE advertisement, using the same HKDF purpose
+// byte (1) the caBLE v2 spec assigns to EID keys.
+func (s *Session) DeriveEIDKey() ([]byte, error) {
+	if s.closed {
+		return nil, errors.New("qrcode: session is closed")
+	}
+
+	var purpose [4]byte
+	purpose[0] = byte(keyPurposeEIDKey)
+
+	eidKey := make([]byte, eidKeyLength)
+	h := hkdf.New(sha256.New, s.qrSecret[:], nil, purpose[:])
+	if n, err := h.Read(eidKey); err != nil || n != len(eidKey) {
+		return nil, fmt.Errorf("failed to derive EID key: read %d bytes, err: %v", n, err)
+	}
+	return eidKey, nil
+}
+
+// Close zeroes the session's secret key material. After Close, QRContents
+// and DeriveEIDKey return errors.
+func (s *Session) Close() {
+	for i := range s.qrSecret {
+		s.qrSecret[i] = 0
+	}
+	if s.privateKey != nil {
+		s.privateKey.D.SetInt64(0)
+	}
+	s.closed = true
+}
 
 // QRData represents the data encoded in the QR code for caBLE v2
 type QRData struct {
 	// caBLE v2 QR code data
-	PublicKey     []byte // 33 bytes - P-256 compressed public key
-	QRSecret      []byte // 16 bytes - QR secret
-	TunnelID      []byte // 16 bytes - tunnel service identifier (not used in QR)
-	
+	PublicKey     []byte   // 33 bytes - P-256 compressed public key
+	QRSecret      []byte   // 16 bytes - QR secret
+	TunnelID      []byte   // 16 bytes - tunnel service identifier (not used in QR)
+	LinkingHints  []byte   // key 6 - opaque state-assisted-reconnect hints, omitted if empty
+	KnownDomains  []string // key 7 - tunnel domains the phone already has cached, omitted if empty
+	Timestamp     int64    // key 3 - defaults to time.Now().Unix() if zero
+	OperationHint string   // key 5 - defaults to "ga" (getAssertion) if empty
+	Silent        bool     // key 4 - non-discoverable silent-reconnect QR, see SessionOptions.Silent
+
 	// Internal fields (not encoded in QR)
 	PrivateKey []byte
 	TunnelURL  string
@@ -42,47 +164,28 @@ type QRData struct {
 // compressECKey compresses a P-256 public key to 33 bytes
 func compressECKey(publicKey *ecdsa.PublicKey) [33]byte {
 	var compressed [33]byte
-	
+
 	// Determine the prefix based on the y-coordinate
 	if publicKey.Y.Bit(0) == 0 {
 		compressed[0] = 0x02
 	} else {
 		compressed[0] = 0x03
 	}
-	
+
 	// Copy the x-coordinate (32 bytes)
 	xBytes := publicKey.X.Bytes()
 	copy(compressed[33-len(xBytes):], xBytes)
-	
-	return compressed
-}
 
-// showQRCode generates and displays a QR code as per CTAP2 specification
-func showQRCode() string {
-	rand.Reader.Read(qrSecret[:])
-
-	var err error
-	identityKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		panic(err)
-	}
-	identityKeyCompressed := compressECKey(&identityKey.PublicKey)
-
-	return encodeQRContents(&identityKeyCompressed, &qrSecret)
+	return compressed
 }
 
-// GenerateQRData creates QR code data for CTAP2 hybrid transport
+// GenerateQRData creates QR code data for CTAP2 hybrid transport by
+// starting a new Session and copying its ceremony state into a QRData.
 func GenerateQRData() (*QRData, error) {
-	// Generate QR secret and identity key using CTAP2 specification approach
-	rand.Reader.Read(qrSecret[:])
-
-	var err error
-	identityKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	session, err := NewSession(SessionOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate identity key: %w", err)
+		return nil, err
 	}
-	
-	identityKeyCompressed := compressECKey(&identityKey.PublicKey)
 
 	// Generate tunnel ID (not used in QR but kept for compatibility)
 	tunnelID := make([]byte, 16)
@@ -93,12 +196,15 @@ func GenerateQRData() (*QRData, error) {
 	// Default tunnel service
 	tunnelURL := "cable.ua5v.com"
 
+	publicKey := session.PublicKey()
 	qrData := &QRData{
-		PublicKey:  identityKeyCompressed[:],
-		QRSecret:   qrSecret[:],
-		TunnelID:   tunnelID,
-		PrivateKey: nil, // Will be extracted from identityKey if needed
-		TunnelURL:  tunnelURL,
+		PublicKey:     publicKey[:],
+		QRSecret:      session.QRSecret(),
+		TunnelID:      tunnelID,
+		Timestamp:     session.timestamp,
+		OperationHint: session.operationHint,
+		PrivateKey:    session.privateKey.D.FillBytes(make([]byte, 32)),
+		TunnelURL:     tunnelURL,
 	}
 
 	return qrData, nil
@@ -138,26 +244,6 @@ func digitEncode(d []byte) string {
 	return ret
 }
 
-// cborEncodeInt64 encodes int64 to CBOR format
-func cborEncodeInt64(value int64) []byte {
-	if value < 0 {
-		// Negative integers - not needed for timestamp
-		return []byte{0x20} // placeholder
-	}
-	
-	if value < 24 {
-		return []byte{byte(value)}
-	} else if value < 256 {
-		return []byte{0x18, byte(value)}
-	} else if value < 65536 {
-		return []byte{0x19, byte(value >> 8), byte(value)}
-	} else if value < 4294967296 {
-		return []byte{0x1a, byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}
-	} else {
-		return []byte{0x1b, byte(value >> 56), byte(value >> 48), byte(value >> 40), byte(value >> 32), byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}
-	}
-}
-
 // DisplayQR displays the QR code in the terminal
 func DisplayQR(qrData *QRData) error {
 	// Use our implementation with browser-matching parameters
@@ -165,7 +251,7 @@ func DisplayQR(qrData *QRData) error {
 	if err != nil {
 		return fmt.Errorf("failed to encode caBLE v2 URL: %w", err)
 	}
-	
+
 	// BACKUP: Use browser-generated QR code for comparison
 	//fidoURL := "FIDO:/164256176516630141297853122626219945748359380652102059895513187047676334729158906597767563397436255501466762135855516730075336766520323071777744305390338107096654083076"
 
@@ -202,57 +288,163 @@ func encodeCableV2URL(qrData *QRData) (string, error) {
 	// Convert byte slices to fixed-size arrays as required by the specification
 	var compressedPublicKey [33]byte
 	var qrSecretArray [16]byte
-	
+
 	copy(compressedPublicKey[:], qrData.PublicKey)
 	copy(qrSecretArray[:], qrData.QRSecret)
-	
+
+	timestamp := qrData.Timestamp
+	if timestamp == 0 {
+		timestamp = time.Now().Unix()
+	}
+	operationHint := qrData.OperationHint
+	if operationHint == "" {
+		operationHint = "ga"
+	}
+
 	// Use the exact CTAP2 specification function
-	return encodeQRContents(&compressedPublicKey, &qrSecretArray), nil
+	return encodeQRContents(&compressedPublicKey, &qrSecretArray, timestamp, operationHint, qrData.LinkingHints, qrData.KnownDomains, qrData.Silent), nil
 }
 
-// encodeQRContents encodes QR contents exactly as per CTAP2 specification
-func encodeQRContents(compressedPublicKey *[33]byte, qrSecret *[16]byte) string {
-	numMapElements := 6
-	// GREASE QR code to ensure that keys can be added later.
+// encodeQRContents encodes QR contents exactly as per CTAP2 specification.
+// linkingHints and knownDomains are optional (keys 6 and 7 respectively)
+// and are omitted from the map entirely when empty, matching how key 5
+// (operationHint) is always present but other optional keys are
+// browser-dependent.
+func encodeQRContents(compressedPublicKey *[33]byte, qrSecret *[16]byte, timestamp int64, operationHint string, linkingHints []byte, knownDomains []string, silent bool) string {
+	n := len(assignedTunnelServerDomains)
+	if n > 24 {
+		panic("larger encoding needed")
+	}
+
+	entries := []cbor.MapEntry{
+		cbor.Entry(cbor.UnsignedInt(0), cbor.Bytes(compressedPublicKey[:])),
+		cbor.Entry(cbor.UnsignedInt(1), cbor.Bytes(qrSecret[:])),
+		cbor.Entry(cbor.UnsignedInt(2), cbor.UnsignedInt(uint64(n))),
+		cbor.Entry(cbor.UnsignedInt(3), cbor.UnsignedInt(uint64(timestamp))),
+		cbor.Entry(cbor.UnsignedInt(4), cbor.Bool(silent)), // non-discoverable silent-reconnect QR
+		cbor.Entry(cbor.UnsignedInt(5), cbor.Text(operationHint)),
+	}
+
+	if len(linkingHints) > 0 {
+		entries = append(entries, cbor.Entry(cbor.UnsignedInt(6), cbor.Bytes(linkingHints)))
+	}
+	if len(knownDomains) > 0 {
+		domains := make([]cbor.Value, len(knownDomains))
+		for i, domain := range knownDomains {
+			domains[i] = cbor.Text(domain)
+		}
+		entries = append(entries, cbor.Entry(cbor.UnsignedInt(7), cbor.Arr(domains...)))
+	}
+
+	// GREASE the QR code to ensure that keys can be added later.
 	var randByte [1]byte
 	rand.Reader.Read(randByte[:])
-	extraKey := randByte[0]&3 == 0
-	if extraKey {
-		numMapElements++
+	if randByte[0]&3 == 0 {
+		entries = append(entries, cbor.Entry(cbor.UnsignedInt(65535), cbor.UnsignedInt(0)))
 	}
 
-	var cbor []byte
-	cbor = append(cbor, 0xa0+byte(numMapElements))       // CBOR map
-	cbor = append(cbor, 0)                               // key 0
-	cbor = append(cbor, (cborMajorByteString<<5)|24, 33) // 33 bytes
-	cbor = append(cbor, compressedPublicKey[:]...)
-	cbor = append(cbor, 1)                           // key 1
-	cbor = append(cbor, (cborMajorByteString<<5)|16) // 16 bytes
-	cbor = append(cbor, qrSecret[:]...)
+	qr := "FIDO:/" + digitEncode(cbor.Encode(cbor.MapOf(entries...)))
+	return qr
+}
 
-	cbor = append(cbor, 2) // key 2
-	n := len(assignedTunnelServerDomains)
-	if n > 24 {
-		panic("larger encoding needed")
+// digitDecode is the reverse of digitEncode: it recovers the CBOR bytes a
+// FIDO:/ URL's digit string was built from, so they can be re-decoded (e.g.
+// by decodeCableV2URL for round-trip validation).
+func digitDecode(digitString string) ([]byte, error) {
+	const chunkSize = 7
+	const chunkDigits = 17
+
+	var result []byte
+
+	for len(digitString) >= chunkDigits {
+		chunkStr := digitString[:chunkDigits]
+		digitString = digitString[chunkDigits:]
+
+		val, err := strconv.ParseUint(chunkStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse chunk %s: %w", chunkStr, err)
+		}
+
+		var chunk [8]byte
+		binary.LittleEndian.PutUint64(chunk[:], val)
+		result = append(result, chunk[:chunkSize]...)
 	}
-	cbor = append(cbor, byte(n))
 
-	cbor = append(cbor, 3) // key 3
-	cbor = append(cbor, cborEncodeInt64(time.Now().Unix())...)
+	if len(digitString) > 0 {
+		// partialChunkDigits is the number of digits needed to encode each
+		// length of trailing data from 6 bytes down to zero: 15, 13, 10, 8,
+		// 5, 3, 0.
+		partialChunkDigits := map[int]int{
+			15: 6, 13: 5, 10: 4, 8: 3, 5: 2, 3: 1, 0: 0,
+		}
 
-	cbor = append(cbor, 4) // key 4
-	cbor = append(cbor, 0xf4)  // false (match browser implementation)
+		expectedLen, ok := partialChunkDigits[len(digitString)]
+		if !ok {
+			return nil, fmt.Errorf("unexpected remaining digits length: %d", len(digitString))
+		}
 
-	cbor = append(cbor, 5) // key 5
-	cbor = append(cbor, (3<<5)|2, 'g', 'a') // "ga" for getAssertion (match browser)
+		val, err := strconv.ParseUint(digitString, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse remaining chunk %s: %w", digitString, err)
+		}
 
-	if extraKey {
-		cbor = append(cbor, 0x19, 0xff, 0xff, 0) // key 65535, value 0
+		var chunk [8]byte
+		binary.LittleEndian.PutUint64(chunk[:], val)
+		result = append(result, chunk[:expectedLen]...)
 	}
 
-	qr := "FIDO:/" + digitEncode(cbor)
-	fmt.Println(qr)
-	return qr
+	return result, nil
+}
+
+// decodeCableV2URL reverses encodeCableV2URL: it parses a FIDO:/ URL back
+// into the public key and QR secret it carries, so callers (and
+// ValidateQRDataCBOR) can confirm a QRData round-trips through encoding
+// without drift.
+func decodeCableV2URL(url string) (*QRData, error) {
+	digitString := strings.TrimPrefix(url, "FIDO:/")
+	data, err := digitDecode(digitString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode digit string: %w", err)
+	}
+
+	value, rest, err := cbor.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode CBOR: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after CBOR map", len(rest))
+	}
+	if value.Major != cbor.MajorMap {
+		return nil, fmt.Errorf("not a CBOR map: major type %d", value.Major)
+	}
+
+	publicKey, ok := value.Get(cbor.UnsignedInt(0))
+	if !ok || publicKey.Major != cbor.MajorByteString {
+		return nil, fmt.Errorf("missing or malformed public key (key 0)")
+	}
+	qrSecret, ok := value.Get(cbor.UnsignedInt(1))
+	if !ok || qrSecret.Major != cbor.MajorByteString {
+		return nil, fmt.Errorf("missing or malformed QR secret (key 1)")
+	}
+
+	qrData := &QRData{
+		PublicKey: publicKey.Bytes,
+		QRSecret:  qrSecret.Bytes,
+	}
+
+	if silent, ok := value.Get(cbor.UnsignedInt(4)); ok && silent.Major == cbor.MajorSimple {
+		qrData.Silent = silent.Bool
+	}
+	if hints, ok := value.Get(cbor.UnsignedInt(6)); ok && hints.Major == cbor.MajorByteString {
+		qrData.LinkingHints = hints.Bytes
+	}
+	if domains, ok := value.Get(cbor.UnsignedInt(7)); ok && domains.Major == cbor.MajorArray {
+		for _, d := range domains.Array {
+			qrData.KnownDomains = append(qrData.KnownDomains, d.Text)
+		}
+	}
+
+	return qrData, nil
 }
 
 // ValidateQRData validates the QR code data (legacy format)
@@ -276,7 +468,10 @@ func ValidateQRData(qrData *QRData) error {
 	return nil
 }
 
-// ValidateQRDataCBOR validates the QR code data for CBOR format
+// ValidateQRDataCBOR validates the QR code data for CBOR format, and
+// confirms it round-trips through encodeCableV2URL/decodeCableV2URL
+// without drift (i.e. that the digit-encoded CBOR payload actually decodes
+// back to the same public key and QR secret).
 func ValidateQRDataCBOR(qrData *QRData) error {
 	if len(qrData.PublicKey) != 33 {
 		return fmt.Errorf("invalid public key length: expected 33 (P-256 compressed), got %d", len(qrData.PublicKey))
@@ -286,6 +481,23 @@ func ValidateQRDataCBOR(qrData *QRData) error {
 		return fmt.Errorf("invalid QR secret length: expected 16, got %d", len(qrData.QRSecret))
 	}
 
+	url, err := encodeCableV2URL(qrData)
+	if err != nil {
+		return fmt.Errorf("failed to encode QR data for round-trip check: %w", err)
+	}
+
+	decoded, err := decodeCableV2URL(url)
+	if err != nil {
+		return fmt.Errorf("failed to decode QR data for round-trip check: %w", err)
+	}
+
+	if !bytes.Equal(decoded.PublicKey, qrData.PublicKey) {
+		return fmt.Errorf("round-tripped public key = %x, want %x", decoded.PublicKey, qrData.PublicKey)
+	}
+	if !bytes.Equal(decoded.QRSecret, qrData.QRSecret) {
+		return fmt.Errorf("round-tripped QR secret = %x, want %x", decoded.QRSecret, qrData.QRSecret)
+	}
+
 	return nil
 }
 
@@ -303,4 +515,4 @@ func printQRCode(qrContent string) {
 	fmt.Println("Scan this QR code with your smartphone to authenticate")
 	fmt.Println(qr.ToSmallString(false))
 	fmt.Printf("FIDO URL: %s\n", qrContent)
-}
\ No newline at end of file
+}
@@ -25,11 +25,6 @@ func TestGenerateQRData(t *testing.T) {
 		t.Errorf("TunnelID length = %d, want 16", len(qrData.TunnelID))
 	}
 
-	// Private key is stored in the global identityKey variable in CTAP2 spec
-	if identityKey == nil {
-		t.Error("identityKey should not be nil")
-	}
-
 	if qrData.TunnelURL == "" {
 		t.Error("TunnelURL should not be empty")
 	}
@@ -123,11 +118,6 @@ func TestQRDataValidation(t *testing.T) {
 		t.Error("TunnelID should be 16 bytes")
 	}
 
-	// Private key is handled by global identityKey variable
-	if identityKey == nil {
-		t.Error("identityKey should not be nil")
-	}
-
 	// Test URL generation
 	url, err := encodeCableV2URL(qrData)
 	if err != nil {
@@ -143,11 +133,11 @@ func TestQRDataValidation(t *testing.T) {
 func TestCBOREncodingChromiumFormat(t *testing.T) {
 	// Test case based on Chromium's caBLE v2 implementation
 	// QR code should contain CBOR-encoded map with specific keys
-	
+
 	// Create test QR data with P-256 compressed public key (33 bytes)
 	publicKey, _ := hex.DecodeString("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021") // 33 bytes P-256 compressed
-	qrSecret, _ := hex.DecodeString("a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6") // 16 bytes
-	
+	qrSecret, _ := hex.DecodeString("a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6")                                    // 16 bytes
+
 	qrData := &QRData{
 		PublicKey:  publicKey,
 		QRSecret:   qrSecret,
@@ -155,29 +145,29 @@ func TestCBOREncodingChromiumFormat(t *testing.T) {
 		PrivateKey: make([]byte, 32),
 		TunnelURL:  "cable.ua5v.com",
 	}
-	
+
 	// Test CBOR encoding using specification function
 	url, err := encodeCableV2URL(qrData)
 	if err != nil {
 		t.Fatalf("Failed to encode CBOR map: %v", err)
 	}
-	
+
 	// URL should not be empty
 	if len(url) == 0 {
 		t.Error("URL is empty")
 	}
-	
+
 	t.Logf("Generated URL: %s", url)
 	t.Logf("URL length: %d characters", len(url))
-	
+
 	// URL should start with "FIDO:/"
 	if !strings.HasPrefix(url, "FIDO:/") {
 		t.Errorf("Expected URL to start with 'FIDO:/', got: %s", url[:7])
 	}
-	
+
 	// Should contain encoded data
 	t.Logf("Generated CTAP2-compliant URL: %s", url)
-	
+
 	// Verify the URL contains expected structure
 	if len(url) < 20 {
 		t.Errorf("URL seems too short: %s", url)
@@ -188,7 +178,7 @@ func TestValidateQRDataCBOR(t *testing.T) {
 	// Test validation for CBOR format
 	validPublicKey := make([]byte, 33) // P-256 compressed is 33 bytes
 	validQRSecret := make([]byte, 16)  // QR secret is 16 bytes
-	
+
 	qrData := &QRData{
 		PublicKey:  validPublicKey,
 		QRSecret:   validQRSecret,
@@ -196,19 +186,19 @@ func TestValidateQRDataCBOR(t *testing.T) {
 		PrivateKey: make([]byte, 32),
 		TunnelURL:  "cable.ua5v.com",
 	}
-	
+
 	err := ValidateQRDataCBOR(qrData)
 	if err != nil {
 		t.Errorf("Validation failed for valid data: %v", err)
 	}
-	
+
 	// Test invalid public key length
 	qrData.PublicKey = make([]byte, 32) // Wrong length
 	err = ValidateQRDataCBOR(qrData)
 	if err == nil {
 		t.Error("Expected validation error for invalid public key length")
 	}
-	
+
 	// Test invalid QR secret length
 	qrData.PublicKey = validPublicKey
 	qrData.QRSecret = make([]byte, 32) // Wrong length
@@ -216,4 +206,4 @@ func TestValidateQRDataCBOR(t *testing.T) {
 	if err == nil {
 		t.Error("Expected validation error for invalid QR secret length")
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,102 @@
+package qrcode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewSessionDefaults(t *testing.T) {
+	session, err := NewSession(SessionOptions{})
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+
+	if session.operationHint != "ga" {
+		t.Errorf("operationHint = %q, want %q", session.operationHint, "ga")
+	}
+
+	publicKey := session.PublicKey()
+	if len(publicKey) != 33 {
+		t.Errorf("PublicKey() length = %d, want 33", len(publicKey))
+	}
+
+	if len(session.QRSecret()) != 16 {
+		t.Errorf("QRSecret() length = %d, want 16", len(session.QRSecret()))
+	}
+}
+
+func TestSessionQRContentsRoundTrip(t *testing.T) {
+	session, err := NewSession(SessionOptions{
+		LinkingHints: []byte{0xAA, 0xBB},
+		KnownDomains: []string{"cable.ua5v.com"},
+	})
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+
+	contents, err := session.QRContents()
+	if err != nil {
+		t.Fatalf("QRContents() failed: %v", err)
+	}
+	if !strings.HasPrefix(contents, "FIDO:/") {
+		t.Errorf("QRContents() = %q, want FIDO:/ prefix", contents)
+	}
+
+	decoded, err := decodeCableV2URL(contents)
+	if err != nil {
+		t.Fatalf("decodeCableV2URL() failed: %v", err)
+	}
+
+	publicKey := session.PublicKey()
+	if string(decoded.PublicKey) != string(publicKey[:]) {
+		t.Errorf("decoded PublicKey = %x, want %x", decoded.PublicKey, publicKey)
+	}
+	if string(decoded.QRSecret) != string(session.QRSecret()) {
+		t.Errorf("decoded QRSecret = %x, want %x", decoded.QRSecret, session.QRSecret())
+	}
+}
+
+func TestSessionDeriveEIDKey(t *testing.T) {
+	session, err := NewSession(SessionOptions{})
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+
+	key, err := session.DeriveEIDKey()
+	if err != nil {
+		t.Fatalf("DeriveEIDKey() failed: %v", err)
+	}
+	if len(key) != eidKeyLength {
+		t.Errorf("DeriveEIDKey() length = %d, want %d", len(key), eidKeyLength)
+	}
+
+	key2, err := session.DeriveEIDKey()
+	if err != nil {
+		t.Fatalf("DeriveEIDKey() second call failed: %v", err)
+	}
+	if string(key) != string(key2) {
+		t.Errorf("DeriveEIDKey() is not deterministic: %x != %x", key, key2)
+	}
+}
+
+func TestSessionCloseZeroesSecretsAndRejectsFurtherUse(t *testing.T) {
+	session, err := NewSession(SessionOptions{})
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+
+	session.Close()
+
+	for _, b := range session.qrSecret {
+		if b != 0 {
+			t.Fatalf("qrSecret not zeroed after Close(): %x", session.qrSecret)
+		}
+	}
+
+	if _, err := session.QRContents(); err == nil {
+		t.Error("QRContents() after Close(): want error, got nil")
+	}
+	if _, err := session.DeriveEIDKey(); err == nil {
+		t.Error("DeriveEIDKey() after Close(): want error, got nil")
+	}
+}
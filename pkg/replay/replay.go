@@ -0,0 +1,137 @@
+// Package replay lets a developer reproduce a captured hybrid-transport
+// session offline: it feeds a recorded session's raw CTAP2 frames into
+// ctap2.ParseCTAP2Message and a ctap2.Handler directly, without any of
+// the BLE advertisement wait, QR pairing, or noise tunnel handshake a
+// live run would need.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"ctap2-hybrid-transport/pkg/ctap2"
+)
+
+// Direction values for RecordedFrame.
+const (
+	DirectionRequest  = "request"  // phone -> handler
+	DirectionResponse = "response" // handler -> phone
+)
+
+// RecordedFrame is one line of a recorded session.ndjson: a raw CTAP2
+// frame (command byte + CBOR body, as ctap2.ParseCTAP2Message expects)
+// captured from a real tunnel.Connection, tagged with which direction it
+// travelled and when.
+type RecordedFrame struct {
+	Direction string    `json:"direction"`
+	Data      []byte    `json:"data"`
+	Time      time.Time `json:"time,omitempty"`
+}
+
+// LoadSession reads a recorded session from an NDJSON file of
+// RecordedFrame lines, such as one captured by tagging the frames a live
+// run exchanges over its tunnel.Connection.
+func LoadSession(path string) ([]RecordedFrame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("replay: failed to open session %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var frames []RecordedFrame
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var frame RecordedFrame
+		if err := json.Unmarshal(line, &frame); err != nil {
+			return nil, fmt.Errorf("replay: failed to decode session line %q: %w", line, err)
+		}
+		frames = append(frames, frame)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("replay: failed to read session %s: %w", path, err)
+	}
+	return frames, nil
+}
+
+// Sink replays a recorded session's request frames to a ctap2.Handler one
+// at a time via ReadCTAP, and records whatever the handler writes back
+// via WriteCTAP. It satisfies ctap2.MessageSink, demonstrating that the
+// handler needs no live tunnel.Connection to run.
+type Sink struct {
+	requests  []RecordedFrame
+	Responses [][]byte
+}
+
+var _ ctap2.MessageSink = (*Sink)(nil)
+
+// NewSink returns a Sink that replays frames' "request"-direction frames,
+// in order, ignoring any recorded "response" frames (the handler
+// produces its own).
+func NewSink(frames []RecordedFrame) *Sink {
+	var requests []RecordedFrame
+	for _, frame := range frames {
+		if frame.Direction == DirectionRequest {
+			requests = append(requests, frame)
+		}
+	}
+	return &Sink{requests: requests}
+}
+
+// ReadCTAP returns the next recorded request frame, or io.EOF once the
+// session is exhausted.
+func (s *Sink) ReadCTAP() ([]byte, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	frame := s.requests[0]
+	s.requests = s.requests[1:]
+	return frame.Data, nil
+}
+
+// WriteCTAP records the handler's response for Run to return.
+func (s *Sink) WriteCTAP(payload []byte) error {
+	s.Responses = append(s.Responses, payload)
+	return nil
+}
+
+// Run replays frames' recorded request frames against authenticator,
+// returning the handler's response to each in order. It never touches
+// BLE, QR codes, or a tunnel - only ctap2.ParseCTAP2Message and
+// ctap2.Handler.ProcessCTAP2Message.
+func Run(frames []RecordedFrame, authenticator ctap2.Authenticator) ([][]byte, error) {
+	sink := NewSink(frames)
+	handler := ctap2.NewHandler(sink, authenticator)
+
+	for {
+		raw, err := sink.ReadCTAP()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		message, err := ctap2.ParseCTAP2Message(raw)
+		if err != nil {
+			return nil, fmt.Errorf("replay: failed to parse frame: %w", err)
+		}
+
+		response, err := handler.ProcessCTAP2Message(message)
+		if err != nil {
+			return nil, fmt.Errorf("replay: handler failed to process %s: %w", ctap2.GetCommandName(message.Command), err)
+		}
+
+		if err := sink.WriteCTAP(response); err != nil {
+			return nil, err
+		}
+	}
+
+	return sink.Responses, nil
+}
@@ -0,0 +1,35 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+
+	"ctap2-hybrid-transport/pkg/ble"
+)
+
+// Scanner is implemented by *ble.Scanner: it waits for the phone's caBLE v2
+// BLE service-data advertisement, decrypts it with the EIK derived from the
+// QR secret, and extracts the routing ID and connection nonce the tunnel
+// needs to dial. Accepting this interface rather than *ble.Scanner directly
+// lets tests drive AwaitAdvertAndConnect with a fake instead of real BLE
+// hardware.
+type Scanner interface {
+	WaitForTunnelAdvertisement(ctx context.Context) (*ble.TunnelInfo, error)
+}
+
+// AwaitAdvertAndConnect waits for scanner to observe the phone's BLE
+// advertisement, wires the routing ID/nonce/domain it decodes into c (which
+// also picks the right tunnel server domain via
+// DomainForEncodedTunnelServerDomain, see SetTunnelInfo), and connects to
+// the tunnel service - so callers don't need to plumb BLE discovery and
+// tunnel setup together themselves.
+func (c *Client) AwaitAdvertAndConnect(ctx context.Context, scanner Scanner) (*Connection, error) {
+	info, err := scanner.WaitForTunnelAdvertisement(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive tunnel advertisement: %w", err)
+	}
+
+	c.SetTunnelInfo(info.RoutingID, info.ConnectionNonce, info.EncodedTunnelDomain)
+
+	return c.WaitForConnection(ctx)
+}
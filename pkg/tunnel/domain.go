@@ -0,0 +1,65 @@
+package tunnel
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+)
+
+// assignedTunnelServerDomains holds the caBLE v2 tunnel server domains that
+// are assigned directly (rather than synthesized), indexed by the low byte
+// of the routing ID. Mirrors pkg/qrcode's assignedTunnelServerDomains list.
+var assignedTunnelServerDomains = []string{"cable.ua5v.com", "cable.auth.com"}
+
+// domainSynthesisEncoding is the unpadded standard (upper-case) base32
+// alphabet the caBLE v2 spec uses to turn a synthesized domain's hash into a
+// DNS label; its output is lower-cased where the label is built.
+var domainSynthesisEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// DomainForRoutingID derives the tunnel service domain a 3-byte routing ID
+// points at. The caBLE v2 spec assigns each routing ID to one of a small
+// table of tunnel server domains via its first byte: indices within
+// assignedTunnelServerDomains map directly, and every other index
+// synthesizes a "cable.<hash>.net" domain by hashing the index byte. This
+// removes the need for a caller-supplied tunnelURL once the routing ID is
+// known from the BLE advertisement.
+func DomainForRoutingID(routingID []byte) string {
+	if len(routingID) == 0 {
+		return assignedTunnelServerDomains[0]
+	}
+
+	domainIndex := routingID[0]
+	if int(domainIndex) < len(assignedTunnelServerDomains) {
+		return assignedTunnelServerDomains[domainIndex]
+	}
+
+	digest := sha256.Sum256([]byte{domainIndex})
+	label := strings.ToLower(domainSynthesisEncoding.EncodeToString(digest[:8]))
+	return fmt.Sprintf("cable.%s.net", label)
+}
+
+// DomainForEncodedTunnelServerDomain derives the tunnel service domain from
+// the decrypted advertisement's own encodedTunnelServerDomain field (the
+// caBLE v2 plaintext's final two bytes, see ble.UnpackDecryptedAdvert):
+// values below len(assignedTunnelServerDomains) (0 and 1) index directly
+// into assignedTunnelServerDomains, and every other value, 2-255 included,
+// synthesizes a "cable.<hash>.net" domain by hashing the
+// little-endian-encoded value itself; no value is rejected as an unassigned
+// index. This is the field the spec actually
+// assigns domains through; DomainForRoutingID derives from the routing ID
+// instead and remains the fallback when only a routing ID is available
+// (e.g. a caller that hasn't decoded the full advertisement).
+func DomainForEncodedTunnelServerDomain(encoded uint16) string {
+	if int(encoded) < len(assignedTunnelServerDomains) {
+		return assignedTunnelServerDomains[encoded]
+	}
+
+	var seed [2]byte
+	seed[0] = byte(encoded)
+	seed[1] = byte(encoded >> 8)
+
+	digest := sha256.Sum256(seed[:])
+	label := strings.ToLower(domainSynthesisEncoding.EncodeToString(digest[:8]))
+	return fmt.Sprintf("cable.%s.net", label)
+}
@@ -0,0 +1,71 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+
+	"ctap2-hybrid-transport/pkg/cbor"
+)
+
+// LinkingInfo is the pairing state an authenticator hands back in its
+// mandatory post-handshake message after a fresh QR-based pairing: its own
+// static public key, a contact ID identifying it to the tunnel service,
+// and a pairing/linking secret. Callers persist this and pass it back to
+// Client.Reconnect to re-establish a tunnel connection later without
+// scanning a QR code again.
+type LinkingInfo struct {
+	AuthenticatorPublicKey []byte
+	ContactID              []byte
+	PairingSecret          []byte
+	Name                   string
+}
+
+// parseLinkingInfo decodes the CBOR payload of the post-handshake linking
+// message into a LinkingInfo, rejecting one missing the fields a later
+// Reconnect call requires.
+func parseLinkingInfo(payload []byte) (*LinkingInfo, error) {
+	value, rest, err := cbor.Decode(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode linking info: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("linking info message has %d trailing bytes", len(rest))
+	}
+	if value.Major != cbor.MajorMap {
+		return nil, fmt.Errorf("linking info message is not a CBOR map")
+	}
+
+	var info LinkingInfo
+	if v, ok := value.Get(cbor.UnsignedInt(1)); ok {
+		info.AuthenticatorPublicKey = v.Bytes
+	}
+	if v, ok := value.Get(cbor.UnsignedInt(2)); ok {
+		info.ContactID = v.Bytes
+	}
+	if v, ok := value.Get(cbor.UnsignedInt(3)); ok {
+		info.PairingSecret = v.Bytes
+	}
+	if v, ok := value.Get(cbor.UnsignedInt(4)); ok {
+		info.Name = v.Text
+	}
+
+	if len(info.AuthenticatorPublicKey) == 0 || len(info.ContactID) == 0 || len(info.PairingSecret) == 0 {
+		return nil, errors.New("linking info message is missing required fields")
+	}
+	return &info, nil
+}
+
+// clientNonceLength is the size of the fresh nonce the desktop generates
+// for each state-assisted reconnect attempt.
+const clientNonceLength = 16
+
+// encodeClientPayload CBOR-encodes the X-caBLE-Client-Payload header body:
+// the pairing secret from the original linking plus a fresh client nonce,
+// so the authenticator can bind this connection attempt to a specific
+// pairing and mix the nonce into its own key derivation.
+func encodeClientPayload(pairingSecret, clientNonce []byte) ([]byte, error) {
+	return cbor.Encode(cbor.MapOf(
+		cbor.Entry(cbor.UnsignedInt(1), cbor.Bytes(pairingSecret)),
+		cbor.Entry(cbor.UnsignedInt(2), cbor.Bytes(clientNonce)),
+	)), nil
+}
@@ -0,0 +1,102 @@
+package tunnel
+
+import (
+	"crypto/ecdh"
+	"crypto/elliptic"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/flynn/noise"
+)
+
+// noiseP256 implements noise.DHFunc using NIST P-256. Public keys are
+// represented on the wire as 33-byte compressed SEC1 points, the same
+// encoding pkg/qrcode uses for the caBLE v2 identity key, so that the
+// Noise "e"/"s" tokens stay consistent with the rest of this codebase.
+type noiseP256 struct{}
+
+func (noiseP256) GenerateKeypair(rng io.Reader) (noise.DHKey, error) {
+	priv, err := ecdh.P256().GenerateKey(rng)
+	if err != nil {
+		return noise.DHKey{}, err
+	}
+	return noise.DHKey{
+		Private: priv.Bytes(),
+		Public:  compressP256PublicKey(priv.PublicKey()),
+	}, nil
+}
+
+func (noiseP256) DH(privkey, pubkey []byte) ([]byte, error) {
+	priv, err := ecdh.P256().NewPrivateKey(privkey)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := decompressP256PublicKey(pubkey)
+	if err != nil {
+		return nil, err
+	}
+	return priv.ECDH(pub)
+}
+
+func (noiseP256) DHLen() int     { return 33 }
+func (noiseP256) DHName() string { return "P256" }
+
+// compressP256PublicKey converts a crypto/ecdh P-256 public key (65-byte
+// uncompressed SEC1 encoding) to the 33-byte compressed form used
+// throughout this repo; see pkg/qrcode.compressECKey.
+func compressP256PublicKey(pub *ecdh.PublicKey) []byte {
+	raw := pub.Bytes() // 0x04 || X || Y
+	x := new(big.Int).SetBytes(raw[1:33])
+	y := new(big.Int).SetBytes(raw[33:65])
+	return elliptic.MarshalCompressed(elliptic.P256(), x, y)
+}
+
+// decompressP256PublicKey is the inverse of compressP256PublicKey.
+func decompressP256PublicKey(compressed []byte) (*ecdh.PublicKey, error) {
+	if len(compressed) != 33 {
+		return nil, errors.New("tunnel: P-256 public key must be 33 bytes (compressed)")
+	}
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), compressed)
+	if x == nil {
+		return nil, errors.New("tunnel: invalid compressed P-256 public key")
+	}
+	raw := make([]byte, 65)
+	raw[0] = 0x04
+	x.FillBytes(raw[1:33])
+	y.FillBytes(raw[33:65])
+	return ecdh.P256().NewPublicKey(raw)
+}
+
+// deriveDeterministicP256Keypair derives a P-256 keypair from seed in a
+// fully deterministic way. This cannot use ecdh.PrivateKey's ordinary
+// generation path (as noiseP256.GenerateKeypair does): per
+// crypto/internal/randutil.MaybeReadByte, that path is intentionally
+// non-deterministic even when fed a fixed byte stream, to keep callers
+// from relying on unspecified behaviour. Instead, 32-byte chunks are read
+// from seed until one, taken as a big-endian integer, is a non-zero scalar
+// below the curve order; out-of-range chunks are discarded rather than
+// reduced, and the first valid one is used directly as the private key.
+func deriveDeterministicP256Keypair(seed io.Reader) (noise.DHKey, error) {
+	n := elliptic.P256().Params().N
+	for {
+		candidate := make([]byte, 32)
+		if _, err := io.ReadFull(seed, candidate); err != nil {
+			return noise.DHKey{}, err
+		}
+
+		d := new(big.Int).SetBytes(candidate)
+		if d.Sign() == 0 || d.Cmp(n) >= 0 {
+			continue
+		}
+
+		priv, err := ecdh.P256().NewPrivateKey(d.FillBytes(make([]byte, 32)))
+		if err != nil {
+			continue
+		}
+		return noise.DHKey{
+			Private: priv.Bytes(),
+			Public:  compressP256PublicKey(priv.PublicKey()),
+		}, nil
+	}
+}
@@ -0,0 +1,137 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"ctap2-hybrid-transport/pkg/ble"
+)
+
+// BackoffConfig controls Tunnel's reconnect-with-backoff behavior: delays
+// start at Initial and double (Factor) after each failed attempt, capped at
+// Max.
+type BackoffConfig struct {
+	Initial time.Duration
+	Max     time.Duration
+	Factor  float64
+}
+
+// DefaultBackoff is used by OpenTunnel and matches typical WebSocket
+// reconnect conventions: start at half a second, cap at 30 seconds.
+var DefaultBackoff = BackoffConfig{
+	Initial: 500 * time.Millisecond,
+	Max:     30 * time.Second,
+	Factor:  2,
+}
+
+// Tunnel is a framed CTAP2 message channel over an established tunnel
+// Connection: Send/Recv split and join the CTAP2 command byte that
+// ble.Scanner/tunnel.Connection don't interpret themselves, and Reconnect
+// re-dials with exponential backoff if the connection drops. It's the
+// piece HybridClient.Authenticate's scanner-wait/AwaitAdvertAndConnect/
+// ReadCTAP-WriteCTAP loop already does inline; Tunnel exists for callers
+// that want that machinery as a standalone value instead of reimplementing
+// it.
+type Tunnel struct {
+	client  *Client
+	conn    *Connection
+	backoff BackoffConfig
+}
+
+// OpenTunnel waits out info (as decoded by ble.Scanner.WaitForTunnelAdvertisement)
+// and the QR pairing keys, dials the tunnel service, and runs the
+// Noise_NKpsk0 handshake, retrying the dial with DefaultBackoff until it
+// succeeds or ctx is cancelled.
+func OpenTunnel(ctx context.Context, info *ble.TunnelInfo, privateKey, publicKey, qrSecret []byte) (*Tunnel, error) {
+	return OpenTunnelWithBackoff(ctx, info, privateKey, publicKey, qrSecret, DefaultBackoff)
+}
+
+// OpenTunnelWithBackoff is OpenTunnel with an explicit BackoffConfig.
+func OpenTunnelWithBackoff(ctx context.Context, info *ble.TunnelInfo, privateKey, publicKey, qrSecret []byte, backoff BackoffConfig) (*Tunnel, error) {
+	client, err := NewClient("", privateKey, publicKey, qrSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tunnel client: %w", err)
+	}
+	client.SetTunnelInfo(info.RoutingID, info.ConnectionNonce, info.EncodedTunnelDomain)
+
+	conn, err := connectWithBackoff(ctx, client, backoff)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tunnel{client: client, conn: conn, backoff: backoff}, nil
+}
+
+// connectWithBackoff calls client.WaitForConnection, retrying with
+// exponentially increasing delay (capped at cfg.Max) until it succeeds or
+// ctx is done.
+func connectWithBackoff(ctx context.Context, client *Client, cfg BackoffConfig) (*Connection, error) {
+	delay := cfg.Initial
+	for attempt := 1; ; attempt++ {
+		conn, err := client.WaitForConnection(ctx)
+		if err == nil {
+			return conn, nil
+		}
+
+		log.Printf("Tunnel: connection attempt %d failed: %v", attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("tunnel connection aborted: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+
+		delay = time.Duration(float64(delay) * cfg.Factor)
+		if delay > cfg.Max {
+			delay = cfg.Max
+		}
+	}
+}
+
+// Reconnect closes the current connection, if any, and re-dials with
+// backoff - for recovering from a dropped connection without going back
+// through BLE advertisement discovery.
+func (t *Tunnel) Reconnect(ctx context.Context) error {
+	if t.conn != nil {
+		t.conn.Close()
+	}
+
+	conn, err := connectWithBackoff(ctx, t.client, t.backoff)
+	if err != nil {
+		return err
+	}
+	t.conn = conn
+	return nil
+}
+
+// Send encodes cmd as the CTAP2 command byte (see ParseCTAP2Message) and
+// writes it followed by payload as a single framed CTAP2 message.
+func (t *Tunnel) Send(cmd byte, payload []byte) error {
+	message := make([]byte, 0, len(payload)+1)
+	message = append(message, cmd)
+	message = append(message, payload...)
+	return t.conn.WriteCTAP(message)
+}
+
+// Recv reads the next framed CTAP2 message and splits it into its command
+// byte and payload.
+func (t *Tunnel) Recv() (byte, []byte, error) {
+	message, err := t.conn.ReadCTAP()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(message) == 0 {
+		return 0, nil, fmt.Errorf("tunnel: received empty CTAP2 message")
+	}
+	return message[0], message[1:], nil
+}
+
+// Close shuts down the underlying tunnel connection.
+func (t *Tunnel) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+	return t.conn.Close()
+}
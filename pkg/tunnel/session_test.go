@@ -0,0 +1,229 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flynn/noise"
+	"github.com/gorilla/websocket"
+)
+
+// insecureTestTransport is a TunnelTransport identical to the production
+// websocketTransport except it skips TLS certificate verification, so
+// tests can dial the self-signed httptest.NewTLSServer fake phone without
+// pulling a real CA into the test tree.
+type insecureTestTransport struct{}
+
+func (insecureTestTransport) Dial(ctx context.Context, url string, subprotocol string, headers http.Header) (Framed, error) {
+	dialer := &websocket.Dialer{
+		Subprotocols:    []string{subprotocol},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	conn, _, err := dialer.DialContext(ctx, url, headers)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// newFakePhoneServer starts a local WebSocket server that performs the
+// responder side of the Noise_NKpsk0 handshake Tunnel's client side runs
+// (see performHandshake), sends the mandatory post-handshake linking-info
+// update frame, then echoes every CTAP2 message it receives back to the
+// caller unchanged. It stands in for a phone well enough to exercise
+// OpenTunnel/Send/Recv against a real network socket instead of a fake
+// Framed.
+func newFakePhoneServer(t *testing.T, qrSecret []byte) *httptest.Server {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{Subprotocols: []string{"fido.cable"}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		wsConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("fake phone: upgrade failed: %v", err)
+			return
+		}
+		defer wsConn.Close()
+
+		psk, err := derivePSK(qrSecret)
+		if err != nil {
+			t.Errorf("fake phone: derivePSK failed: %v", err)
+			return
+		}
+		responderStatic, err := deriveResponderStaticKey(qrSecret)
+		if err != nil {
+			t.Errorf("fake phone: deriveResponderStaticKey failed: %v", err)
+			return
+		}
+
+		hs, err := noise.NewHandshakeState(noise.Config{
+			CipherSuite:           cableNoiseCipherSuite,
+			Pattern:               noise.HandshakeNK,
+			Initiator:             false,
+			PresharedKey:          psk,
+			PresharedKeyPlacement: 0,
+			StaticKeypair:         responderStatic,
+		})
+		if err != nil {
+			t.Errorf("fake phone: failed to initialize Noise handshake: %v", err)
+			return
+		}
+
+		_, initialMessage, err := wsConn.ReadMessage()
+		if err != nil {
+			t.Errorf("fake phone: failed to read initial handshake message: %v", err)
+			return
+		}
+		if _, _, _, err := hs.ReadMessage(nil, initialMessage); err != nil {
+			t.Errorf("fake phone: failed to process initial handshake message: %v", err)
+			return
+		}
+
+		responseMessage, cs1, cs2, err := hs.WriteMessage(nil, nil)
+		if err != nil {
+			t.Errorf("fake phone: failed to create handshake response: %v", err)
+			return
+		}
+		if err := wsConn.WriteMessage(websocket.BinaryMessage, responseMessage); err != nil {
+			t.Errorf("fake phone: failed to send handshake response: %v", err)
+			return
+		}
+
+		// Per the Noise Split() convention the initiator (the Tunnel under
+		// test) encrypts with cs1 and decrypts with cs2, so the responder
+		// here does the opposite: send with cs2, receive with cs1.
+		send, recv := cs2, cs1
+
+		linkingPayload := encodeLinkingInfoForTest(&LinkingInfo{
+			AuthenticatorPublicKey: bytes.Repeat([]byte{0x07}, 33),
+			ContactID:              []byte{0x01, 0x02, 0x03},
+			PairingSecret:          bytes.Repeat([]byte{0x08}, 16),
+			Name:                   "fake phone",
+		})
+		linkingFrame, err := send.Encrypt(nil, nil, padMessage(messageTypeUpdate, linkingPayload))
+		if err != nil {
+			t.Errorf("fake phone: failed to encrypt linking info: %v", err)
+			return
+		}
+		if err := wsConn.WriteMessage(websocket.BinaryMessage, linkingFrame); err != nil {
+			t.Errorf("fake phone: failed to send linking info: %v", err)
+			return
+		}
+
+		for {
+			_, encrypted, err := wsConn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			plaintext, err := recv.Decrypt(nil, nil, encrypted)
+			if err != nil {
+				t.Errorf("fake phone: failed to decrypt message: %v", err)
+				return
+			}
+
+			msgType, payload, err := unpadMessage(plaintext)
+			if err != nil {
+				t.Errorf("fake phone: failed to unpad message: %v", err)
+				return
+			}
+			if msgType == messageTypeShutdown {
+				return
+			}
+
+			reply, err := send.Encrypt(nil, nil, padMessage(msgType, payload))
+			if err != nil {
+				t.Errorf("fake phone: failed to encrypt echo reply: %v", err)
+				return
+			}
+			if err := wsConn.WriteMessage(websocket.BinaryMessage, reply); err != nil {
+				return
+			}
+		}
+	})
+
+	return httptest.NewTLSServer(mux)
+}
+
+// TestOpenTunnelSendRecvRoundTrip dials a local fake phone server end to
+// end - real WebSocket, real Noise_NKpsk0 handshake, real framing - and
+// checks that a CTAP2 message sent through Tunnel.Send comes back through
+// Tunnel.Recv with the same command byte and payload, proving the Tunnel
+// wraps Client/Connection correctly instead of just against fakes.
+func TestOpenTunnelSendRecvRoundTrip(t *testing.T) {
+	qrSecret := bytes.Repeat([]byte{0x55}, 16)
+	server := newFakePhoneServer(t, qrSecret)
+	defer server.Close()
+
+	tunnelURL := "wss://" + strings.TrimPrefix(server.URL, "https://")
+
+	// OpenTunnel derives the tunnel domain from a BLE-advertised
+	// EncodedTunnelDomain, which has no way to point at a local test
+	// server; build the client directly with the fake phone's URL instead
+	// and run the same connectWithBackoff/Tunnel machinery OpenTunnel uses.
+	client, err := NewClient(tunnelURL, bytes.Repeat([]byte{0x01}, 32), bytes.Repeat([]byte{0x02}, 33), qrSecret)
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	client.transport = insecureTestTransport{}
+	client.routingID = []byte{0xAA, 0xBB, 0xCC} // avoids an empty path segment that net/http redirects away
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := connectWithBackoff(ctx, client, BackoffConfig{Initial: 10 * time.Millisecond, Max: 100 * time.Millisecond, Factor: 2})
+	if err != nil {
+		t.Fatalf("connectWithBackoff() failed: %v", err)
+	}
+
+	tunnel := &Tunnel{client: client, conn: conn, backoff: DefaultBackoff}
+	defer tunnel.Close()
+
+	wantCmd := byte(0x01) // CTAP2MakeCredential
+	wantPayload := []byte{0xA1, 0x01, 0x02}
+
+	if err := tunnel.Send(wantCmd, wantPayload); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	gotCmd, gotPayload, err := tunnel.Recv()
+	if err != nil {
+		t.Fatalf("Recv() failed: %v", err)
+	}
+	if gotCmd != wantCmd {
+		t.Errorf("Recv() cmd = 0x%02x, want 0x%02x", gotCmd, wantCmd)
+	}
+	if !bytes.Equal(gotPayload, wantPayload) {
+		t.Errorf("Recv() payload = %x, want %x", gotPayload, wantPayload)
+	}
+}
+
+// TestConnectWithBackoffRespectsContextCancellation checks that a Tunnel
+// dial that can never succeed gives up as soon as its context is
+// cancelled, rather than retrying forever.
+func TestConnectWithBackoffRespectsContextCancellation(t *testing.T) {
+	client, err := NewClient("ws://127.0.0.1:1", bytes.Repeat([]byte{0x01}, 32), bytes.Repeat([]byte{0x02}, 33), bytes.Repeat([]byte{0x03}, 16))
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = connectWithBackoff(ctx, client, BackoffConfig{Initial: 10 * time.Millisecond, Max: 20 * time.Millisecond, Factor: 2})
+	if err == nil {
+		t.Fatalf("connectWithBackoff(): want error against an unreachable address, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("connectWithBackoff() took %v, want it to give up promptly once ctx is cancelled", elapsed)
+	}
+}
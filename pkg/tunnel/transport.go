@@ -0,0 +1,43 @@
+package tunnel
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Framed is the minimal framed-message connection Client and Connection
+// need from a tunnel transport: send and receive whole binary messages,
+// with a deadline on reads. *websocket.Conn satisfies this directly.
+type Framed interface {
+	WriteMessage(messageType int, data []byte) error
+	ReadMessage() (messageType int, p []byte, err error)
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// TunnelTransport opens a Framed connection to a tunnel service URL.
+// Client uses the default websocketTransport in production; tests can
+// substitute a fake to exercise Client without real network I/O.
+type TunnelTransport interface {
+	Dial(ctx context.Context, url string, subprotocol string, headers http.Header) (Framed, error)
+}
+
+// websocketTransport is the production TunnelTransport, backed by
+// gorilla/websocket, matching the subprotocol/URL scheme the caBLE v2
+// tunnel service expects.
+type websocketTransport struct{}
+
+func (websocketTransport) Dial(ctx context.Context, url string, subprotocol string, headers http.Header) (Framed, error) {
+	dialer := &websocket.Dialer{
+		Subprotocols: []string{subprotocol},
+	}
+
+	conn, _, err := dialer.DialContext(ctx, url, headers)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
@@ -5,37 +5,65 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/flynn/noise"
 	"github.com/gorilla/websocket"
-	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/hkdf"
 )
 
+// caBLE v2 post-handshake message type tags (the first plaintext byte of
+// every framed message).
+const (
+	messageTypeShutdown = 0x00
+	messageTypeCTAP     = 0x01
+	messageTypeUpdate   = 0x02
+)
+
+// paddingGranularity is the block size every framed plaintext is padded
+// up to, per the caBLE v2 specification.
+const paddingGranularity = 32
+
+// ErrShutdown is returned by ReadCTAP once the peer sends a shutdown
+// (messageTypeShutdown) message; the connection should be torn down.
+var ErrShutdown = errors.New("tunnel: peer sent shutdown message")
+
+// cableNoiseCipherSuite is the caBLE v2 Noise_*_P256_AESGCM_SHA256 cipher
+// suite: P-256 for the DH step (wire-compatible with pkg/qrcode's
+// compressed-point identity keys), AES-256-GCM for the AEAD transform, and
+// SHA-256 for the handshake hash and HKDF.
+var cableNoiseCipherSuite = noise.NewCipherSuite(noiseP256{}, noise.CipherAESGCM, noise.HashSHA256)
+
 // Client handles tunnel service communication
 type Client struct {
-	tunnelURL    string
-	privateKey   []byte
-	publicKey    []byte
-	qrSecret     []byte
-	tunnelID     []byte
-	routingID    []byte
-	conn         *websocket.Conn
-	handshakeKey []byte
+	tunnelURL  string
+	privateKey []byte
+	publicKey  []byte
+	qrSecret   []byte
+	tunnelID   []byte
+	routingID  []byte
+	conn       Framed
+	transport  TunnelTransport
 }
 
-// Connection represents a tunnel connection
+// Connection represents a tunnel connection. send/recv are the Noise
+// CipherStates produced by the handshake; each tracks its own 96-bit
+// nonce (a big-endian counter incrementing per message, per the Noise
+// spec) independently in each direction. updates buffers messageTypeUpdate
+// frames the phone sends interleaved with CTAP traffic.
 type Connection struct {
-	conn       *websocket.Conn
-	encryptKey []byte
-	decryptKey []byte
-	sequenceNo uint64
+	conn        Framed
+	send        *noise.CipherState
+	recv        *noise.CipherState
+	updates     chan []byte
+	linkingInfo *LinkingInfo
 }
 
 // NewClient creates a new tunnel client
@@ -64,6 +92,27 @@ func NewClient(tunnelURL string, privateKey []byte, publicKey []byte, qrSecret [
 		qrSecret:   qrSecret,
 		tunnelID:   tunnelID,
 		routingID:  nil, // Will be set from BLE advertisement
+		transport:  websocketTransport{},
+	}, nil
+}
+
+// NewReconnectClient creates a Client for the state-assisted reconnect
+// flow only (Client.Reconnect). Unlike NewClient, it takes no QR secret
+// and derives no tunnel ID, since contact-ID-based reconnect never goes
+// through the fresh-pairing Noise_NKpsk0 connect path that needs one.
+func NewReconnectClient(tunnelURL string, privateKey, publicKey []byte) (*Client, error) {
+	if len(privateKey) != 32 {
+		return nil, fmt.Errorf("private key must be 32 bytes, got %d", len(privateKey))
+	}
+	if len(publicKey) != 33 {
+		return nil, fmt.Errorf("public key must be 33 bytes, got %d", len(publicKey))
+	}
+
+	return &Client{
+		tunnelURL:  tunnelURL,
+		privateKey: privateKey,
+		publicKey:  publicKey,
+		transport:  websocketTransport{},
 	}, nil
 }
 
@@ -75,15 +124,15 @@ func deriveTunnelID(qrSecret []byte) ([]byte, error) {
 	var purpose32 [4]byte
 	purpose32[0] = byte(2) // keyPurposeTunnelID = 2
 	// purpose32[1], purpose32[2], purpose32[3] remain zero
-	
+
 	hkdfReader := hkdf.New(sha256.New, qrSecret, nil, purpose32[:])
-	
+
 	tunnelID := make([]byte, 16) // 128 bits
 	_, err := io.ReadFull(hkdfReader, tunnelID)
 	if err != nil {
 		return nil, fmt.Errorf("HKDF derivation failed: %w", err)
 	}
-	
+
 	log.Printf("Derived tunnel ID from QR secret (purpose=2): %x", tunnelID)
 	return tunnelID, nil
 }
@@ -94,13 +143,13 @@ func (c *Client) WaitForConnection(ctx context.Context) (*Connection, error) {
 	// Based on Chromium source analysis and cable.google.com expected format:
 	// wss://domain.googlevideo.com/connect/[base64-encoded-routing-id]/[base64-encoded-tunnel-id]
 	// OR: wss://domain/connect/[routing-id-hex]/[tunnel-id-hex]
-	
+
 	// In caBLE v2, routing ID is 3 bytes and tunnel ID is 10 bytes (nonce)
 	// Let's try the correct Google caBLE service URL format
-	
+
 	// Set up WebSocket connection according to Chromium caBLE specification
 	// The example shows: Dial(connectURL, nil) - no custom headers
-	
+
 	// Ensure tunnelURL doesn't have protocol prefix
 	domain := c.tunnelURL
 	if strings.HasPrefix(domain, "wss://") {
@@ -109,15 +158,19 @@ func (c *Client) WaitForConnection(ctx context.Context) (*Connection, error) {
 	if strings.HasPrefix(domain, "ws://") {
 		domain = strings.TrimPrefix(domain, "ws://")
 	}
-	
+	if domain == "" {
+		domain = DomainForRoutingID(c.routingID)
+		log.Printf("No explicit tunnel URL configured; derived domain from routing ID: %s", domain)
+	}
+
 	// Try multiple URL formats based on Chromium's caBLE implementation
 	routingIDHex := hex.EncodeToString(c.routingID)
 	tunnelIDHex := hex.EncodeToString(c.tunnelID)
-	
+
 	// Also try base64 encoding (URL-safe)
 	routingIDB64 := base64.URLEncoding.EncodeToString(c.routingID)
 	tunnelIDB64 := base64.URLEncoding.EncodeToString(c.tunnelID)
-	
+
 	log.Printf("Constructing WebSocket URL:")
 	log.Printf("  Domain: %s", domain)
 	log.Printf("  Routing ID (3 bytes): %x", c.routingID)
@@ -126,31 +179,31 @@ func (c *Client) WaitForConnection(ctx context.Context) (*Connection, error) {
 	log.Printf("  Tunnel ID (hex): %s", tunnelIDHex)
 	log.Printf("  Routing ID (base64): %s", routingIDB64)
 	log.Printf("  Tunnel ID (base64): %s", tunnelIDB64)
-	
+
 	// According to Chromium caBLE specification:
-	// "In order to request a connection to a given tunnel ID, the path of the WebSockets URL is set to 
-	// /cable/connect/ followed by the lower-case, hex-encoded routing ID, another foreslash, 
+	// "In order to request a connection to a given tunnel ID, the path of the WebSockets URL is set to
+	// /cable/connect/ followed by the lower-case, hex-encoded routing ID, another foreslash,
 	// then the lower-case, hex-encoded tunnel ID."
 	connectURL := fmt.Sprintf("wss://%s/cable/connect/%s/%s", domain, routingIDHex, tunnelIDHex)
-	
+
 	log.Printf("Using Chromium caBLE specification URL format:")
 	log.Printf("  URL: %s", connectURL)
-	
+
 	// Focus on the official Chromium specification format only
 	urlPatterns := []string{
 		// Pattern 1: Official Chromium specification format
 		connectURL,
 	}
-	
+
 	log.Printf("Will try %d different URL patterns:", len(urlPatterns))
 	for i, url := range urlPatterns {
 		log.Printf("  Pattern %d: %s", i+1, url)
 	}
-	
+
 	// Try each pattern
 	for i, WSURL := range urlPatterns {
 		log.Printf("Attempting connection with pattern %d: %s", i+1, WSURL)
-		
+
 		if conn, err := c.attemptConnection(ctx, WSURL); err == nil {
 			log.Printf("Connection successful with pattern %d!", i+1)
 			return conn, nil
@@ -158,7 +211,7 @@ func (c *Client) WaitForConnection(ctx context.Context) (*Connection, error) {
 			log.Printf("Pattern %d failed: %v", i+1, err)
 		}
 	}
-	
+
 	return nil, fmt.Errorf("all connection patterns failed")
 }
 
@@ -166,54 +219,12 @@ func (c *Client) WaitForConnection(ctx context.Context) (*Connection, error) {
 func (c *Client) attemptConnection(ctx context.Context, wsURL string) (*Connection, error) {
 	log.Printf("WebSocket connection attempt:")
 	log.Printf("  URL: %s", wsURL)
-	
-	// Match Chromium specification exactly - no custom headers, only subprotocol
-	dialer := &websocket.Dialer{
-		Subprotocols: []string{"fido.cable"},
-	}
-	
-	log.Printf("  Subprotocols: %v", dialer.Subprotocols)
+
 	log.Printf("Attempting WebSocket connection...")
-	conn, resp, err := dialer.Dial(wsURL, nil)
+	conn, err := c.transport.Dial(ctx, wsURL, "fido.cable", nil)
 	if err != nil {
-		log.Printf("WebSocket connection failed:")
-		log.Printf("  Error: %v", err)
-		if resp != nil {
-			log.Printf("  HTTP Status: %s", resp.Status)
-			log.Printf("  HTTP Status Code: %d", resp.StatusCode)
-			log.Printf("  Response Headers:")
-			for k, v := range resp.Header {
-				log.Printf("    %s: %v", k, v)
-			}
-			
-			// Read response body for detailed error information
-			if resp.Body != nil {
-				body, bodyErr := io.ReadAll(resp.Body)
-				resp.Body.Close()
-				if bodyErr == nil && len(body) > 0 {
-					log.Printf("  Response Body (%d bytes):", len(body))
-					// Print first 1000 characters to avoid excessive logging
-					bodyStr := string(body)
-					if len(bodyStr) > 1000 {
-						bodyStr = bodyStr[:1000] + "... (truncated)"
-					}
-					log.Printf("    %s", bodyStr)
-				} else if bodyErr != nil {
-					log.Printf("  Failed to read response body: %v", bodyErr)
-				}
-			}
-		}
 		return nil, fmt.Errorf("failed to connect to tunnel service: %w", err)
 	}
-	
-	log.Printf("WebSocket connection successful!")
-	if resp != nil {
-		log.Printf("  HTTP Status: %s", resp.Status)
-		log.Printf("  Response Headers:")
-		for k, v := range resp.Header {
-			log.Printf("    %s: %v", k, v)
-		}
-	}
 
 	c.conn = conn
 	log.Printf("WebSocket connection established")
@@ -229,144 +240,201 @@ func (c *Client) attemptConnection(ctx context.Context, wsURL string) (*Connecti
 	return handshakeConn, nil
 }
 
-// performHandshake performs the caBLE v2 handshake using Noise protocol
-func (c *Client) performHandshake(ctx context.Context) (*Connection, error) {
-	// Derive handshake key using HKDF
-	handshakeKey, err := c.deriveHandshakeKey()
-	if err != nil {
-		return nil, fmt.Errorf("key derivation failed: %w", err)
+// Reconnect re-establishes a tunnel connection to a previously-paired
+// authenticator without a QR scan, using the state-assisted variant of the
+// caBLE v2 protocol: it dials /cable/contact/<contactID> (rather than
+// /cable/connect/<routing>/<tunnel>) with an X-caBLE-Client-Payload header
+// carrying the pairing secret and a fresh client nonce, and runs
+// Noise_KNpsk0 instead of Noise_NKpsk0: the desktop's identity key from the
+// original QR pairing is the initiator static key the authenticator already
+// knows (see performStateAssistedHandshake).
+func (c *Client) Reconnect(ctx context.Context, contactID []byte, linkingData *LinkingInfo) (*Connection, error) {
+	domain := c.tunnelURL
+	if strings.HasPrefix(domain, "wss://") {
+		domain = strings.TrimPrefix(domain, "wss://")
+	}
+	if strings.HasPrefix(domain, "ws://") {
+		domain = strings.TrimPrefix(domain, "ws://")
 	}
 
-	c.handshakeKey = handshakeKey
+	contactIDB64 := base64.URLEncoding.EncodeToString(contactID)
+	wsURL := fmt.Sprintf("wss://%s/cable/contact/%s", domain, contactIDB64)
 
-	// Desktop-speaks-first handshake
-	// Send initial handshake message
-	initialMessage, err := c.createInitialHandshakeMessage()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create initial message: %w", err)
+	clientNonce := make([]byte, clientNonceLength)
+	if _, err := rand.Read(clientNonce); err != nil {
+		return nil, fmt.Errorf("failed to generate client nonce: %w", err)
 	}
 
-	err = c.conn.WriteMessage(websocket.BinaryMessage, initialMessage)
+	payload, err := encodeClientPayload(linkingData.PairingSecret, clientNonce)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send initial handshake: %w", err)
+		return nil, fmt.Errorf("failed to encode client payload: %w", err)
 	}
 
-	log.Printf("Sent initial handshake message (%d bytes)", len(initialMessage))
+	headers := http.Header{}
+	headers.Set("X-caBLE-Client-Payload", base64.StdEncoding.EncodeToString(payload))
 
-	// Wait for response from phone
-	_, responseMessage, err := c.conn.ReadMessage()
+	log.Printf("Reconnecting to tunnel service: %s", wsURL)
+	conn, err := c.transport.Dial(ctx, wsURL, "fido.cable", headers)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read handshake response: %w", err)
+		return nil, fmt.Errorf("failed to connect to tunnel service: %w", err)
 	}
 
-	log.Printf("Received handshake response (%d bytes)", len(responseMessage))
+	c.conn = conn
 
-	// Process handshake response and derive session keys
-	encryptKey, decryptKey, err := c.processHandshakeResponse(responseMessage)
+	handshakeConn, err := c.performStateAssistedHandshake(linkingData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to process handshake response: %w", err)
+		conn.Close()
+		return nil, fmt.Errorf("handshake failed: %w", err)
 	}
 
-	return &Connection{
-		conn:       c.conn,
-		encryptKey: encryptKey,
-		decryptKey: decryptKey,
-		sequenceNo: 0,
-	}, nil
+	log.Printf("State-assisted reconnect completed successfully")
+	return handshakeConn, nil
 }
 
-// deriveHandshakeKey derives the handshake key using HKDF
-func (c *Client) deriveHandshakeKey() ([]byte, error) {
-	// Use QR secret as input key material
-	hkdfReader := hkdf.New(sha256.New, c.qrSecret, nil, []byte("caBLE v2 handshake"))
-	
-	key := make([]byte, 32)
-	_, err := hkdfReader.Read(key)
-	if err != nil {
-		return nil, fmt.Errorf("HKDF failed: %w", err)
+// keyPurposePSK is the caBLE v2 key-derivation purpose byte for the Noise
+// pre-shared key, mirroring deriveTunnelID's keyPurposeTunnelID=2 scheme.
+const keyPurposePSK = 3
+
+// keyPurposeCableIdentity is the purpose byte used to deterministically
+// derive the phone's Noise static keypair from the QR secret; see
+// deriveResponderStaticKey. It differs from keyPurposePSK, so the static
+// key and the PSK never come from the same HKDF output.
+const keyPurposeCableIdentity = 4
+
+// derivePSK derives the Noise pre-shared key from secret (the QR secret
+// for a fresh pairing, or the persisted pairing secret for a state-assisted
+// reconnect) according to the caBLE v2 specification (keyPurposePSK = 3).
+func derivePSK(secret []byte) ([]byte, error) {
+	var purpose32 [4]byte
+	purpose32[0] = keyPurposePSK
+
+	psk := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, purpose32[:]), psk); err != nil {
+		return nil, fmt.Errorf("HKDF derivation failed: %w", err)
 	}
-	
-	return key, nil
+	return psk, nil
 }
 
-// createInitialHandshakeMessage creates the initial handshake message
-func (c *Client) createInitialHandshakeMessage() ([]byte, error) {
-	// Create handshake message with public key and nonce
-	nonce := make([]byte, 12)
-	rand.Read(nonce)
-	
-	// Message format: [public_key(33)] + [nonce(12)] + [encrypted_payload]
-	message := make([]byte, 0, 33+12+32)
-	message = append(message, c.publicKey...)
-	message = append(message, nonce...)
-	
-	// Create encrypted payload using handshake key
-	cipher, err := chacha20poly1305.New(c.handshakeKey)
-	if err != nil {
-		return nil, fmt.Errorf("cipher creation failed: %w", err)
-	}
-	
-	payload := []byte("desktop-handshake-v2")
-	encryptedPayload := cipher.Seal(nil, nonce, payload, c.publicKey)
-	message = append(message, encryptedPayload...)
-	
-	return message, nil
+// deriveResponderStaticKey derives the phone's static Noise keypair for
+// the Noise_NKpsk0 QR-pairing handshake. QR-initiated pairing has no
+// channel for the phone to publish a long-term identity key in advance of
+// the handshake, so instead both sides derive the same keypair from the
+// qrSecret shared via the QR code: the desktop computes it locally here to
+// satisfy NK's "responder static key known in advance" precondition, and
+// the phone independently derives the identical keypair from the qrSecret
+// it scanned.
+func deriveResponderStaticKey(qrSecret []byte) (noise.DHKey, error) {
+	var purpose32 [4]byte
+	purpose32[0] = keyPurposeCableIdentity
+	return deriveDeterministicP256Keypair(hkdf.New(sha256.New, qrSecret, nil, purpose32[:]))
 }
 
-// processHandshakeResponse processes the handshake response and derives session keys
-func (c *Client) processHandshakeResponse(response []byte) ([]byte, []byte, error) {
-	if len(response) < 45 { // 33 (pubkey) + 12 (nonce) + minimum encrypted data
-		return nil, nil, fmt.Errorf("handshake response too short: %d bytes", len(response))
-	}
-	
-	// Extract components
-	phonePublicKey := response[:33]
-	nonce := response[33:45]
-	encryptedPayload := response[45:]
-	
-	// Decrypt payload
-	cipher, err := chacha20poly1305.New(c.handshakeKey)
+// performHandshake runs the caBLE v2 Noise_NKpsk0_P256_AESGCM_SHA256
+// handshake: the desktop (Noise initiator) sends "-> e, es", the phone
+// (Noise responder) replies "<- e, ee", and the PSK derived from the QR
+// secret is mixed into both messages.
+func (c *Client) performHandshake(ctx context.Context) (*Connection, error) {
+	psk, err := derivePSK(c.qrSecret)
+	if err != nil {
+		return nil, fmt.Errorf("PSK derivation failed: %w", err)
+	}
+
+	responderStatic, err := deriveResponderStaticKey(c.qrSecret)
+	if err != nil {
+		return nil, fmt.Errorf("responder static key derivation failed: %w", err)
+	}
+
+	hs, err := noise.NewHandshakeState(noise.Config{
+		CipherSuite:           cableNoiseCipherSuite,
+		Pattern:               noise.HandshakeNK,
+		Initiator:             true,
+		PresharedKey:          psk,
+		PresharedKeyPlacement: 0,
+		PeerStatic:            responderStatic.Public,
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("cipher creation failed: %w", err)
+		return nil, fmt.Errorf("failed to initialize Noise handshake: %w", err)
 	}
-	
-	payload, err := cipher.Open(nil, nonce, encryptedPayload, phonePublicKey)
+
+	return c.runInitiatorHandshake(hs)
+}
+
+// performStateAssistedHandshake runs the caBLE v2
+// Noise_KNpsk0_P256_AESGCM_SHA256 handshake used for a contact-ID-based
+// reconnect: unlike the fresh-QR Noise_NKpsk0 flow, the desktop's static
+// key here is c.privateKey/c.publicKey, the identity key it generated for
+// the original QR pairing and which the phone already learned from that
+// QR code, so KN's "initiator static key known in advance" precondition is
+// satisfied without deriving anything fresh. The PSK is derived from the
+// pairing secret persisted from that original pairing's linking info,
+// rather than a QR secret.
+func (c *Client) performStateAssistedHandshake(linkingData *LinkingInfo) (*Connection, error) {
+	psk, err := derivePSK(linkingData.PairingSecret)
 	if err != nil {
-		return nil, nil, fmt.Errorf("decryption failed: %w", err)
+		return nil, fmt.Errorf("PSK derivation failed: %w", err)
 	}
-	
-	log.Printf("Decrypted handshake payload: %s", string(payload))
-	
-	// Derive session keys using both public keys
-	encryptKey, decryptKey, err := c.deriveSessionKeys(phonePublicKey)
+
+	hs, err := noise.NewHandshakeState(noise.Config{
+		CipherSuite:           cableNoiseCipherSuite,
+		Pattern:               noise.HandshakeKN,
+		Initiator:             true,
+		PresharedKey:          psk,
+		PresharedKeyPlacement: 0,
+		StaticKeypair:         noise.DHKey{Private: c.privateKey, Public: c.publicKey},
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("session key derivation failed: %w", err)
+		return nil, fmt.Errorf("failed to initialize Noise handshake: %w", err)
 	}
-	
-	return encryptKey, decryptKey, nil
+
+	return c.runInitiatorHandshake(hs)
 }
 
-// deriveSessionKeys derives session keys for encryption/decryption
-func (c *Client) deriveSessionKeys(phonePublicKey []byte) ([]byte, []byte, error) {
-	// Combine keys for session key derivation
-	sharedInfo := append(c.publicKey, phonePublicKey...)
-	
-	hkdfReader := hkdf.New(sha256.New, c.handshakeKey, nil, append([]byte("caBLE v2 session"), sharedInfo...))
-	
-	encryptKey := make([]byte, 32)
-	decryptKey := make([]byte, 32)
-	
-	_, err := hkdfReader.Read(encryptKey)
+// runInitiatorHandshake drives the desktop side of either caBLE v2
+// handshake pattern this client supports (Noise_NKpsk0 for a fresh QR
+// pairing, Noise_KNpsk0 for a state-assisted reconnect) over c.conn: send
+// the initial handshake message, read the phone's reply, and validate the
+// mandatory post-handshake linking info message before handing back a
+// ready-to-use Connection.
+func (c *Client) runInitiatorHandshake(hs *noise.HandshakeState) (*Connection, error) {
+	// -> e, [s,] es, ...
+	initialMessage, _, _, err := hs.WriteMessage(nil, nil)
 	if err != nil {
-		return nil, nil, fmt.Errorf("encrypt key derivation failed: %w", err)
+		return nil, fmt.Errorf("failed to create initial handshake message: %w", err)
 	}
-	
-	_, err = hkdfReader.Read(decryptKey)
+
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, initialMessage); err != nil {
+		return nil, fmt.Errorf("failed to send initial handshake: %w", err)
+	}
+
+	log.Printf("Sent initial Noise handshake message (%d bytes)", len(initialMessage))
+
+	// Wait for response from phone
+	_, responseMessage, err := c.conn.ReadMessage()
 	if err != nil {
-		return nil, nil, fmt.Errorf("decrypt key derivation failed: %w", err)
+		return nil, fmt.Errorf("failed to read handshake response: %w", err)
 	}
-	
-	return encryptKey, decryptKey, nil
+
+	log.Printf("Received handshake response (%d bytes)", len(responseMessage))
+
+	// <- e, ee, ...; the handshake completes here, yielding the send/receive
+	// CipherStates for the session.
+	_, sendCipher, recvCipher, err := hs.ReadMessage(nil, responseMessage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process handshake response: %w", err)
+	}
+
+	conn := &Connection{
+		conn:    c.conn,
+		send:    sendCipher,
+		recv:    recvCipher,
+		updates: make(chan []byte, 1),
+	}
+
+	if err := conn.readLinkingInfo(); err != nil {
+		return nil, fmt.Errorf("failed to validate post-handshake linking info: %w", err)
+	}
+
+	return conn, nil
 }
 
 // Close closes the tunnel connection
@@ -377,8 +445,9 @@ func (c *Connection) Close() error {
 	return nil
 }
 
-// ReadMessage reads and decrypts a message from the tunnel connection
-func (c *Connection) ReadMessage() ([]byte, error) {
+// readFrame reads and decrypts one padded, framed plaintext from the
+// tunnel connection, without interpreting its type tag.
+func (c *Connection) readFrame() ([]byte, error) {
 	if c.conn == nil {
 		return nil, fmt.Errorf("connection not established")
 	}
@@ -391,26 +460,9 @@ func (c *Connection) ReadMessage() ([]byte, error) {
 		return nil, fmt.Errorf("failed to read message: %w", err)
 	}
 
-	return c.decryptMessage(encryptedMessage)
-}
-
-// decryptMessage decrypts an incoming message
-func (c *Connection) decryptMessage(encryptedMessage []byte) ([]byte, error) {
-	if len(encryptedMessage) < 28 { // 12 (nonce) + 16 (tag) + minimum data
-		return nil, fmt.Errorf("encrypted message too short: %d bytes", len(encryptedMessage))
-	}
-
-	cipher, err := chacha20poly1305.New(c.decryptKey)
-	if err != nil {
-		return nil, fmt.Errorf("cipher creation failed: %w", err)
-	}
-
-	// Extract nonce and ciphertext
-	nonce := encryptedMessage[:12]
-	ciphertext := encryptedMessage[12:]
-
-	// Decrypt message
-	plaintext, err := cipher.Open(nil, nonce, ciphertext, nil)
+	// recv.Decrypt tracks its own incrementing nonce, so messages must be
+	// processed in the order the peer sent them.
+	plaintext, err := c.recv.Decrypt(nil, nil, encryptedMessage)
 	if err != nil {
 		return nil, fmt.Errorf("decryption failed: %w", err)
 	}
@@ -418,39 +470,147 @@ func (c *Connection) decryptMessage(encryptedMessage []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
-// WriteMessage encrypts and writes a message to the tunnel connection
-func (c *Connection) WriteMessage(message []byte) error {
+// writeFrame pads payload with messageType as its type tag and encrypts
+// and sends the result.
+func (c *Connection) writeFrame(messageType byte, payload []byte) error {
 	if c.conn == nil {
 		return fmt.Errorf("connection not established")
 	}
 
-	encryptedMessage, err := c.encryptMessage(message)
+	// send.Encrypt tracks its own incrementing nonce (a big-endian
+	// counter, per the Noise spec) independently of the recv direction.
+	ciphertext, err := c.send.Encrypt(nil, nil, padMessage(messageType, payload))
 	if err != nil {
 		return fmt.Errorf("encryption failed: %w", err)
 	}
 
-	return c.conn.WriteMessage(websocket.BinaryMessage, encryptedMessage)
+	return c.conn.WriteMessage(websocket.BinaryMessage, ciphertext)
 }
 
-// encryptMessage encrypts an outgoing message
-func (c *Connection) encryptMessage(message []byte) ([]byte, error) {
-	cipher, err := chacha20poly1305.New(c.encryptKey)
+// readLinkingInfo reads and validates the mandatory post-handshake message
+// the phone must send before any CTAP traffic: a messageTypeUpdate frame
+// carrying caBLE v2 linking/getInfo data. Requiring and decrypting it here
+// doubles as key confirmation that the phone completed the handshake with
+// the same session keys as the desktop.
+func (c *Connection) readLinkingInfo() error {
+	frame, err := c.readFrame()
+	if err != nil {
+		return fmt.Errorf("failed to read linking info message: %w", err)
+	}
+
+	msgType, payload, err := unpadMessage(frame)
+	if err != nil {
+		return fmt.Errorf("failed to unpad linking info message: %w", err)
+	}
+	if msgType != messageTypeUpdate {
+		return fmt.Errorf("expected update (linking info) message as first post-handshake message, got type 0x%02x", msgType)
+	}
+	if len(payload) == 0 {
+		return fmt.Errorf("linking info message was empty")
+	}
+
+	linkingInfo, err := parseLinkingInfo(payload)
 	if err != nil {
-		return nil, fmt.Errorf("cipher creation failed: %w", err)
+		return fmt.Errorf("failed to parse linking info: %w", err)
+	}
+	c.linkingInfo = linkingInfo
+
+	log.Printf("Received post-handshake linking info (%d bytes)", len(payload))
+	select {
+	case c.updates <- payload:
+	default:
+		log.Printf("dropping linking info message, Updates channel full")
+	}
+	return nil
+}
+
+// LinkingInfo returns the pairing state the phone sent in its mandatory
+// post-handshake message, or nil if the handshake hasn't completed yet.
+// Callers should persist this and pass it to Client.Reconnect to
+// re-establish a tunnel connection later without scanning a QR code again.
+func (c *Connection) LinkingInfo() *LinkingInfo {
+	return c.linkingInfo
+}
+
+// ReadCTAP reads the next CTAP2 message payload from the tunnel
+// connection. Interleaved messageTypeUpdate frames are forwarded to the
+// channel returned by Updates instead of being returned here. ErrShutdown
+// is returned once the phone sends a shutdown message.
+func (c *Connection) ReadCTAP() ([]byte, error) {
+	for {
+		frame, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		msgType, payload, err := unpadMessage(frame)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpad message: %w", err)
+		}
+
+		switch msgType {
+		case messageTypeCTAP:
+			return payload, nil
+		case messageTypeUpdate:
+			select {
+			case c.updates <- payload:
+			default:
+				log.Printf("dropping update message, Updates channel full (%d bytes)", len(payload))
+			}
+		case messageTypeShutdown:
+			return nil, ErrShutdown
+		default:
+			return nil, fmt.Errorf("unknown message type 0x%02x", msgType)
+		}
+	}
+}
+
+// WriteCTAP encrypts and writes a CTAP2 message payload to the tunnel
+// connection.
+func (c *Connection) WriteCTAP(payload []byte) error {
+	return c.writeFrame(messageTypeCTAP, payload)
+}
+
+// Updates returns the channel that messageTypeUpdate payloads (including
+// the initial post-handshake linking info) are delivered on.
+func (c *Connection) Updates() <-chan []byte {
+	return c.updates
+}
+
+// padMessage prepends messageType to payload and pads the result with
+// zero bytes up to the next multiple of paddingGranularity, followed by a
+// trailing byte recording how many zero bytes were added so the receiver
+// can strip them.
+func padMessage(messageType byte, payload []byte) []byte {
+	msg := make([]byte, 0, len(payload)+1+paddingGranularity)
+	msg = append(msg, messageType)
+	msg = append(msg, payload...)
+
+	padded := len(msg) + 1 // account for the trailing pad-length byte
+	if rem := padded % paddingGranularity; rem != 0 {
+		padded += paddingGranularity - rem
 	}
+	padLen := padded - len(msg) - 1
 
-	// Generate nonce using sequence number
-	nonce := make([]byte, 12)
-	binary.LittleEndian.PutUint64(nonce[:8], c.sequenceNo)
-	c.sequenceNo++
+	msg = append(msg, make([]byte, padLen)...)
+	msg = append(msg, byte(padLen))
+	return msg
+}
 
-	// Encrypt message
-	ciphertext := cipher.Seal(nil, nonce, message, nil)
+// unpadMessage is the inverse of padMessage: it strips the trailing
+// padding and returns the leading type tag and the remaining payload.
+func unpadMessage(msg []byte) (byte, []byte, error) {
+	if len(msg) < 2 {
+		return 0, nil, fmt.Errorf("padded message too short: %d bytes", len(msg))
+	}
 
-	// Prepend nonce to ciphertext
-	encryptedMessage := append(nonce, ciphertext...)
+	padLen := int(msg[len(msg)-1])
+	if padLen > len(msg)-2 {
+		return 0, nil, fmt.Errorf("invalid pad length %d for a %d-byte message", padLen, len(msg))
+	}
 
-	return encryptedMessage, nil
+	payloadEnd := len(msg) - 1 - padLen
+	return msg[0], msg[1:payloadEnd], nil
 }
 
 // GetTunnelInfo returns tunnel connection information
@@ -460,12 +620,20 @@ func (c *Client) GetTunnelInfo() (string, string, string) {
 	return c.tunnelURL, routingIDHex, tunnelIDHex
 }
 
-// SetTunnelInfo updates routing ID from BLE advertisement
+// SetTunnelInfo updates routing ID and tunnel domain from a decrypted BLE
+// advertisement. encodedTunnelServerDomain is the advertisement's own
+// domain field (see DomainForEncodedTunnelServerDomain); it takes
+// precedence over deriving a domain from the routing ID, since it's the
+// field the spec actually assigns tunnel servers through.
 // Note: tunnelID is derived from QR secret and should not be overwritten
-func (c *Client) SetTunnelInfo(routingID, connectionNonce []byte) {
+func (c *Client) SetTunnelInfo(routingID, connectionNonce []byte, encodedTunnelServerDomain uint16) {
 	c.routingID = routingID
+	if c.tunnelURL == "" {
+		c.tunnelURL = DomainForEncodedTunnelServerDomain(encodedTunnelServerDomain)
+		log.Printf("Derived tunnel domain from advertisement: %s", c.tunnelURL)
+	}
 	// connectionNonce is the nonce from BLE advertisement - we don't use it for tunnel ID
 	// The tunnel ID was already correctly derived from QR secret in NewClient
 	log.Printf("Updated routing ID from BLE advertisement: %x", routingID)
 	log.Printf("Connection nonce from BLE: %x (not used for tunnel ID)", connectionNonce)
-}
\ No newline at end of file
+}
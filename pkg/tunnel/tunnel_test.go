@@ -0,0 +1,577 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flynn/noise"
+
+	"ctap2-hybrid-transport/pkg/ble"
+	"ctap2-hybrid-transport/pkg/cbor"
+)
+
+// encodeLinkingInfoForTest CBOR-encodes a LinkingInfo the way an
+// authenticator would, for tests that exercise parseLinkingInfo.
+func encodeLinkingInfoForTest(info *LinkingInfo) []byte {
+	entries := []cbor.MapEntry{}
+	if info.AuthenticatorPublicKey != nil {
+		entries = append(entries, cbor.Entry(cbor.UnsignedInt(1), cbor.Bytes(info.AuthenticatorPublicKey)))
+	}
+	if info.ContactID != nil {
+		entries = append(entries, cbor.Entry(cbor.UnsignedInt(2), cbor.Bytes(info.ContactID)))
+	}
+	if info.PairingSecret != nil {
+		entries = append(entries, cbor.Entry(cbor.UnsignedInt(3), cbor.Bytes(info.PairingSecret)))
+	}
+	if info.Name != "" {
+		entries = append(entries, cbor.Entry(cbor.UnsignedInt(4), cbor.Text(info.Name)))
+	}
+	return cbor.Encode(cbor.MapOf(entries...))
+}
+
+func TestNoiseP256DHRoundTrip(t *testing.T) {
+	dh := noiseP256{}
+
+	alice, err := dh.GenerateKeypair(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKeypair() failed: %v", err)
+	}
+	bob, err := dh.GenerateKeypair(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKeypair() failed: %v", err)
+	}
+
+	if len(alice.Public) != dh.DHLen() {
+		t.Fatalf("Public key length = %d, want %d", len(alice.Public), dh.DHLen())
+	}
+
+	aliceSecret, err := dh.DH(alice.Private, bob.Public)
+	if err != nil {
+		t.Fatalf("DH() failed: %v", err)
+	}
+	bobSecret, err := dh.DH(bob.Private, alice.Public)
+	if err != nil {
+		t.Fatalf("DH() failed: %v", err)
+	}
+
+	if !bytes.Equal(aliceSecret, bobSecret) {
+		t.Errorf("shared secrets differ: alice=%x bob=%x", aliceSecret, bobSecret)
+	}
+}
+
+func TestDerivePSKDeterministic(t *testing.T) {
+	qrSecret := bytes.Repeat([]byte{0x42}, 16)
+
+	psk1, err := derivePSK(qrSecret)
+	if err != nil {
+		t.Fatalf("derivePSK() failed: %v", err)
+	}
+	psk2, err := derivePSK(qrSecret)
+	if err != nil {
+		t.Fatalf("derivePSK() failed: %v", err)
+	}
+	if !bytes.Equal(psk1, psk2) {
+		t.Errorf("derivePSK() is not deterministic: %x != %x", psk1, psk2)
+	}
+
+	otherPSK, err := derivePSK(bytes.Repeat([]byte{0x24}, 16))
+	if err != nil {
+		t.Fatalf("derivePSK() failed: %v", err)
+	}
+	if bytes.Equal(psk1, otherPSK) {
+		t.Errorf("derivePSK() produced the same key for two different QR secrets")
+	}
+}
+
+func TestDeriveResponderStaticKeyDeterministic(t *testing.T) {
+	qrSecret := bytes.Repeat([]byte{0x11}, 16)
+
+	key1, err := deriveResponderStaticKey(qrSecret)
+	if err != nil {
+		t.Fatalf("deriveResponderStaticKey() failed: %v", err)
+	}
+	key2, err := deriveResponderStaticKey(qrSecret)
+	if err != nil {
+		t.Fatalf("deriveResponderStaticKey() failed: %v", err)
+	}
+
+	if !bytes.Equal(key1.Public, key2.Public) || !bytes.Equal(key1.Private, key2.Private) {
+		t.Errorf("deriveResponderStaticKey() is not deterministic for the same QR secret")
+	}
+}
+
+// TestNoiseHandshakeRoundTrip simulates both sides of the Noise_NKpsk0
+// handshake in-process: the desktop as initiator (no static key of its
+// own) against the phone's responder static key, deterministically
+// derived from the shared QR secret by both sides.
+func TestNoiseHandshakeRoundTrip(t *testing.T) {
+	qrSecret := bytes.Repeat([]byte{0x99}, 16)
+
+	psk, err := derivePSK(qrSecret)
+	if err != nil {
+		t.Fatalf("derivePSK() failed: %v", err)
+	}
+	responderStatic, err := deriveResponderStaticKey(qrSecret)
+	if err != nil {
+		t.Fatalf("deriveResponderStaticKey() failed: %v", err)
+	}
+
+	initiator, err := noise.NewHandshakeState(noise.Config{
+		CipherSuite:           cableNoiseCipherSuite,
+		Pattern:               noise.HandshakeNK,
+		Initiator:             true,
+		PresharedKey:          psk,
+		PresharedKeyPlacement: 0,
+		PeerStatic:            responderStatic.Public,
+	})
+	if err != nil {
+		t.Fatalf("NewHandshakeState(initiator) failed: %v", err)
+	}
+	responder, err := noise.NewHandshakeState(noise.Config{
+		CipherSuite:           cableNoiseCipherSuite,
+		Pattern:               noise.HandshakeNK,
+		Initiator:             false,
+		PresharedKey:          psk,
+		PresharedKeyPlacement: 0,
+		StaticKeypair:         responderStatic,
+	})
+	if err != nil {
+		t.Fatalf("NewHandshakeState(responder) failed: %v", err)
+	}
+
+	// -> e, es
+	msg1, _, _, err := initiator.WriteMessage(nil, nil)
+	if err != nil {
+		t.Fatalf("initiator.WriteMessage() failed: %v", err)
+	}
+	if _, _, _, err := responder.ReadMessage(nil, msg1); err != nil {
+		t.Fatalf("responder.ReadMessage() failed: %v", err)
+	}
+
+	// <- e, ee. Split() always returns (initiator->responder,
+	// responder->initiator), so for the responder that's (recv, send).
+	msg2, responderRecv, responderSend, err := responder.WriteMessage(nil, nil)
+	if err != nil {
+		t.Fatalf("responder.WriteMessage() failed: %v", err)
+	}
+	_, initiatorSend, initiatorRecv, err := initiator.ReadMessage(nil, msg2)
+	if err != nil {
+		t.Fatalf("initiator.ReadMessage() failed: %v", err)
+	}
+
+	plaintext := []byte("authenticatorGetInfo response")
+	ciphertext, err := initiatorSend.Encrypt(nil, nil, plaintext)
+	if err != nil {
+		t.Fatalf("initiatorSend.Encrypt() failed: %v", err)
+	}
+	got, err := responderRecv.Decrypt(nil, nil, ciphertext)
+	if err != nil {
+		t.Fatalf("responderRecv.Decrypt() failed: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("desktop->phone round trip = %q, want %q", got, plaintext)
+	}
+
+	reply := []byte("authenticatorMakeCredential request")
+	replyCiphertext, err := responderSend.Encrypt(nil, nil, reply)
+	if err != nil {
+		t.Fatalf("responderSend.Encrypt() failed: %v", err)
+	}
+	gotReply, err := initiatorRecv.Decrypt(nil, nil, replyCiphertext)
+	if err != nil {
+		t.Fatalf("initiatorRecv.Decrypt() failed: %v", err)
+	}
+	if !bytes.Equal(gotReply, reply) {
+		t.Errorf("phone->desktop round trip = %q, want %q", gotReply, reply)
+	}
+}
+
+// TestStateAssistedHandshakeRoundTrip simulates both sides of the
+// Noise_KNpsk0 state-assisted reconnect handshake in-process: the desktop
+// as initiator with its persisted identity static key (already known to
+// the phone from the original QR pairing) against the phone's responder,
+// with the PSK derived from the persisted pairing secret instead of a QR
+// secret.
+func TestStateAssistedHandshakeRoundTrip(t *testing.T) {
+	pairingSecret := bytes.Repeat([]byte{0x77}, 16)
+
+	psk, err := derivePSK(pairingSecret)
+	if err != nil {
+		t.Fatalf("derivePSK() failed: %v", err)
+	}
+
+	initiatorStatic, err := noiseP256{}.GenerateKeypair(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKeypair() failed: %v", err)
+	}
+
+	initiator, err := noise.NewHandshakeState(noise.Config{
+		CipherSuite:           cableNoiseCipherSuite,
+		Pattern:               noise.HandshakeKN,
+		Initiator:             true,
+		PresharedKey:          psk,
+		PresharedKeyPlacement: 0,
+		StaticKeypair:         initiatorStatic,
+	})
+	if err != nil {
+		t.Fatalf("NewHandshakeState(initiator) failed: %v", err)
+	}
+	responder, err := noise.NewHandshakeState(noise.Config{
+		CipherSuite:           cableNoiseCipherSuite,
+		Pattern:               noise.HandshakeKN,
+		Initiator:             false,
+		PresharedKey:          psk,
+		PresharedKeyPlacement: 0,
+		PeerStatic:            initiatorStatic.Public,
+	})
+	if err != nil {
+		t.Fatalf("NewHandshakeState(responder) failed: %v", err)
+	}
+
+	// -> e
+	msg1, _, _, err := initiator.WriteMessage(nil, nil)
+	if err != nil {
+		t.Fatalf("initiator.WriteMessage() failed: %v", err)
+	}
+	if _, _, _, err := responder.ReadMessage(nil, msg1); err != nil {
+		t.Fatalf("responder.ReadMessage() failed: %v", err)
+	}
+
+	// <- e, ee, se. Split() always returns (initiator->responder,
+	// responder->initiator), so for the responder that's (recv, send).
+	msg2, responderRecv, responderSend, err := responder.WriteMessage(nil, nil)
+	if err != nil {
+		t.Fatalf("responder.WriteMessage() failed: %v", err)
+	}
+	_, initiatorSend, initiatorRecv, err := initiator.ReadMessage(nil, msg2)
+	if err != nil {
+		t.Fatalf("initiator.ReadMessage() failed: %v", err)
+	}
+
+	plaintext := []byte("linking info reply")
+	ciphertext, err := initiatorSend.Encrypt(nil, nil, plaintext)
+	if err != nil {
+		t.Fatalf("initiatorSend.Encrypt() failed: %v", err)
+	}
+	got, err := responderRecv.Decrypt(nil, nil, ciphertext)
+	if err != nil {
+		t.Fatalf("responderRecv.Decrypt() failed: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("desktop->phone round trip = %q, want %q", got, plaintext)
+	}
+
+	reply := []byte("CTAP response")
+	replyCiphertext, err := responderSend.Encrypt(nil, nil, reply)
+	if err != nil {
+		t.Fatalf("responderSend.Encrypt() failed: %v", err)
+	}
+	gotReply, err := initiatorRecv.Decrypt(nil, nil, replyCiphertext)
+	if err != nil {
+		t.Fatalf("initiatorRecv.Decrypt() failed: %v", err)
+	}
+	if !bytes.Equal(gotReply, reply) {
+		t.Errorf("phone->desktop round trip = %q, want %q", gotReply, reply)
+	}
+}
+
+func TestLinkingInfoRoundTrip(t *testing.T) {
+	want := &LinkingInfo{
+		AuthenticatorPublicKey: bytes.Repeat([]byte{0x01}, 33),
+		ContactID:              []byte{0x02, 0x03, 0x04},
+		PairingSecret:          bytes.Repeat([]byte{0x05}, 16),
+		Name:                   "Pixel 8",
+	}
+
+	encoded := encodeLinkingInfoForTest(want)
+
+	got, err := parseLinkingInfo(encoded)
+	if err != nil {
+		t.Fatalf("parseLinkingInfo() failed: %v", err)
+	}
+
+	if !bytes.Equal(got.AuthenticatorPublicKey, want.AuthenticatorPublicKey) ||
+		!bytes.Equal(got.ContactID, want.ContactID) ||
+		!bytes.Equal(got.PairingSecret, want.PairingSecret) ||
+		got.Name != want.Name {
+		t.Errorf("parseLinkingInfo() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseLinkingInfoRejectsMissingFields(t *testing.T) {
+	testCases := []struct {
+		name string
+		info *LinkingInfo
+	}{
+		{"missing authenticator public key", &LinkingInfo{ContactID: []byte{0x01}, PairingSecret: []byte{0x02}}},
+		{"missing contact ID", &LinkingInfo{AuthenticatorPublicKey: []byte{0x01}, PairingSecret: []byte{0x02}}},
+		{"missing pairing secret", &LinkingInfo{AuthenticatorPublicKey: []byte{0x01}, ContactID: []byte{0x02}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded := encodeLinkingInfoForTest(tc.info)
+			if _, err := parseLinkingInfo(encoded); err == nil {
+				t.Errorf("parseLinkingInfo(%+v): want error, got nil", tc.info)
+			}
+		})
+	}
+}
+
+func TestParseLinkingInfoRejectsMalformedCBOR(t *testing.T) {
+	if _, err := parseLinkingInfo([]byte{0xFF, 0xFF, 0xFF}); err == nil {
+		t.Errorf("parseLinkingInfo(malformed): want error, got nil")
+	}
+}
+
+func TestEncodeClientPayloadRoundTrip(t *testing.T) {
+	pairingSecret := bytes.Repeat([]byte{0x0A}, 16)
+	clientNonce := bytes.Repeat([]byte{0x0B}, clientNonceLength)
+
+	encoded, err := encodeClientPayload(pairingSecret, clientNonce)
+	if err != nil {
+		t.Fatalf("encodeClientPayload() failed: %v", err)
+	}
+
+	decoded, rest, err := cbor.Decode(encoded)
+	if err != nil {
+		t.Fatalf("failed to decode client payload: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("unexpected trailing bytes after client payload: %d", len(rest))
+	}
+
+	gotPairingSecret, ok := decoded.Get(cbor.UnsignedInt(1))
+	if !ok {
+		t.Fatalf("client payload missing pairing secret")
+	}
+	if !bytes.Equal(gotPairingSecret.Bytes, pairingSecret) {
+		t.Errorf("PairingSecret = %x, want %x", gotPairingSecret.Bytes, pairingSecret)
+	}
+
+	gotClientNonce, ok := decoded.Get(cbor.UnsignedInt(2))
+	if !ok {
+		t.Fatalf("client payload missing client nonce")
+	}
+	if !bytes.Equal(gotClientNonce.Bytes, clientNonce) {
+		t.Errorf("ClientNonce = %x, want %x", gotClientNonce.Bytes, clientNonce)
+	}
+}
+
+// failingTransport is a TunnelTransport whose Dial always fails, used to
+// exercise Client wiring without performing real network I/O.
+type failingTransport struct {
+	err error
+}
+
+func (f failingTransport) Dial(ctx context.Context, url string, subprotocol string, headers http.Header) (Framed, error) {
+	return nil, f.err
+}
+
+// fakeScanner is a Scanner that returns a canned TunnelInfo or error,
+// standing in for BLE hardware in AwaitAdvertAndConnect tests.
+type fakeScanner struct {
+	info *ble.TunnelInfo
+	err  error
+}
+
+func (f fakeScanner) WaitForTunnelAdvertisement(ctx context.Context) (*ble.TunnelInfo, error) {
+	return f.info, f.err
+}
+
+func TestAwaitAdvertAndConnectWiresTunnelInfo(t *testing.T) {
+	client, err := NewClient("", bytes.Repeat([]byte{0x01}, 32), bytes.Repeat([]byte{0x02}, 33), bytes.Repeat([]byte{0x03}, 16))
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	client.transport = failingTransport{err: errors.New("dial error (test)")}
+
+	routingID := []byte{0xAA, 0xBB, 0xCC}
+	scanner := fakeScanner{info: &ble.TunnelInfo{
+		RoutingID:           routingID,
+		ConnectionNonce:     bytes.Repeat([]byte{0xDD}, 10),
+		EncodedTunnelDomain: 1,
+	}}
+
+	if _, err := client.AwaitAdvertAndConnect(context.Background(), scanner); err == nil {
+		t.Fatalf("AwaitAdvertAndConnect(): want error from transport dial failure, got nil")
+	}
+
+	if want := DomainForEncodedTunnelServerDomain(1); client.tunnelURL != want {
+		t.Errorf("tunnelURL = %q, want %q", client.tunnelURL, want)
+	}
+	if !bytes.Equal(client.routingID, routingID) {
+		t.Errorf("routingID = %x, want %x", client.routingID, routingID)
+	}
+}
+
+func TestAwaitAdvertAndConnectPropagatesScannerError(t *testing.T) {
+	client, err := NewClient("wss://cable.example.com", bytes.Repeat([]byte{0x01}, 32), bytes.Repeat([]byte{0x02}, 33), bytes.Repeat([]byte{0x03}, 16))
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+
+	wantErr := errors.New("no advertisement seen")
+	scanner := fakeScanner{err: wantErr}
+
+	_, err = client.AwaitAdvertAndConnect(context.Background(), scanner)
+	if err == nil || !strings.Contains(err.Error(), wantErr.Error()) {
+		t.Errorf("AwaitAdvertAndConnect() error = %v, want wrapping %v", err, wantErr)
+	}
+}
+
+// fakeFramed is a minimal Framed that fails every read/write, just enough
+// to confirm Client plumbs a transport-provided connection through without
+// touching a real network socket.
+type fakeFramed struct{}
+
+func (fakeFramed) WriteMessage(messageType int, data []byte) error { return errors.New("no-op") }
+func (fakeFramed) ReadMessage() (int, []byte, error)               { return 0, nil, errors.New("no-op") }
+func (fakeFramed) SetReadDeadline(t time.Time) error               { return nil }
+func (fakeFramed) Close() error                                    { return nil }
+
+func TestAttemptConnectionUsesTransport(t *testing.T) {
+	client, err := NewClient("wss://cable.example.com", bytes.Repeat([]byte{0x01}, 32), bytes.Repeat([]byte{0x02}, 33), bytes.Repeat([]byte{0x03}, 16))
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	client.transport = failingTransport{err: errors.New("dial error (test)")}
+
+	if _, err := client.WaitForConnection(context.Background()); err == nil {
+		t.Errorf("WaitForConnection(): want error when transport.Dial fails, got nil")
+	}
+}
+
+func TestDomainForRoutingIDAssignedDomains(t *testing.T) {
+	testCases := []struct {
+		name      string
+		routingID []byte
+		want      string
+	}{
+		{"index 0", []byte{0x00, 0x11, 0x22}, "cable.ua5v.com"},
+		{"index 1", []byte{0x01, 0x11, 0x22}, "cable.auth.com"},
+		{"empty routing ID falls back to index 0", nil, "cable.ua5v.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DomainForRoutingID(tc.routingID); got != tc.want {
+				t.Errorf("DomainForRoutingID(%x) = %q, want %q", tc.routingID, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDomainForRoutingIDSynthesizesHigherIndices(t *testing.T) {
+	routingID := []byte{0x02, 0x11, 0x22}
+
+	domain := DomainForRoutingID(routingID)
+	if !strings.HasPrefix(domain, "cable.") || !strings.HasSuffix(domain, ".net") {
+		t.Errorf("DomainForRoutingID(%x) = %q, want cable.<hash>.net", routingID, domain)
+	}
+
+	// Synthesis only depends on the routing ID's first byte, so it must be
+	// deterministic across calls and across otherwise-differing routing IDs.
+	other := DomainForRoutingID([]byte{0x02, 0xFF, 0xFF})
+	if domain != other {
+		t.Errorf("DomainForRoutingID() = %q and %q, want equal (both index 2)", domain, other)
+	}
+
+	higher := DomainForRoutingID([]byte{0x03, 0x11, 0x22})
+	if domain == higher {
+		t.Errorf("DomainForRoutingID() produced the same domain for indices 2 and 3")
+	}
+}
+
+func TestDomainForEncodedTunnelServerDomainAssignedDomains(t *testing.T) {
+	testCases := []struct {
+		name    string
+		encoded uint16
+		want    string
+	}{
+		{"index 0", 0, "cable.ua5v.com"},
+		{"index 1", 1, "cable.auth.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DomainForEncodedTunnelServerDomain(tc.encoded); got != tc.want {
+				t.Errorf("DomainForEncodedTunnelServerDomain(%d) = %q, want %q", tc.encoded, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDomainForEncodedTunnelServerDomainSynthesizesHigherValues(t *testing.T) {
+	domain := DomainForEncodedTunnelServerDomain(2)
+	if !strings.HasPrefix(domain, "cable.") || !strings.HasSuffix(domain, ".net") {
+		t.Errorf("DomainForEncodedTunnelServerDomain(2) = %q, want cable.<hash>.net", domain)
+	}
+
+	if other := DomainForEncodedTunnelServerDomain(2); domain != other {
+		t.Errorf("DomainForEncodedTunnelServerDomain(2) is not deterministic: %q != %q", domain, other)
+	}
+
+	if higher := DomainForEncodedTunnelServerDomain(3); domain == higher {
+		t.Errorf("DomainForEncodedTunnelServerDomain() produced the same domain for 2 and 3")
+	}
+}
+
+func TestPadUnpadMessageRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name        string
+		messageType byte
+		payload     []byte
+	}{
+		{"empty CTAP payload", messageTypeCTAP, nil},
+		{"short update payload", messageTypeUpdate, []byte("linking-info")},
+		{"shutdown with no payload", messageTypeShutdown, []byte{}},
+		{"payload exactly one block", messageTypeCTAP, bytes.Repeat([]byte{0xAB}, paddingGranularity-2)},
+		{"payload spanning multiple blocks", messageTypeCTAP, bytes.Repeat([]byte{0xCD}, paddingGranularity*3+5)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			padded := padMessage(tc.messageType, tc.payload)
+			if len(padded)%paddingGranularity != 0 {
+				t.Errorf("padded length %d is not a multiple of %d", len(padded), paddingGranularity)
+			}
+
+			gotType, gotPayload, err := unpadMessage(padded)
+			if err != nil {
+				t.Fatalf("unpadMessage() failed: %v", err)
+			}
+			if gotType != tc.messageType {
+				t.Errorf("type = 0x%02x, want 0x%02x", gotType, tc.messageType)
+			}
+			if !bytes.Equal(gotPayload, tc.payload) {
+				t.Errorf("payload = %x, want %x", gotPayload, tc.payload)
+			}
+		})
+	}
+}
+
+func TestUnpadMessageRejectsMalformedInput(t *testing.T) {
+	testCases := []struct {
+		name string
+		msg  []byte
+	}{
+		{"empty message", nil},
+		{"single byte", []byte{0x01}},
+		{"pad length exceeds message", []byte{0x01, 0xFF}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := unpadMessage(tc.msg); err == nil {
+				t.Errorf("unpadMessage(%x): want error, got nil", tc.msg)
+			}
+		})
+	}
+}